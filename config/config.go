@@ -3,8 +3,11 @@ package config
 import (
 	"encoding/json"
 	"log"
+	"otterchatbot/internal/core"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,8 +15,43 @@ import (
 type Config struct {
 	AppEnv      string
 	BotToken    string
+	// Alamat Bot API, kosong = api.telegram.org (bisa diarahkan ke Local Bot API Server)
+	TelegramAPIURL string
 	SupabaseURL string
 	SupabaseKey string
+	// Backend penyimpanan: supabase (default), memory, sqlite, postgres
+	StorageDriver string
+	DatabaseDSN   string
+	// Mode penerimaan update: polling (default) atau webhook
+	UpdateMode        string
+	WebhookURL        string
+	WebhookListenAddr string
+	WebhookSecret     string
+	// Jumlah worker & kapasitas antrian per worker untuk dispatcher update
+	DispatchWorkers   int
+	DispatchQueueSize int
+	// Batas waktu menunggu update yang sedang diproses saat shutdown
+	ShutdownTimeout time.Duration
+	// Berapa lama dua user yang baru selesai chat tidak akan dipasangkan lagi
+	PartnerCooldown time.Duration
+	// Skor minimum matchmaker & berapa lama sampai syarat itu melonggar jadi 0
+	MatchMinScore   int
+	MatchRelaxAfter time.Duration
+	// Lama menunggu sebelum pencarian diperlebar: lokasi ke region, lalu global, lalu mood ke "all"
+	WidenRegionAfter time.Duration
+	WidenGlobalAfter time.Duration
+	WidenMoodAfter   time.Duration
+	// Interval update pesan "Searching..." & batas waktu menunggu di antrian (0 = tanpa batas)
+	SearchStatusInterval time.Duration
+	QueueTimeout         time.Duration
+	// Penerjemah untuk fitur VIP auto-translate: "none" (mati) atau "dictionary" (kamus lokal)
+	Translator     string
+	DictionaryPath string
+	// Batas waktu /unsend menarik pesan dari chat partner (0 = tanpa batas, tetap dibatasi 48 jam oleh Telegram)
+	UnsendWindow time.Duration
+	// Aturan per jenis media yang diteruskan di chat (allow, spoiler, block, vip_only, min_messages)
+	MediaPolicyPath string
+	MediaPolicy     core.MediaPolicy
 	AdminIDs    []string
 	DefaultLang string
 	// [BARU] Menyimpan daftar paket VIP
@@ -38,8 +76,30 @@ func LoadConfig() *Config {
 	cfg := &Config{
 		AppEnv:      getEnv("APP_ENV", "development"),
 		BotToken:    getEnv("BOT_TOKEN", ""),
+		TelegramAPIURL: getEnv("TELEGRAM_API_URL", ""),
 		SupabaseURL: getEnv("SUPABASE_URL", ""),
 		SupabaseKey: getEnv("SUPABASE_KEY", ""),
+		StorageDriver: getEnv("STORAGE_DRIVER", "supabase"),
+		DatabaseDSN:   getEnv("DATABASE_DSN", "otterchat.db"),
+		UpdateMode:        getEnv("UPDATE_MODE", "polling"),
+		WebhookURL:        getEnv("WEBHOOK_URL", ""),
+		WebhookListenAddr: getEnv("WEBHOOK_LISTEN_ADDR", ":8080"),
+		WebhookSecret:     getEnv("WEBHOOK_SECRET", ""),
+		DispatchWorkers:   getEnvInt("DISPATCH_WORKERS", 16),
+		DispatchQueueSize: getEnvInt("DISPATCH_QUEUE_SIZE", 100),
+		ShutdownTimeout:   time.Duration(getEnvInt("SHUTDOWN_TIMEOUT_SEC", 20)) * time.Second,
+		PartnerCooldown:   time.Duration(getEnvInt("PARTNER_COOLDOWN_MIN", 30)) * time.Minute,
+		MatchMinScore:     getEnvInt("MATCH_MIN_SCORE", 0),
+		MatchRelaxAfter:   time.Duration(getEnvInt("MATCH_RELAX_SEC", 30)) * time.Second,
+		WidenRegionAfter:  time.Duration(getEnvInt("WIDEN_REGION_SEC", 30)) * time.Second,
+		WidenGlobalAfter:  time.Duration(getEnvInt("WIDEN_GLOBAL_SEC", 60)) * time.Second,
+		WidenMoodAfter:    time.Duration(getEnvInt("WIDEN_MOOD_SEC", 120)) * time.Second,
+		SearchStatusInterval: time.Duration(getEnvInt("SEARCH_STATUS_SEC", 20)) * time.Second,
+		QueueTimeout:         time.Duration(getEnvInt("QUEUE_TIMEOUT_MIN", 5)) * time.Minute,
+		Translator:     getEnv("TRANSLATOR", "none"),
+		DictionaryPath: getEnv("TRANSLATOR_DICTIONARY", "config/dictionary.json"),
+		UnsendWindow:    time.Duration(getEnvInt("UNSEND_WINDOW_MIN", 60)) * time.Minute,
+		MediaPolicyPath: getEnv("MEDIA_POLICY_PATH", "config/media_policy.json"),
 		DefaultLang: getEnv("DEFAULT_LANG", "en"),
 	}
 
@@ -49,10 +109,33 @@ func LoadConfig() *Config {
 	}
 
 	if cfg.BotToken == "" { log.Fatal("Fatal: BOT_TOKEN required") }
-	if cfg.SupabaseURL == "" { log.Fatal("Fatal: SUPABASE_URL required") }
+	switch cfg.StorageDriver {
+	case "supabase":
+		if cfg.SupabaseURL == "" { log.Fatal("Fatal: SUPABASE_URL required") }
+	case "memory", "sqlite", "postgres":
+		// Tidak butuh Supabase
+	default:
+		log.Fatalf("Fatal: unknown STORAGE_DRIVER %q (use supabase, memory, sqlite or postgres)", cfg.StorageDriver)
+	}
+
+	switch cfg.UpdateMode {
+	case "polling":
+	case "webhook":
+		if cfg.WebhookURL == "" { log.Fatal("Fatal: WEBHOOK_URL required in webhook mode") }
+		if cfg.WebhookSecret == "" { log.Println("Warning: WEBHOOK_SECRET is empty, webhook requests will not be verified") }
+	default:
+		log.Fatalf("Fatal: unknown UPDATE_MODE %q (use polling or webhook)", cfg.UpdateMode)
+	}
+
+	switch cfg.Translator {
+	case "none", "dictionary":
+	default:
+		log.Fatalf("Fatal: unknown TRANSLATOR %q (use none or dictionary)", cfg.Translator)
+	}
 
 	// [BARU] Load Pricing JSON
 	cfg.loadPricing()
+	cfg.loadMediaPolicy()
 
 	return cfg
 }
@@ -71,9 +154,57 @@ func (c *Config) loadPricing() {
 	}
 }
 
+// loadMediaPolicy membaca media policy di atas DefaultMediaPolicy; jenis yang tidak ada di file memakai default
+func (c *Config) loadMediaPolicy() {
+	c.MediaPolicy = core.DefaultMediaPolicy()
+
+	file, err := os.ReadFile(c.MediaPolicyPath)
+	if err != nil {
+		log.Printf("Warning: Could not load %s: %v. Using default media policy.", c.MediaPolicyPath, err)
+		return
+	}
+
+	var rules core.MediaPolicy
+	if err := json.Unmarshal(file, &rules); err != nil {
+		log.Printf("Error parsing %s: %v. Using default media policy.", c.MediaPolicyPath, err)
+		return
+	}
+
+	for mediaType, rule := range rules {
+		if !core.ValidMediaType(mediaType) {
+			log.Printf("Warning: unknown media type %q in %s, ignored", mediaType, c.MediaPolicyPath)
+			continue
+		}
+		if !core.ValidMediaAction(rule.Action) {
+			log.Printf("Warning: unknown action %q for %s in %s, ignored", rule.Action, mediaType, c.MediaPolicyPath)
+			continue
+		}
+		// Spoiler pada jenis yang tidak bisa di-blur akan diam-diam jadi "allow", jadi tolak di sini
+		if rule.Action == core.MediaSpoiler && !core.SpoilerSupported(mediaType) {
+			log.Printf("Warning: action %q is not supported for %s in %s (only photo, video & animation can be blurred), ignored", rule.Action, mediaType, c.MediaPolicyPath)
+			continue
+		}
+		c.MediaPolicy[mediaType] = rule
+	}
+	log.Printf("Loaded media policy for %d media types.", len(rules))
+}
+
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
 	return fallback
-}
\ No newline at end of file
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: %s=%q is not a number, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
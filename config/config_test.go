@@ -0,0 +1,44 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"otterchatbot/internal/core"
+)
+
+func TestLoadMediaPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "media_policy.json")
+	policy := `{
+  "photo": { "action": "block" },
+  "document": { "action": "spoiler", "min_messages": 10 },
+  "voice": { "action": "spoiler" },
+  "contact": { "action": "vip_only", "min_messages": 20 },
+  "poll": { "action": "explode" },
+  "hologram": { "action": "allow" }
+}`
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+
+	c := &Config{MediaPolicyPath: path}
+	c.loadMediaPolicy()
+
+	want := map[string]core.MediaRule{
+		core.MediaPhoto:    {Action: core.MediaBlock},
+		core.MediaVideo:    {Action: core.MediaSpoiler}, // Default tetap berlaku
+		core.MediaDocument: {Action: core.MediaAllow},   // Spoiler tidak didukung, ditolak
+		core.MediaVoice:    {Action: core.MediaAllow},
+		core.MediaContact:  {Action: core.MediaVIPOnly, MinMessages: 20},
+		core.MediaPoll:     {Action: core.MediaAllow}, // Aksi tidak dikenal, ditolak
+	}
+	for mediaType, rule := range want {
+		if got := c.MediaPolicy.Rule(mediaType); got != rule {
+			t.Errorf("rule for %s = %+v, want %+v", mediaType, got, rule)
+		}
+	}
+	if _, ok := c.MediaPolicy["hologram"]; ok {
+		t.Error("unknown media type was loaded")
+	}
+}
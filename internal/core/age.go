@@ -0,0 +1,79 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Batas umur yang diterima saat user mengisi tahun lahir
+const (
+	MinAge   = 13
+	MaxAge   = 100
+	AdultAge = 18
+)
+
+// AgeBrackets adalah kelompok umur yang ditampilkan di profil & dipakai filter VIP (Label = key i18n).
+// Code berformat "min-max", max 0 berarti tanpa batas atas.
+var AgeBrackets = []Option{
+	{Code: "13-17", Label: "age_bracket_under_18"},
+	{Code: "18-24", Label: "age_bracket_18_24"},
+	{Code: "25-34", Label: "age_bracket_25_34"},
+	{Code: "35-44", Label: "age_bracket_35_44"},
+	{Code: "45-0", Label: "age_bracket_45_plus"},
+}
+
+// ValidBirthYear mengecek tahun lahir yang diketik user masuk akal
+func ValidBirthYear(year int) bool {
+	age := time.Now().Year() - year
+	return age >= MinAge && age <= MaxAge
+}
+
+// Age menghitung umur dari tahun lahir (perkiraan, tanggal lahir tidak disimpan). 0 jika belum diisi.
+func (u *User) Age() int {
+	if u.BirthYear == 0 {
+		return 0
+	}
+	return time.Now().Year() - u.BirthYear
+}
+
+// IsAdult: umur sudah diisi dan minimal 18 tahun
+func (u *User) IsAdult() bool {
+	return u.Age() >= AdultAge
+}
+
+// AgeBracket mengembalikan kelompok umur user, ok=false jika umur belum diisi
+func (u *User) AgeBracket() (Option, bool) {
+	age := u.Age()
+	if age == 0 {
+		return Option{}, false
+	}
+	for _, b := range AgeBrackets {
+		min, max := ParseAgeRange(b.Code)
+		if age >= min && (max == 0 || age <= max) {
+			return b, true
+		}
+	}
+	return Option{}, false
+}
+
+// ParseAgeRange membaca Code AgeBrackets ("18-24") menjadi batas umur
+func ParseAgeRange(code string) (int, int) {
+	minStr, maxStr, _ := strings.Cut(code, "-")
+	min, _ := strconv.Atoi(minStr)
+	max, _ := strconv.Atoi(maxStr)
+	return min, max
+}
+
+// AcceptsAge mengecek filter umur partner milik user (AgeMin/AgeMax, 0 = tanpa batas).
+// Partner yang belum mengisi umur tidak lolos filter yang aktif.
+func (u *User) AcceptsAge(partner *User) bool {
+	if u.AgeMin == 0 && u.AgeMax == 0 {
+		return true
+	}
+	age := partner.Age()
+	if age == 0 {
+		return false
+	}
+	return age >= u.AgeMin && (u.AgeMax == 0 || age <= u.AgeMax)
+}
@@ -19,6 +19,12 @@ var AvailableCountries = []Option{
 	{Code: "RU", Label: "Russia", Icon: "🇷🇺"},
 	{Code: "US", Label: "USA", Icon: "🇺🇸"},
 	{Code: "IN", Label: "India", Icon: "🇮🇳"},
+	{Code: "TH", Label: "Thailand", Icon: "🇹🇭"},
+	{Code: "PH", Label: "Philippines", Icon: "🇵🇭"},
+	{Code: "VN", Label: "Vietnam", Icon: "🇻🇳"},
+	{Code: "KZ", Label: "Kazakhstan", Icon: "🇰🇿"},
+	{Code: "BY", Label: "Belarus", Icon: "🇧🇾"},
+	{Code: "UZ", Label: "Uzbekistan", Icon: "🇺🇿"},
 	{Code: "GLOBAL", Label: "International", Icon: "🌍"},
 }
 
@@ -29,4 +35,18 @@ var AvailableMoods = []Option{
 	{Code: "fun", Label: "mood_fun", Icon: ""},
 	{Code: "debate", Label: "mood_debate", Icon: ""},
 	{Code: "mabar", Label: "mood_mabar", Icon: ""},
-}
\ No newline at end of file
+}
+
+// AvailableInterests adalah tag minat yang bisa dipilih user di profil (Label = key i18n)
+var AvailableInterests = []Option{
+	{Code: "music", Label: "interest_music", Icon: "🎵"},
+	{Code: "movies", Label: "interest_movies", Icon: "🎬"},
+	{Code: "games", Label: "interest_games", Icon: "🎮"},
+	{Code: "anime", Label: "interest_anime", Icon: "🍥"},
+	{Code: "sports", Label: "interest_sports", Icon: "⚽"},
+	{Code: "books", Label: "interest_books", Icon: "📚"},
+	{Code: "tech", Label: "interest_tech", Icon: "💻"},
+	{Code: "travel", Label: "interest_travel", Icon: "✈️"},
+	{Code: "food", Label: "interest_food", Icon: "🍜"},
+	{Code: "art", Label: "interest_art", Icon: "🎨"},
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// User.Location menyimpan kode negara ISO 3166-1 alpha-2 (lihat AvailableCountries),
+// GlobalLocation untuk "International", atau kosong jika belum diatur.
+// User.City opsional (kota / provinsi), hanya untuk tampilan & skor kecocokan.
+const GlobalLocation = "GLOBAL"
+
+// MaxCityLength membatasi nama kota yang diketik user
+const MaxCityLength = 48
+
+// CountryRegions mengelompokkan negara ke region.
+// Dipakai matchmaker saat pencarian diperlebar dari satu negara ke negara tetangga.
+var CountryRegions = map[string]string{
+	"ID": "SEA",
+	"MY": "SEA",
+	"SG": "SEA",
+	"TH": "SEA",
+	"PH": "SEA",
+	"VN": "SEA",
+	"RU": "CIS",
+	"KZ": "CIS",
+	"BY": "CIS",
+	"UZ": "CIS",
+	"US": "NA",
+	"IN": "SA",
+}
+
+// RegionOf mengembalikan region dari kode negara (mis. "ID" -> "SEA"), kosong jika tidak diketahui
+func RegionOf(code string) string {
+	return CountryRegions[code]
+}
+
+// CountryByCode mencari negara di AvailableCountries
+func CountryByCode(code string) (Option, bool) {
+	for _, c := range AvailableCountries {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return Option{}, false
+}
+
+// IsSpecificLocation: user memilih satu negara tertentu (bukan kosong / International)
+func IsSpecificLocation(code string) bool {
+	return code != "" && code != GlobalLocation
+}
+
+// LocationLabel menampilkan lokasi, mis. "🇮🇩 Indonesia, Bandung". Kosong jika belum diatur.
+func LocationLabel(code string, city string) string {
+	country, ok := CountryByCode(code)
+	if !ok {
+		return ""
+	}
+	label := fmt.Sprintf("%s %s", country.Icon, country.Label)
+	if city != "" && code != GlobalLocation {
+		label += ", " + city
+	}
+	return label
+}
+
+// NormalizeLocation mengubah nilai lokasi lama (teks bebas seperti "🇮🇩 Indonesia", "🌍 International")
+// menjadi kode negara. Return kosong jika tidak dikenali.
+func NormalizeLocation(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "-" {
+		return ""
+	}
+
+	if _, ok := CountryByCode(strings.ToUpper(raw)); ok {
+		return strings.ToUpper(raw)
+	}
+
+	lower := strings.ToLower(raw)
+	if strings.Contains(lower, "international") || strings.Contains(lower, "global") {
+		return GlobalLocation
+	}
+	for _, c := range AvailableCountries {
+		if strings.Contains(lower, strings.ToLower(c.Label)) {
+			return c.Code
+		}
+	}
+
+	// Emoji bendera terdiri dari dua "regional indicator" yang mewakili huruf kode negara
+	if code := flagCode(raw); code != "" {
+		if _, ok := CountryByCode(code); ok {
+			return code
+		}
+	}
+	return ""
+}
+
+func flagCode(s string) string {
+	var code []rune
+	for _, r := range s {
+		if r >= 0x1F1E6 && r <= 0x1F1FF {
+			code = append(code, 'A'+(r-0x1F1E6))
+			if len(code) == 2 {
+				return string(code)
+			}
+		} else {
+			code = code[:0]
+		}
+	}
+	return ""
+}
+
+// CleanCity merapikan nama kota yang diketik user
+func CleanCity(city string) string {
+	city = strings.Join(strings.Fields(city), " ")
+	for utf8.RuneCountInString(city) > MaxCityLength {
+		_, size := utf8.DecodeLastRuneInString(city)
+		city = city[:len(city)-size]
+	}
+	return city
+}
+
+// MigrateLocation mengubah format lokasi lama menjadi kode negara.
+// Teks bebas yang bukan nama negara (mis. nama kota) dipindah ke City. Return true jika ada perubahan.
+func (u *User) MigrateLocation() bool {
+	if u.Location == "" {
+		return false
+	}
+	if _, ok := CountryByCode(u.Location); ok {
+		return false
+	}
+
+	legacy := u.Location
+	u.Location = NormalizeLocation(legacy)
+	if u.Location == "" && u.City == "" && legacy != "-" {
+		u.City = CleanCity(legacy)
+	}
+	return true
+}
+
+// countryBox adalah perkiraan kasar batas wilayah negara (bounding box) untuk lokasi yang dibagikan user
+type countryBox struct {
+	Code           string
+	MinLat, MaxLat float64
+	MinLon, MaxLon float64
+}
+
+func (b countryBox) contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+func (b countryBox) area() float64 {
+	return (b.MaxLat - b.MinLat) * (b.MaxLon - b.MinLon)
+}
+
+// countryBoxes diurutkan dari yang terkecil, supaya negara kecil di dalam kotak negara tetangga
+// (mis. Singapura di dalam kotak Malaysia) tetap terdeteksi
+var countryBoxes = func() []countryBox {
+	boxes := []countryBox{
+		{"SG", 1.15, 1.48, 103.6, 104.1},
+		{"MY", 0.85, 7.4, 99.6, 119.3},
+		{"ID", -11.0, 6.1, 95.0, 141.1},
+		{"TH", 5.6, 20.5, 97.3, 105.7},
+		{"PH", 4.6, 21.2, 116.9, 126.6},
+		{"VN", 8.4, 23.4, 102.1, 109.5},
+		{"RU", 41.2, 81.9, 19.6, 180.0},
+		{"KZ", 40.5, 55.5, 46.5, 87.4},
+		{"BY", 51.2, 56.2, 23.2, 32.8},
+		{"UZ", 37.2, 45.6, 56.0, 73.2},
+		{"US", 24.4, 49.4, -125.0, -66.9},  // Daratan utama
+		{"US", 51.0, 71.5, -180.0, -129.9}, // Alaska
+		{"US", 18.9, 22.3, -160.3, -154.8}, // Hawaii
+		{"IN", 6.7, 35.7, 68.1, 97.4},
+	}
+	sort.SliceStable(boxes, func(i, j int) bool { return boxes[i].area() < boxes[j].area() })
+	return boxes
+}()
+
+// CountryFromCoordinates menebak negara dari koordinat lokasi yang dibagikan user (tanpa layanan eksternal).
+// Return false jika koordinat di luar negara yang didukung.
+func CountryFromCoordinates(lat, lon float64) (string, bool) {
+	for _, b := range countryBoxes {
+		if b.contains(lat, lon) {
+			return b.Code, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeLocation(t *testing.T) {
+	tests := map[string]string{
+		"ID":              "ID",
+		"sg":              "SG",
+		"🇮🇩 Indonesia":    "ID",
+		"🌍 International": "GLOBAL",
+		"russia":          "RU",
+		"🇲🇾":              "MY",
+		"🇫🇷":              "", // Bendera negara yang tidak didukung
+		"Bandung":         "",
+		"-":               "",
+		"  ":              "",
+	}
+	for raw, want := range tests {
+		if got := NormalizeLocation(raw); got != want {
+			t.Errorf("NormalizeLocation(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestMigrateLocation(t *testing.T) {
+	tests := []struct {
+		location, city         string
+		wantLocation, wantCity string
+		changed                bool
+	}{
+		{location: "ID", city: "Bandung", wantLocation: "ID", wantCity: "Bandung"},
+		{location: "🇮🇩 Indonesia", wantLocation: "ID", changed: true},
+		{location: "Jakarta  Selatan", wantCity: "Jakarta Selatan", changed: true},
+		{location: "Surabaya", city: "Malang", wantCity: "Malang", changed: true},
+		{location: "-", changed: true},
+		{},
+	}
+	for _, tt := range tests {
+		u := &User{Location: tt.location, City: tt.city}
+		changed := u.MigrateLocation()
+		if changed != tt.changed || u.Location != tt.wantLocation || u.City != tt.wantCity {
+			t.Errorf("MigrateLocation(%q, %q) = %q, %q, %v; want %q, %q, %v",
+				tt.location, tt.city, u.Location, u.City, changed, tt.wantLocation, tt.wantCity, tt.changed)
+		}
+	}
+}
+
+func TestCleanCity(t *testing.T) {
+	if got := CleanCity("  Kota   Bandung \n"); got != "Kota Bandung" {
+		t.Fatalf("CleanCity = %q", got)
+	}
+	long := CleanCity(strings.Repeat("é", MaxCityLength+5))
+	if n := len([]rune(long)); n != MaxCityLength {
+		t.Fatalf("CleanCity kept %d runes, want %d", n, MaxCityLength)
+	}
+}
+
+func TestCountryFromCoordinates(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     string
+		ok       bool
+	}{
+		{name: "Jakarta", lat: -6.2, lon: 106.8, want: "ID", ok: true},
+		{name: "Singapore inside Malaysia box", lat: 1.35, lon: 103.8, want: "SG", ok: true},
+		{name: "Kuala Lumpur", lat: 3.14, lon: 101.7, want: "MY", ok: true},
+		{name: "Anchorage", lat: 61.2, lon: -149.9, want: "US", ok: true},
+		{name: "Paris", lat: 48.86, lon: 2.35},
+	}
+	for _, tt := range tests {
+		got, ok := CountryFromCoordinates(tt.lat, tt.lon)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: CountryFromCoordinates = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLocationLabel(t *testing.T) {
+	if got := LocationLabel("ID", "Bandung"); got != "🇮🇩 Indonesia, Bandung" {
+		t.Fatalf("LocationLabel = %q", got)
+	}
+	if got := LocationLabel(GlobalLocation, "Bandung"); got != "🌍 International" {
+		t.Fatalf("global label = %q", got)
+	}
+	if got := LocationLabel("", ""); got != "" {
+		t.Fatalf("empty label = %q", got)
+	}
+}
@@ -0,0 +1,116 @@
+package core
+
+// Jenis media yang diteruskan di chat anonim. Dipakai sebagai key di media policy
+// dan label i18n "media_type_<jenis>".
+const (
+	MediaPhoto     = "photo"
+	MediaVideo     = "video"
+	MediaAnimation = "animation"
+	MediaVideoNote = "video_note"
+	MediaVoice     = "voice"
+	MediaAudio     = "audio"
+	MediaDocument  = "document"
+	MediaSticker   = "sticker"
+	MediaContact   = "contact"
+	MediaLocation  = "location"
+	MediaPoll      = "poll"
+)
+
+var MediaTypes = []string{
+	MediaPhoto, MediaVideo, MediaAnimation, MediaVideoNote, MediaVoice, MediaAudio,
+	MediaDocument, MediaSticker, MediaContact, MediaLocation, MediaPoll,
+}
+
+// MediaNeedsConsent: media visual & file yang ditahan sampai penerima setuju menerima media dari partner
+// (kecuali profilnya sudah mengizinkan). Stiker, suara, kontak, dll. tetap langsung diteruskan.
+func MediaNeedsConsent(mediaType string) bool {
+	switch mediaType {
+	case MediaPhoto, MediaVideo, MediaAnimation, MediaVideoNote, MediaDocument:
+		return true
+	}
+	return false
+}
+
+// Aksi media policy
+const (
+	MediaAllow   = "allow"
+	MediaSpoiler = "spoiler" // Diteruskan dengan efek blur; hanya untuk jenis yang lolos SpoilerSupported
+	MediaBlock   = "block"
+	MediaVIPOnly = "vip_only" // Hanya pengirim VIP yang boleh mengirim
+)
+
+// Alasan media ditolak (key i18n "media_denied_<alasan>")
+const (
+	MediaDeniedBlocked  = "blocked"
+	MediaDeniedVIP      = "vip"
+	MediaDeniedTooEarly = "early"
+)
+
+// MediaRule adalah aturan untuk satu jenis media
+type MediaRule struct {
+	Action string `json:"action"`
+	// Baru boleh dikirim setelah sekian pesan saling dikirim dalam sesi (0 = langsung boleh)
+	MinMessages int `json:"min_messages"`
+}
+
+// MediaPolicy adalah aturan per jenis media. Jenis yang tidak tercantum selalu diteruskan.
+type MediaPolicy map[string]MediaRule
+
+// DefaultMediaPolicy sama dengan perilaku lama: foto & video di-blur, sisanya diteruskan apa adanya
+func DefaultMediaPolicy() MediaPolicy {
+	return MediaPolicy{
+		MediaPhoto:     {Action: MediaSpoiler},
+		MediaVideo:     {Action: MediaSpoiler},
+		MediaAnimation: {Action: MediaSpoiler},
+	}
+}
+
+func ValidMediaType(mediaType string) bool {
+	for _, t := range MediaTypes {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidMediaAction(action string) bool {
+	switch action {
+	case MediaAllow, MediaSpoiler, MediaBlock, MediaVIPOnly:
+		return true
+	}
+	return false
+}
+
+// SpoilerSupported: hanya foto, video & GIF yang bisa dikirim dengan has_spoiler di Bot API
+func SpoilerSupported(mediaType string) bool {
+	switch mediaType {
+	case MediaPhoto, MediaVideo, MediaAnimation:
+		return true
+	}
+	return false
+}
+
+// Rule mengembalikan aturan untuk jenis media (MediaAllow jika tidak diatur)
+func (p MediaPolicy) Rule(mediaType string) MediaRule {
+	rule, ok := p[mediaType]
+	if !ok || rule.Action == "" {
+		rule.Action = MediaAllow
+	}
+	return rule
+}
+
+// Check memutuskan apakah sender boleh mengirim media jenis ini setelah exchanged pesan dalam sesi.
+// Return aturan yang berlaku dan alasan ditolak ("" = boleh dikirim).
+func (p MediaPolicy) Check(mediaType string, sender *User, exchanged int) (MediaRule, string) {
+	rule := p.Rule(mediaType)
+	switch {
+	case rule.Action == MediaBlock:
+		return rule, MediaDeniedBlocked
+	case rule.Action == MediaVIPOnly && !sender.IsVIP:
+		return rule, MediaDeniedVIP
+	case exchanged < rule.MinMessages:
+		return rule, MediaDeniedTooEarly
+	}
+	return rule, ""
+}
@@ -0,0 +1,52 @@
+package core
+
+import "testing"
+
+func TestMediaPolicyCheck(t *testing.T) {
+	policy := MediaPolicy{
+		MediaPhoto:    {Action: MediaSpoiler},
+		MediaDocument: {Action: MediaAllow, MinMessages: 10},
+		MediaContact:  {Action: MediaVIPOnly, MinMessages: 20},
+		MediaPoll:     {Action: MediaBlock},
+	}
+	regular, vip := &User{}, &User{IsVIP: true}
+
+	tests := []struct {
+		name       string
+		mediaType  string
+		sender     *User
+		exchanged  int
+		wantAction string
+		wantDenied string
+	}{
+		{name: "spoiler photo", mediaType: MediaPhoto, sender: regular, wantAction: MediaSpoiler},
+		{name: "unlisted type allowed", mediaType: MediaSticker, sender: regular, wantAction: MediaAllow},
+		{name: "document too early", mediaType: MediaDocument, sender: regular, exchanged: 9, wantAction: MediaAllow, wantDenied: MediaDeniedTooEarly},
+		{name: "document after enough messages", mediaType: MediaDocument, sender: regular, exchanged: 10, wantAction: MediaAllow},
+		{name: "contact needs VIP", mediaType: MediaContact, sender: regular, exchanged: 50, wantAction: MediaVIPOnly, wantDenied: MediaDeniedVIP},
+		{name: "VIP contact too early", mediaType: MediaContact, sender: vip, exchanged: 5, wantAction: MediaVIPOnly, wantDenied: MediaDeniedTooEarly},
+		{name: "VIP contact allowed", mediaType: MediaContact, sender: vip, exchanged: 20, wantAction: MediaVIPOnly},
+		{name: "blocked even for VIP", mediaType: MediaPoll, sender: vip, exchanged: 100, wantAction: MediaBlock, wantDenied: MediaDeniedBlocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, denied := policy.Check(tt.mediaType, tt.sender, tt.exchanged)
+			if rule.Action != tt.wantAction || denied != tt.wantDenied {
+				t.Fatalf("Check = %q, %q; want %q, %q", rule.Action, denied, tt.wantAction, tt.wantDenied)
+			}
+		})
+	}
+}
+
+func TestDefaultMediaPolicyOnlyBlursSupportedTypes(t *testing.T) {
+	for mediaType, rule := range DefaultMediaPolicy() {
+		if rule.Action == MediaSpoiler && !SpoilerSupported(mediaType) {
+			t.Errorf("default policy blurs %s, which cannot carry has_spoiler", mediaType)
+		}
+	}
+	for _, mediaType := range []string{MediaDocument, MediaVoice, MediaSticker, MediaVideoNote} {
+		if SpoilerSupported(mediaType) {
+			t.Errorf("SpoilerSupported(%s) = true", mediaType)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package core
+
+// Nilai rating satu sesi
+const (
+	RatingUp   = 1
+	RatingDown = -1
+)
+
+// Tingkat reputasi user, dipakai matchmaker untuk memisahkan user bermasalah
+const (
+	ReputationNormal = "normal"
+	ReputationGood   = "good"
+	ReputationLow    = "low"
+)
+
+// MinRatingsForTier: reputasi baru berpengaruh setelah user menerima sekian rating,
+// supaya satu-dua 👎 tidak langsung menjatuhkan user baru
+const MinRatingsForTier = 5
+
+// Batas skor reputasi (0..1) untuk masing-masing tingkat
+const (
+	GoodReputationScore = 0.8
+	LowReputationScore  = 0.35
+)
+
+// Tag opsional setelah memberi rating (Label = key i18n)
+var RatingUpTags = []Option{
+	{Code: "friendly", Label: "rate_tag_friendly", Icon: "😊"},
+	{Code: "funny", Label: "rate_tag_funny", Icon: "😂"},
+	{Code: "interesting", Label: "rate_tag_interesting", Icon: "💡"},
+}
+
+var RatingDownTags = []Option{
+	{Code: "rude", Label: "rate_tag_rude", Icon: "😠"},
+	{Code: "spam", Label: "rate_tag_spam", Icon: "📢"},
+	{Code: "inappropriate", Label: "rate_tag_inappropriate", Icon: "🔞"},
+}
+
+// ValidRatingTag mengecek tag sesuai arah rating ("" = tanpa tag selalu valid)
+func ValidRatingTag(rating int, tag string) bool {
+	if tag == "" {
+		return true
+	}
+	tags := RatingUpTags
+	if rating == RatingDown {
+		tags = RatingDownTags
+	}
+	for _, t := range tags {
+		if t.Code == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRating menambahkan rating (dan tag opsional) yang diterima user
+func (u *User) AddRating(rating int, tag string) {
+	if rating == RatingUp {
+		u.RatingUp++
+	} else if rating == RatingDown {
+		u.RatingDown++
+	}
+	if tag != "" {
+		if u.RatingTags == nil {
+			u.RatingTags = make(map[string]int)
+		}
+		u.RatingTags[tag]++
+	}
+}
+
+// ReputationScore adalah proporsi 👍 dengan smoothing (user tanpa rating = 0.5)
+func (u *User) ReputationScore() float64 {
+	return float64(u.RatingUp+1) / float64(u.RatingUp+u.RatingDown+2)
+}
+
+// ReputationTier mengelompokkan user berdasarkan reputasinya
+func (u *User) ReputationTier() string {
+	if u.RatingUp+u.RatingDown < MinRatingsForTier {
+		return ReputationNormal
+	}
+	score := u.ReputationScore()
+	switch {
+	case score >= GoodReputationScore:
+		return ReputationGood
+	case score < LowReputationScore:
+		return ReputationLow
+	}
+	return ReputationNormal
+}
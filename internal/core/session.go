@@ -0,0 +1,66 @@
+package core
+
+import "time"
+
+// ChatSession adalah catatan satu percakapan anonim: siapa dengan siapa, berapa lama, dan siapa yang mengakhiri
+type ChatSession struct {
+	ID        int64      `json:"id,omitempty"`
+	UserA     int64      `json:"user_a"`
+	UserB     int64      `json:"user_b"`
+	Mood      string     `json:"mood"` // Topik tempat keduanya bertemu ("reconnect" untuk VIP reconnect)
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"` // nil = masih berlangsung
+	EndedBy   int64      `json:"ended_by"` // 0 = diakhiri sistem
+	MessagesA int        `json:"messages_a"`
+	MessagesB int        `json:"messages_b"`
+	RatingA   int        `json:"rating_a"` // Rating dari UserA untuk UserB (0 = belum menilai)
+	TagA      string     `json:"tag_a"`
+	RatingB   int        `json:"rating_b"` // Rating dari UserB untuk UserA
+	TagB      string     `json:"tag_b"`
+}
+
+// SessionMoodReconnect adalah Mood untuk sesi hasil VIP reconnect
+const SessionMoodReconnect = "reconnect"
+
+// Has mengecek apakah user ikut dalam sesi ini
+func (s *ChatSession) Has(telegramID int64) bool {
+	return s.UserA == telegramID || s.UserB == telegramID
+}
+
+// PartnerOf mengembalikan lawan bicara telegramID di sesi ini
+func (s *ChatSession) PartnerOf(telegramID int64) int64 {
+	if s.UserA == telegramID {
+		return s.UserB
+	}
+	return s.UserA
+}
+
+// IsActive: sesi belum diakhiri
+func (s *ChatSession) IsActive() bool {
+	return s.EndedAt == nil
+}
+
+// Duration adalah lama sesi (sampai sekarang jika masih berlangsung)
+func (s *ChatSession) Duration() time.Duration {
+	if s.EndedAt == nil {
+		return time.Since(s.StartedAt)
+	}
+	return s.EndedAt.Sub(s.StartedAt)
+}
+
+// CountMessage menambah jumlah pesan yang dikirim telegramID
+func (s *ChatSession) CountMessage(telegramID int64) {
+	if s.UserA == telegramID {
+		s.MessagesA++
+	} else if s.UserB == telegramID {
+		s.MessagesB++
+	}
+}
+
+// HasRated mengecek apakah telegramID sudah menilai partnernya di sesi ini
+func (s *ChatSession) HasRated(telegramID int64) bool {
+	if s.UserA == telegramID {
+		return s.RatingA != 0
+	}
+	return s.RatingB != 0
+}
@@ -15,11 +15,26 @@ type User struct {
 	PartnerID     int64     `json:"partner_id,omitempty"`
 	IsVIP         bool      `json:"is_vip"`
 	IsBanned      bool      `json:"is_banned"`
-	Location      string    `json:"location"`       
+	Location      string    `json:"location"`       // Kode negara ISO ("ID"), "GLOBAL", atau kosong
+	City          string    `json:"city"`           // Opsional, kota / provinsi
 	LastMessageID int       `json:"last_message_id"` 
 	VipExpiresAt  *time.Time `json:"vip_expires_at"`  // Pointer biar bisa NULL
 	LastPartnerID int64      `json:"last_partner_id"` // Simpan mantan
 	LastChargeID  string     `json:"last_charge_id"` 
+	BotBlocked    bool       `json:"bot_blocked"` // User memblokir bot / akun dihapus, pesan ke dia pasti gagal
+	RecentPartners []RecentPartner `json:"recent_partners"` // Riwayat partner terakhir (untuk cooldown matchmaker)
+	BlockedUsers   []int64         `json:"blocked_users"`   // Daftar user yang diblokir lewat /block
+	Interests      []string        `json:"interests"`       // Kode tag minat (lihat AvailableInterests)
+	SameLanguageOnly bool          `json:"same_language_only"` // Hanya dipasangkan dengan user berbahasa sama
+	AutoTranslate    bool          `json:"auto_translate"`     // [VIP] Pesan partner diberi terjemahan
+	AllowMedia       bool          `json:"allow_media"`        // Media dari partner langsung ditampilkan tanpa minta persetujuan
+	ProtectContent   *bool         `json:"protect_content"`    // Pesan ke partner tidak bisa di-forward / disimpan; nil = default (aktif untuk VIP)
+	BirthYear        int           `json:"birth_year"`         // 0 = belum diisi
+	AgeMin           int           `json:"age_min"`            // [VIP] Filter umur partner, 0 = tanpa batas
+	AgeMax           int           `json:"age_max"`
+	RatingUp         int           `json:"rating_up"`          // Jumlah 👍 yang diterima setelah chat
+	RatingDown       int           `json:"rating_down"`        // Jumlah 👎
+	RatingTags       map[string]int `json:"rating_tags"`       // Jumlah per tag rating (mis. "rude": 2)
 	CreatedAt     time.Time `json:"created_at,omitempty"`
 }
 
@@ -30,4 +45,118 @@ type InboxMessage struct {
 	Message    string    `json:"message"`
 	CreatedAt  time.Time `json:"created_at,omitempty"` // <--- PERUBAHAN: Tambah ,omitempty
 	IsRead     bool      `json:"is_read"`
-}
\ No newline at end of file
+}
+
+// RecentPartner adalah satu entri riwayat partner
+type RecentPartner struct {
+	TelegramID int64     `json:"telegram_id"`
+	EndedAt    time.Time `json:"ended_at"`
+}
+
+// ProtectsContent: apakah pesan yang diteruskan dari user ini diproteksi dari forward & simpan
+func (u *User) ProtectsContent() bool {
+	if u.ProtectContent != nil {
+		return *u.ProtectContent
+	}
+	return u.IsVIP
+}
+
+// Batas panjang riwayat agar data user tidak membengkak
+const (
+	MaxRecentPartners = 20
+	MaxBlockedUsers   = 200
+	MaxInterests      = 5
+)
+
+// RememberPartner mencatat partner yang baru selesai chat (LastPartnerID + riwayat untuk cooldown)
+func (u *User) RememberPartner(partnerID int64) {
+	if partnerID == 0 {
+		return
+	}
+	u.LastPartnerID = partnerID
+
+	history := []RecentPartner{{TelegramID: partnerID, EndedAt: time.Now()}}
+	for _, p := range u.RecentPartners {
+		if p.TelegramID != partnerID && len(history) < MaxRecentPartners {
+			history = append(history, p)
+		}
+	}
+	u.RecentPartners = history
+}
+
+// RecentlyChattedWith mengecek apakah user pernah chat dengan partnerID dalam rentang cooldown
+func (u *User) RecentlyChattedWith(partnerID int64, cooldown time.Duration) bool {
+	for _, p := range u.RecentPartners {
+		if p.TelegramID == partnerID {
+			return time.Since(p.EndedAt) < cooldown
+		}
+	}
+	return false
+}
+
+// Block menambahkan targetID ke daftar blokir. Return false jika sudah ada.
+func (u *User) Block(targetID int64) bool {
+	if targetID == 0 || targetID == u.TelegramID || u.HasBlocked(targetID) {
+		return false
+	}
+	u.BlockedUsers = append(u.BlockedUsers, targetID)
+	// Buang yang paling lama jika sudah penuh
+	if len(u.BlockedUsers) > MaxBlockedUsers {
+		u.BlockedUsers = u.BlockedUsers[len(u.BlockedUsers)-MaxBlockedUsers:]
+	}
+	return true
+}
+
+// HasBlocked mengecek apakah targetID ada di daftar blokir user
+func (u *User) HasBlocked(targetID int64) bool {
+	for _, id := range u.BlockedUsers {
+		if id == targetID {
+			return true
+		}
+	}
+	return false
+}
+
+// HasInterest mengecek apakah user memilih tag minat ini
+func (u *User) HasInterest(code string) bool {
+	for _, i := range u.Interests {
+		if i == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ToggleInterest menambah / menghapus tag minat. Return false jika tag ditolak (tidak dikenal atau sudah penuh).
+func (u *User) ToggleInterest(code string) bool {
+	for idx, i := range u.Interests {
+		if i == code {
+			u.Interests = append(u.Interests[:idx:idx], u.Interests[idx+1:]...)
+			return true
+		}
+	}
+
+	known := false
+	for _, opt := range AvailableInterests {
+		if opt.Code == code {
+			known = true
+			break
+		}
+	}
+	if !known || len(u.Interests) >= MaxInterests {
+		return false
+	}
+	u.Interests = append(u.Interests, code)
+	return true
+}
+
+// SharedInterests menghitung jumlah tag minat yang sama dengan other
+func (u *User) SharedInterests(other *User) int {
+	shared := 0
+	for _, i := range u.Interests {
+		if other.HasInterest(i) {
+			shared++
+		}
+	}
+	return shared
+}
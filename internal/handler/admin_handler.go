@@ -1,9 +1,11 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"otterchatbot/config"
 	"otterchatbot/internal/repository"
+	"otterchatbot/internal/service"
 	"otterchatbot/pkg/telegram"
 	"strconv"
 	"strings"
@@ -12,11 +14,13 @@ import (
 
 type AdminHandler struct {
 	Bot      *telegram.Client
-	UserRepo *repository.UserRepository
+	UserRepo repository.UserStore
 	Config   *config.Config
+	// Opsional: jika diisi, /stats ikut menampilkan kondisi antrian update
+	Dispatcher *service.UpdateDispatcher
 }
 
-func NewAdminHandler(bot *telegram.Client, userRepo *repository.UserRepository, cfg *config.Config) *AdminHandler {
+func NewAdminHandler(bot *telegram.Client, userRepo repository.UserStore, cfg *config.Config) *AdminHandler {
 	return &AdminHandler{
 		Bot:      bot,
 		UserRepo: userRepo,
@@ -36,23 +40,25 @@ func (h *AdminHandler) IsAdmin(userID int64) bool {
 }
 
 // HandleCommand memproses perintah admin
-func (h *AdminHandler) HandleCommand(msg *telegram.Message) {
+func (h *AdminHandler) HandleCommand(ctx context.Context, msg *telegram.Message) {
 	args := strings.Split(msg.Text, " ")
 	command := args[0]
 
 	switch command {
 	case "/stats":
-		h.handleStats(msg.Chat.ID)
+		h.handleStats(ctx, msg.Chat.ID)
 	case "/broadcast":
-		h.handleBroadcast(msg.Chat.ID, args)
+		h.handleBroadcast(ctx, msg.Chat.ID, args)
 	case "/addvip":
-		h.handleAddVIP(msg.Chat.ID, args)
+		h.handleAddVIP(ctx, msg.Chat.ID, args)
+	case "/migratelocations":
+		h.handleMigrateLocations(ctx, msg.Chat.ID)
 	}
 }
 
-func (h *AdminHandler) handleStats(chatID int64) {
-	totalUsers, _ := h.UserRepo.CountAll()
-	chatting, queue, vips := h.UserRepo.GetLiveStats()
+func (h *AdminHandler) handleStats(ctx context.Context, chatID int64) {
+	totalUsers, _ := h.UserRepo.CountAll(ctx)
+	chatting, queue, vips := h.UserRepo.GetLiveStats(ctx)
 
 	text := fmt.Sprintf(
 		"📊 **REAL-TIME STATS**\n\n"+
@@ -62,12 +68,24 @@ func (h *AdminHandler) handleStats(chatID int64) {
 			"🌟 Total VIP: %d",
 		totalUsers, chatting/2, queue, vips,
 	)
-	_, _ = h.Bot.SendMessage(chatID, text)
+
+	if h.Dispatcher != nil {
+		ds := h.Dispatcher.Stats()
+		text += fmt.Sprintf(
+			"\n\n📥 **UPDATE QUEUE**\n"+
+				"⚙️ Workers: %d (cap %d/worker)\n"+
+				"📦 Queued: %d (max %d in one worker)\n"+
+				"✅ Processed: %d / %d\n"+
+				"🐢 Backpressure hits: %d",
+			ds.Workers, ds.QueueSize, ds.TotalQueued, ds.MaxDepth, ds.Processed, ds.Dispatched, ds.Throttled,
+		)
+	}
+	_, _ = h.Bot.SendMessage(ctx, chatID, text)
 }
 
-func (h *AdminHandler) handleBroadcast(chatID int64, args []string) {
+func (h *AdminHandler) handleBroadcast(ctx context.Context, chatID int64, args []string) {
 	if len(args) < 2 {
-		_, _ = h.Bot.SendMessage(chatID, "⚠️ Usage: `/broadcast [message]`")
+		_, _ = h.Bot.SendMessage(ctx, chatID, "⚠️ Usage: `/broadcast [message]`")
 		return
 	}
 
@@ -76,42 +94,65 @@ func (h *AdminHandler) handleBroadcast(chatID int64, args []string) {
 	
 	// Jalankan di Goroutine (Background) agar bot tidak macet
 	go func() {
-		ids, err := h.UserRepo.GetAllTelegramIDs()
+		// User yang sudah diketahui memblokir bot tidak dikirimi lagi
+		ids, err := h.UserRepo.GetReachableTelegramIDs(ctx)
 		if err != nil {
-			_, _ = h.Bot.SendMessage(chatID, "❌ Error fetching users.")
+			_, _ = h.Bot.SendMessage(ctx, chatID, "❌ Error fetching users.")
 			return
 		}
 
-		_, _ = h.Bot.SendMessage(chatID, fmt.Sprintf("🚀 Broadcasting to %d users...", len(ids)))
+		_, _ = h.Bot.SendMessage(ctx, chatID, fmt.Sprintf("🚀 Broadcasting to %d users...", len(ids)))
 		
 		success := 0
 		fail := 0
+		blocked := 0
 
 		for _, id := range ids {
 			// Skip kirim ke admin sendiri (opsional)
 			if id == chatID { continue }
 
 			// FIX: Menangkap 2 return value (msgID, error)
-			_, err := h.Bot.SendMessage(id, "📢 <b>ANNOUNCEMENT</b>\n\n"+message)
+			_, err := h.Bot.SendMessage(ctx, id, "📢 <b>ANNOUNCEMENT</b>\n\n"+message)
 			if err == nil {
 				success++
+			} else if service.MarkUnreachable(ctx, h.UserRepo, id, err) {
+				blocked++
 			} else {
 				fail++
 			}
-			
-			// Sleep 35ms agar tidak kena limit Telegram (30 pesan/detik)
-			time.Sleep(35 * time.Millisecond)
+			// Tidak perlu jeda manual: Client sudah membatasi 30 pesan/detik & mengulang jika kena 429
+		}
+
+		report := fmt.Sprintf("✅ **Broadcast Done!**\nSuccess: %d\nFailed: %d\nBlocked bot: %d", success, fail, blocked)
+		_, _ = h.Bot.SendMessage(ctx, chatID, report)
+	}()
+}
+
+// handleMigrateLocations mengubah semua lokasi format lama ("🇮🇩 Indonesia") menjadi kode negara.
+// Repository sudah memigrasikan user saat dibaca, jadi cukup membaca semua user sekali.
+func (h *AdminHandler) handleMigrateLocations(ctx context.Context, chatID int64) {
+	go func() {
+		ids, err := h.UserRepo.GetAllTelegramIDs(ctx)
+		if err != nil {
+			_, _ = h.Bot.SendMessage(ctx, chatID, "❌ Error fetching users.")
+			return
+		}
+
+		checked := 0
+		for _, id := range ids {
+			if user, err := h.UserRepo.GetByTelegramID(ctx, id); err == nil && user != nil {
+				checked++
+			}
 		}
 
-		report := fmt.Sprintf("✅ **Broadcast Done!**\nSuccess: %d\nFailed: %d", success, fail)
-		_, _ = h.Bot.SendMessage(chatID, report)
+		_, _ = h.Bot.SendMessage(ctx, chatID, fmt.Sprintf("✅ **Location Migration Done!**\nChecked: %d users", checked))
 	}()
 }
 
-func (h *AdminHandler) handleAddVIP(chatID int64, args []string) {
+func (h *AdminHandler) handleAddVIP(ctx context.Context, chatID int64, args []string) {
 	// Format: /addvip 12345678 30
 	if len(args) < 3 {
-		_, _ = h.Bot.SendMessage(chatID, "⚠️ Usage: `/addvip [user_id] [days]`")
+		_, _ = h.Bot.SendMessage(ctx, chatID, "⚠️ Usage: `/addvip [user_id] [days]`")
 		return
 	}
 
@@ -120,20 +161,20 @@ func (h *AdminHandler) handleAddVIP(chatID int64, args []string) {
 
 	targetID, err := strconv.ParseInt(targetIDStr, 10, 64)
 	if err != nil {
-		_, _ = h.Bot.SendMessage(chatID, "❌ Invalid User ID.")
+		_, _ = h.Bot.SendMessage(ctx, chatID, "❌ Invalid User ID.")
 		return
 	}
 
 	days, err := strconv.Atoi(daysStr)
 	if err != nil {
-		_, _ = h.Bot.SendMessage(chatID, "❌ Invalid duration.")
+		_, _ = h.Bot.SendMessage(ctx, chatID, "❌ Invalid duration.")
 		return
 	}
 
 	// Ambil user
-	user, err := h.UserRepo.GetByTelegramID(targetID)
+	user, err := h.UserRepo.GetByTelegramID(ctx, targetID)
 	if err != nil || user == nil {
-		_, _ = h.Bot.SendMessage(chatID, "❌ User not found in database.")
+		_, _ = h.Bot.SendMessage(ctx, chatID, "❌ User not found in database.")
 		return
 	}
 
@@ -144,16 +185,16 @@ func (h *AdminHandler) handleAddVIP(chatID int64, args []string) {
 	user.IsVIP = true
 	user.VipExpiresAt = &expiry
 	
-	err = h.UserRepo.Update(user)
+	err = h.UserRepo.Update(ctx, user)
 	if err != nil {
-		_, _ = h.Bot.SendMessage(chatID, "❌ Database update failed.")
+		_, _ = h.Bot.SendMessage(ctx, chatID, "❌ Database update failed.")
 		return
 	}
 
 	// Konfirmasi ke Admin
-	_, _ = h.Bot.SendMessage(chatID, fmt.Sprintf("✅ VIP added to %s for %d days.", user.FirstName, days))
+	_, _ = h.Bot.SendMessage(ctx, chatID, fmt.Sprintf("✅ VIP added to %s for %d days.", user.FirstName, days))
 
 	// Notifikasi ke User
 	msgUser := fmt.Sprintf("🌟 <b>CONGRATULATIONS!</b>\n\nYour account is now <b>VIP</b> for %d days!\nEnjoy exclusive features.", days)
-	_, _ = h.Bot.SendMessage(targetID, msgUser)
+	_, _ = h.Bot.SendMessage(ctx, targetID, msgUser)
 }
\ No newline at end of file
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"otterchatbot/config"
@@ -9,8 +11,11 @@ import (
 	"otterchatbot/internal/service" 
 	"otterchatbot/pkg/i18n"
 	"otterchatbot/pkg/telegram"
+	"otterchatbot/pkg/translate"
 	"strings"
 	"strconv"
+	"time"
+	"unicode/utf16"
 )
 
 // Gunakan URL yang pasti berakhiran .png/.jpg dan dapat diakses publik
@@ -18,18 +23,25 @@ const WelcomeImageURL = "https://upload.wikimedia.org/wikipedia/commons/thumb/8/
 
 type BotHandler struct {
 	Bot      *telegram.Client
-	UserRepo *repository.UserRepository
+	UserRepo repository.UserStore
 	I18n     *i18n.I18nService
 	Admin    *AdminHandler
 	Payment  *PaymentHandler
 	Game     *service.GameService
 	Report   *ReportHandler
 	AFK      *service.AFKService // [PEMBARUAN 1] Tambah Service AFK
+	Matchmaker *service.MatchmakerService
+	Sessions *service.ChatSessionService
 	Inbox    *InboxHandler // <--- TAMBAHAN
+	// Aturan per jenis media yang diteruskan di chat
+	MediaPolicy core.MediaPolicy
+	// Batas waktu /unsend (0 = tanpa batas)
+	UnsendWindow time.Duration
+	// Opsional: penerjemah untuk VIP auto-translate (nil = fitur dimatikan)
+	Translator translate.Translator
 }
 
-func NewBotHandler(bot *telegram.Client, userRepo *repository.UserRepository, i18n *i18n.I18nService, cfg *config.Config, gameService *service.GameService, afkService *service.AFKService) *BotHandler {
-	inboxRepo := repository.NewInboxRepository(userRepo.DB)
+func NewBotHandler(bot *telegram.Client, userRepo repository.UserStore, inboxRepo repository.InboxStore, i18n *i18n.I18nService, cfg *config.Config, gameService *service.GameService, afkService *service.AFKService, matchmaker *service.MatchmakerService, sessions *service.ChatSessionService) *BotHandler {
 	return &BotHandler{
 		Bot:      bot,
 		UserRepo: userRepo,
@@ -40,41 +52,51 @@ func NewBotHandler(bot *telegram.Client, userRepo *repository.UserRepository, i1
 		Game:     gameService,
 		Report:   NewReportHandler(bot, userRepo, cfg, i18n),
 		AFK:      afkService,
+		Matchmaker: matchmaker,
+		Sessions:   sessions,
 		Inbox:    NewInboxHandler(bot, inboxRepo, userRepo, i18n),
+		MediaPolicy: cfg.MediaPolicy,
+		UnsendWindow: cfg.UnsendWindow,
 		}
 }
 
-func (h *BotHandler) HandleUpdate(update telegram.Update) {
+func (h *BotHandler) HandleUpdate(ctx context.Context, update telegram.Update) {
 	// 1. Tangani Pembayaran (Prioritas)
 
 	if update.InlineQuery != nil {
-		h.Inbox.HandleInlineQuery(update.InlineQuery)
+		h.Inbox.HandleInlineQuery(ctx, update.InlineQuery)
 		return
 	}
 
 	if update.PreCheckoutQuery != nil {
-		h.Payment.HandlePreCheckout(update.PreCheckoutQuery)
+		h.Payment.HandlePreCheckout(ctx, update.PreCheckoutQuery)
 		return
 	}
 
 	if update.Message != nil && update.Message.SuccessfulPayment != nil {
-		h.Payment.HandleSuccessfulPayment(update.Message)
+		h.Payment.HandleSuccessfulPayment(ctx, update.Message)
 		return
 	}
 
 	// 2. Tangani Callback
 	if update.CallbackQuery != nil {
-		h.handleCallback(update.CallbackQuery)
+		h.handleCallback(ctx, update.CallbackQuery)
+		return
+	}
+
+	// Pesan yang diedit diteruskan ke salinannya di chat partner
+	if update.EditedMessage != nil {
+		h.handleEditedMessage(ctx, update.EditedMessage)
 		return
 	}
 
 	// 3. Tangani Pesan Teks
 	if update.Message != nil {
-		h.handleMessage(update.Message)
+		h.handleMessage(ctx, update.Message)
 	}
 }
 
-func (h *BotHandler) handleMessage(msg *telegram.Message) {
+func (h *BotHandler) handleMessage(ctx context.Context, msg *telegram.Message) {
 	telegramID := msg.From.ID
 	chatID := msg.Chat.ID
 
@@ -82,32 +104,38 @@ func (h *BotHandler) handleMessage(msg *telegram.Message) {
 	if strings.HasPrefix(msg.Text, "/") && h.Admin.IsAdmin(telegramID) {
 		cmd := strings.Split(msg.Text, " ")[0]
 		if cmd == "/stats" || cmd == "/broadcast" || cmd == "/addvip" {
-			h.Admin.HandleCommand(msg)
+			h.Admin.HandleCommand(ctx, msg)
 			return 
 		}
 	}
 	
-	user, err := h.UserRepo.GetByTelegramID(telegramID)
+	user, err := h.UserRepo.GetByTelegramID(ctx, telegramID)
 	if err != nil { return }
 
 	if user == nil {
 		// Jika user baru klik link secret message
 		if strings.HasPrefix(msg.Text, "/start secret_") {
-			h.startOnboarding(msg) // Buat user dulu
+			h.startOnboarding(ctx, msg) // Buat user dulu
 			// Ambil ulang user yang baru dibuat
-			user, _ = h.UserRepo.GetByTelegramID(telegramID)
+			user, _ = h.UserRepo.GetByTelegramID(ctx, telegramID)
 			// Lanjut ke logic deep link di bawah
 		} else {
-			h.startOnboarding(msg)
+			h.startOnboarding(ctx, msg)
 			return
 		}
 	}
 
 	if user.IsBanned {
-		_, _ = h.Bot.SendMessage(telegramID, "⛔ <b>Account Banned.</b>")
+		_, _ = h.Bot.SendMessage(ctx, telegramID, "⛔ <b>Account Banned.</b>")
 		return
 	}
 
+	// User yang sebelumnya memblokir bot kini menghubungi bot lagi, berarti sudah aktif kembali
+	if user.BotBlocked {
+		user.BotBlocked = false
+		_ = h.UserRepo.Update(ctx, user)
+	}
+
 	// --- HANDLE DEEP LINK (Secret Message Mode) ---
 	if strings.HasPrefix(msg.Text, "/start secret_") {
 		// Format: /start secret_123456
@@ -116,7 +144,7 @@ func (h *BotHandler) handleMessage(msg *telegram.Message) {
 
 		if targetID == telegramID {
 			// [PERBARUAN] Ambil teks dari locales
-			h.Bot.SendMessage(chatID, h.I18n.Get(user.LanguageCode, "secret_error_self"))
+			h.Bot.SendMessage(ctx, chatID, h.I18n.Get(user.LanguageCode, "secret_error_self"))
 			return
 		}
 
@@ -135,36 +163,41 @@ func (h *BotHandler) handleMessage(msg *telegram.Message) {
 				},
 			}
 			
-			h.Bot.SendMessageWithMarkup(chatID, confirmText, keyboard)
+			h.Bot.SendMessageWithMarkup(ctx, chatID, confirmText, keyboard)
 			return
 		}
 
-		user.Status = "secret_mode" 
+		if !h.setStatus(ctx, user, "secret_mode") {
+			h.Bot.SendMessage(ctx, chatID, "❌ System Error.")
+			return
+		}
 		user.LastPartnerID = targetID 
 		
-		err := h.UserRepo.Update(user)
+		err := h.UserRepo.Update(ctx, user)
 		if err != nil {
-			h.Bot.SendMessage(chatID, "❌ System Error.")
+			h.Bot.SendMessage(ctx, chatID, "❌ System Error.")
 			return
 		}
 
-		h.Bot.SendMessage(chatID, h.I18n.Get(user.LanguageCode, "secret_mode_start"))
+		h.Bot.SendMessage(ctx, chatID, h.I18n.Get(user.LanguageCode, "secret_mode_start"))
 		return
 	}
 
 	// --- HANDLE CANCEL ---
 	if msg.Text == "/cancel" && user.Status == "secret_mode" {
-		user.Status = "idle"
+		if !h.setStatus(ctx, user, "idle") {
+			return
+		}
 		user.LastPartnerID = 0
-		h.UserRepo.Update(user)
-		h.Bot.SendMessage(chatID, h.I18n.Get(user.LanguageCode, "secret_cancelled"))
-		h.sendMainMenu(chatID, user, false, 0)
+		h.UserRepo.Update(ctx, user)
+		h.Bot.SendMessage(ctx, chatID, h.I18n.Get(user.LanguageCode, "secret_cancelled"))
+		h.sendMainMenu(ctx, chatID, user, false, 0)
 		return
 	}
 
 	// --- HANDLE INBOX ---
 	if msg.Text == "/inbox" {
-		h.Inbox.ShowInbox(user)
+		h.Inbox.ShowInbox(ctx, user)
 		return
 	}
 
@@ -172,111 +205,127 @@ func (h *BotHandler) handleMessage(msg *telegram.Message) {
 	if user.Status == "secret_mode" {
 		// Pastikan teks
 		if msg.Text == "" {
-			h.Bot.SendMessage(chatID, h.I18n.Get(user.LanguageCode, "secret_error_txt_only"))
+			h.Bot.SendMessage(ctx, chatID, h.I18n.Get(user.LanguageCode, "secret_error_txt_only"))
 			
 			return
 		}
-		h.Inbox.HandleIncomingSecretMessage(user, msg.Text)
+		h.Inbox.HandleIncomingSecretMessage(ctx, user, msg.Text)
 		return
 	}
 
 	if (user.Gender == "" || user.Preference == "") && user.Status != "awaiting_location" {
-		if user.LastMessageID != 0 { _ = h.Bot.DeleteMessage(chatID, user.LastMessageID) }
+		if user.LastMessageID != 0 { _ = h.Bot.DeleteMessage(ctx, chatID, user.LastMessageID) }
 		
 		// FIX: Ambil teks dari i18n JSON
 		warningMsg := h.I18n.Get(user.LanguageCode, "profile_incomplete")
-		_, _ = h.Bot.SendMessage(chatID, warningMsg)
+		_, _ = h.Bot.SendMessage(ctx, chatID, warningMsg)
 		
-		h.sendGenderSelector(chatID, user.LanguageCode, false, 0)
+		h.sendGenderSelector(ctx, chatID, user.LanguageCode, false, 0)
 		return
 	}
 	// -----------------------------------------------------
 
 	if msg.Text == "/stop" {
-		h.stopChat(user)
+		h.stopChat(ctx, user)
 		return
 	}
 
 	if msg.Text == "/next" {
-		h.handleNext(user)
+		h.handleNext(ctx, user)
 		return
 	}
 
 	if msg.Text == "/report" {
-		h.Report.HandleReportCommand(user)
+		h.Report.HandleReportCommand(ctx, user)
+		return
+	}
+
+	if msg.Text == "/block" {
+		h.handleBlock(ctx, user)
 		return
 	}
 
 	if msg.Text == "/share" {
-		h.handleRevealRequest(user)
+		h.handleRevealRequest(ctx, user)
+		return
+	}
+
+	if msg.Text == "/unsend" {
+		h.handleUnsend(ctx, user, msg)
+		return
+	}
+
+	if msg.Text == "/media" {
+		h.handleMediaCommand(ctx, user)
 		return
 	}
 
 	if msg.Text == "/reconnect" {
-		h.handleReconnect(user)
+		h.handleReconnect(ctx, user)
 		return
 	}
 
 	if msg.Text == "/game" {
 		if user.Status == "chatting" && user.PartnerID != 0 {
-			h.sendGamePanel(user)
+			h.sendGamePanel(ctx, user)
 		} else {
 			// Jika iseng ketik /game pas lagi jomblo/idle
-			_, _ = h.Bot.SendMessage(chatID, "⚠️ <b>Error:</b> You are not in a chat session.")
+			_, _ = h.Bot.SendMessage(ctx, chatID, "⚠️ <b>Error:</b> You are not in a chat session.")
 		}
 		return
 	}
 
-	if user.Status == "awaiting_location" {
-		user.Location = msg.Text
-		user.Status = "idle"
-		_ = h.UserRepo.Update(user)
-		
-		confirmMsg := fmt.Sprintf(h.I18n.Get(user.LanguageCode, "location_saved"), user.Location)
-		_, _ = h.Bot.SendMessage(chatID, confirmMsg)
-		h.sendUserProfile(chatID, user, false)
+	// Tahun lahir: langkah terakhir onboarding, atau diisi dari profil
+	if user.Status == "awaiting_birth_year" || (user.Status == "onboarding" && user.BirthYear == 0) {
+		h.handleBirthYearInput(ctx, user, msg)
+		return
+	}
+
+	// Lokasi yang dibagikan di luar chat (atau jawaban prompt lokasi/kota) mengatur lokasi profil
+	if user.Status == "awaiting_location" || (msg.Location != nil && user.Status != "chatting") {
+		h.handleLocationInput(ctx, user, msg)
 		return
 	}
 
 	if user.Status == "chatting" {
-		h.relayMessage(user, msg)
+		h.relayMessage(ctx, user, msg)
 		return
 	}
 
 	// Bersihkan pesan lama saat command diketik
 	if strings.HasPrefix(msg.Text, "/") && user.LastMessageID != 0 {
-		_ = h.Bot.DeleteMessage(chatID, user.LastMessageID)
+		_ = h.Bot.DeleteMessage(ctx, chatID, user.LastMessageID)
 	}
 
 	switch msg.Text {
 	case "/start":
-		h.sendMainMenu(chatID, user, false, 0)
+		h.sendMainMenu(ctx, chatID, user, false, 0)
 		
 	case "/profile":
-		h.sendUserProfile(chatID, user, false)
+		h.sendUserProfile(ctx, chatID, user, false)
 
 	case "/game": // Pembaruan 3: Menangani perintah game
-		h.sendGamePanel(user)
+		h.sendGamePanel(ctx, user)
 
 	case "/vip":
-		h.sendVipInfo(chatID, user.LanguageCode, false, 0)
+		h.sendVipInfo(ctx, chatID, user.LanguageCode, false, 0)
 
 	case "/search":
-		h.cleanStatus(user)
-		h.sendMoodSelector(chatID, user.LanguageCode, false, 0)
+		h.cleanStatus(ctx, user)
+		h.sendMoodSelector(ctx, chatID, user.LanguageCode, false, 0)
 
 	case "/lang":
-		h.sendLangSelector(chatID, user.LanguageCode, false, 0, "profile")
+		h.sendLangSelector(ctx, chatID, user.LanguageCode, false, 0, "profile")
 
 	case "/help":
-		h.sendHelpMenu(chatID, user.LanguageCode, false, 0)
+		h.sendHelpMenu(ctx, chatID, user.LanguageCode, false, 0)
 
 
 	default:
 		if user.Status == "queue" {
-			_, _ = h.Bot.SendMessage(chatID, "Still searching... Type /stop to cancel.")
+			_, _ = h.Bot.SendMessage(ctx, chatID, "Still searching... Type /stop to cancel.")
 		} else {
-			h.sendMainMenu(chatID, user, false, 0)
+			h.sendMainMenu(ctx, chatID, user, false, 0)
 		}
 	}
 }
@@ -288,49 +337,136 @@ func escapeHTML(text string) string {
 	return text
 }
 
-func (h *BotHandler) handleReconnect(user *core.User) {
+// sendRatingPrompt meminta user menilai partnernya setelah sesi berakhir
+func (h *BotHandler) sendRatingPrompt(ctx context.Context, user *core.User, session *core.ChatSession) {
+	if session == nil {
+		return
+	}
+	id := strconv.FormatInt(session.ID, 10)
+	keyboard := telegram.InlineKeyboardMarkup{
+		InlineKeyboard: [][]telegram.InlineKeyboardButton{
+			{
+				{Text: "👍", CallbackData: "rate:" + id + ":up"},
+				{Text: "👎", CallbackData: "rate:" + id + ":down"},
+			},
+		},
+	}
+	_, _ = h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
+		ChatID: user.TelegramID, Text: h.I18n.Get(user.LanguageCode, "rate_prompt"), ReplyMarkup: keyboard, ParseMode: "HTML",
+	})
+}
+
+// handleRating memproses tombol rating: "rate:ID:up" menampilkan pilihan tag,
+// "rate:ID:up:TAG" (atau "-" untuk tanpa tag) menyimpan rating ke sesi & reputasi partner
+func (h *BotHandler) handleRating(ctx context.Context, user *core.User, data string, msgID int) {
+	lang := user.LanguageCode
+	parts := strings.Split(data, ":")
+	if len(parts) < 3 {
+		return
+	}
+	sessionID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return
+	}
+
+	rating, tags := core.RatingUp, core.RatingUpTags
+	if parts[2] == "down" {
+		rating, tags = core.RatingDown, core.RatingDownTags
+	}
+
+	if len(parts) == 3 {
+		// Langkah 2: tag opsional
+		var rows [][]telegram.InlineKeyboardButton
+		for _, t := range tags {
+			rows = append(rows, []telegram.InlineKeyboardButton{
+				{Text: t.Icon + " " + h.I18n.Get(lang, t.Label), CallbackData: data + ":" + t.Code},
+			})
+		}
+		rows = append(rows, []telegram.InlineKeyboardButton{{Text: h.I18n.Get(lang, "btn_rate_skip"), CallbackData: data + ":-"}})
+		_ = h.Bot.EditMessageText(ctx, user.TelegramID, msgID, h.I18n.Get(lang, "rate_ask_tag"), telegram.InlineKeyboardMarkup{InlineKeyboard: rows})
+		return
+	}
+
+	tag := parts[3]
+	if tag == "-" {
+		tag = ""
+	}
+	if !core.ValidRatingTag(rating, tag) {
+		return
+	}
+
+	session, err := h.Sessions.Rate(ctx, sessionID, user.TelegramID, rating, tag)
+	if err != nil {
+		log.Printf("Failed to save rating from %d for session %d: %v", user.TelegramID, sessionID, err)
+		return
+	}
+	if session == nil {
+		_ = h.Bot.EditMessageText(ctx, user.TelegramID, msgID, h.I18n.Get(lang, "rate_already"), nil)
+		return
+	}
+
+	// Reputasi partner diperbarui langsung di database (atomik, tidak menimpa perubahan lain pada partner)
+	if err := h.UserRepo.AddRating(ctx, session.PartnerOf(user.TelegramID), rating, tag); err != nil {
+		log.Printf("Failed to update reputation of %d: %v", session.PartnerOf(user.TelegramID), err)
+	}
+
+	_ = h.Bot.EditMessageText(ctx, user.TelegramID, msgID, h.I18n.Get(lang, "rate_thanks"), nil)
+}
+
+func (h *BotHandler) handleReconnect(ctx context.Context, user *core.User) {
 	// Cek VIP
 	if !user.IsVIP {
-		h.Bot.SendMessage(user.TelegramID, "🔒 <b>VIP Feature</b>\nReconnect is only available for VIP members.")
+		h.Bot.SendMessage(ctx, user.TelegramID, "🔒 <b>VIP Feature</b>\nReconnect is only available for VIP members.")
 		return
 	}
 
 	if user.LastPartnerID == 0 {
-		h.Bot.SendMessage(user.TelegramID, "⚠️ You don't have a previous partner to reconnect with.")
+		h.Bot.SendMessage(ctx, user.TelegramID, "⚠️ You don't have a previous partner to reconnect with.")
+		return
+	}
+
+	if user.Status != "idle" {
+		h.Bot.SendMessage(ctx, user.TelegramID, "⚠️ Stop your current chat or search first, then try /reconnect again.")
 		return
 	}
 
 	// Cek status mantan
-	partner, err := h.UserRepo.GetByTelegramID(user.LastPartnerID)
+	partner, err := h.UserRepo.GetByTelegramID(ctx, user.LastPartnerID)
 	if err != nil || partner == nil {
-		h.Bot.SendMessage(user.TelegramID, "⚠️ Previous partner not found.")
+		h.Bot.SendMessage(ctx, user.TelegramID, "⚠️ Previous partner not found.")
+		return
+	}
+
+	if partner.HasBlocked(user.TelegramID) || user.HasBlocked(partner.TelegramID) {
+		h.Bot.SendMessage(ctx, user.TelegramID, "⚠️ Previous partner is not available.")
 		return
 	}
 
 	if partner.Status != "idle" {
-		h.Bot.SendMessage(user.TelegramID, "⚠️ Previous partner is currently busy (chatting/queueing). Try again later.")
+		h.Bot.SendMessage(ctx, user.TelegramID, "⚠️ Previous partner is currently busy (chatting/queueing). Try again later.")
 		return
 	}
 
-	// EKSEKUSI RECONNECT (Force Match)
-	user.Status = "chatting"
-	user.PartnerID = partner.TelegramID
-	
-	partner.Status = "chatting"
-	partner.PartnerID = user.TelegramID
+	// EKSEKUSI RECONNECT: klaim atomik, keduanya harus masih idle (bisa berubah sejak dibaca di atas)
+	if err := h.UserRepo.ClaimMatch(ctx, user, partner, "idle"); err != nil {
+		if !errors.Is(err, repository.ErrMatchConflict) {
+			log.Printf("Failed to reconnect %d with %d: %v", user.TelegramID, partner.TelegramID, err)
+		}
+		h.Bot.SendMessage(ctx, user.TelegramID, "⚠️ Previous partner is currently busy (chatting/queueing). Try again later.")
+		return
+	}
 
-	_ = h.UserRepo.Update(user)
-	_ = h.UserRepo.Update(partner)
+	h.Sessions.Start(ctx, user.TelegramID, partner.TelegramID, core.SessionMoodReconnect)
 
 	// Hapus pesan menu lama di kedua belah pihak agar bersih
-	if user.LastMessageID != 0 { _ = h.Bot.DeleteMessage(user.TelegramID, user.LastMessageID) }
-	if partner.LastMessageID != 0 { _ = h.Bot.DeleteMessage(partner.TelegramID, partner.LastMessageID) }
+	if user.LastMessageID != 0 { _ = h.Bot.DeleteMessage(ctx, user.TelegramID, user.LastMessageID) }
+	if partner.LastMessageID != 0 { _ = h.Bot.DeleteMessage(ctx, partner.TelegramID, partner.LastMessageID) }
 
-	h.Bot.SendMessage(user.TelegramID, "🔄 <b>Reconnected!</b> You are back with your previous partner.")
-	h.Bot.SendMessage(partner.TelegramID, "🔄 <b>Reconnected!</b> Your previous partner reconnected with you (VIP Feature).")
+	h.Bot.SendMessage(ctx, user.TelegramID, "🔄 <b>Reconnected!</b> You are back with your previous partner.")
+	h.Bot.SendMessage(ctx, partner.TelegramID, "🔄 <b>Reconnected!</b> Your previous partner reconnected with you (VIP Feature).")
 }
 
-func (h *BotHandler) sendVipInfo(chatID int64, lang string, isEdit bool, msgID int) {
+func (h *BotHandler) sendVipInfo(ctx context.Context, chatID int64, lang string, isEdit bool, msgID int) {
 	text := h.I18n.Get(lang, "vip_info")
 	
 	var rows [][]telegram.InlineKeyboardButton
@@ -360,11 +496,11 @@ func (h *BotHandler) sendVipInfo(chatID int64, lang string, isEdit bool, msgID i
 	})
 
 	keyboard := telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
-	h.sendOrEdit(chatID, text, keyboard, isEdit, msgID)
+	h.sendOrEdit(ctx, chatID, text, keyboard, isEdit, msgID)
 }
 
 // --- FUNGSI BARU: MENAMPILKAN MENU HELP INTERAKTIF ---
-func (h *BotHandler) sendHelpMenu(chatID int64, lang string, isEdit bool, msgID int) {
+func (h *BotHandler) sendHelpMenu(ctx context.Context, chatID int64, lang string, isEdit bool, msgID int) {
 	text := h.I18n.Get(lang, "help_menu")
 	
 	keyboard := telegram.InlineKeyboardMarkup{
@@ -381,19 +517,76 @@ func (h *BotHandler) sendHelpMenu(chatID int64, lang string, isEdit bool, msgID
 			},
 		},
 	}
-	h.sendOrEdit(chatID, text, keyboard, isEdit, msgID)
+	h.sendOrEdit(ctx, chatID, text, keyboard, isEdit, msgID)
+}
+
+func (h *BotHandler) cleanStatus(ctx context.Context, user *core.User) {
+	if user.Status != "queue" {
+		return
+	}
+	h.Matchmaker.Remove(user.TelegramID)
+	if !h.setStatus(ctx, user, "idle") {
+		// Baru saja dapat partner, biarkan tetap chatting
+		if fresh, _ := h.UserRepo.GetByTelegramID(ctx, user.TelegramID); fresh != nil {
+			*user = *fresh
+		}
+	}
 }
 
-func (h *BotHandler) cleanStatus(user *core.User) {
-	if user.Status == "queue" || user.Status == "idle" {
-		user.Status = "idle"
-		user.PartnerID = 0
-		_ = h.UserRepo.Update(user)
+// setStatus memindahkan user dari status yang terakhir dibaca ke `to` (compare-and-swap).
+// Return false jika status di database sudah berubah duluan (mis. baru dapat partner); user tidak diubah.
+// Bukan untuk keluar dari "chatting", pakai releaseChat.
+func (h *BotHandler) setStatus(ctx context.Context, user *core.User, to string) bool {
+	ok, err := h.UserRepo.SetStatusIf(ctx, user.TelegramID, user.Status, to)
+	if err != nil {
+		log.Printf("Failed to change status of %d from %s to %s: %v", user.TelegramID, user.Status, to, err)
+		return false
+	}
+	if !ok {
+		return false
 	}
+	user.Status = to
+	user.PartnerID = 0
+	return true
+}
+
+// releaseChat mengeluarkan user dari chat dengan partnernya saat ini ke status `to` (compare-and-swap).
+// Return false jika chat sudah berakhir / berganti partner lewat jalur lain; user diisi ulang dengan data terbaru.
+func (h *BotHandler) releaseChat(ctx context.Context, user *core.User, to string) bool {
+	ok, err := h.UserRepo.ReleaseMatch(ctx, user.TelegramID, user.PartnerID, to)
+	if err != nil {
+		log.Printf("Failed to release %d from chat with %d: %v", user.TelegramID, user.PartnerID, err)
+		return false
+	}
+	if !ok {
+		if fresh, _ := h.UserRepo.GetByTelegramID(ctx, user.TelegramID); fresh != nil {
+			*user = *fresh
+		}
+		return false
+	}
+	user.Status = to
+	user.PartnerID = 0
+	return true
+}
+
+// releasePartner melepas partner dari chat dengan user, hanya jika partner masih chatting dengan user.
+// Return data partner terbaru (sudah idle & mengingat user), atau nil jika partner sudah pindah.
+func (h *BotHandler) releasePartner(ctx context.Context, partnerID int64, user *core.User) *core.User {
+	ok, err := h.UserRepo.ReleaseMatch(ctx, partnerID, user.TelegramID, "idle")
+	if err != nil || !ok {
+		return nil
+	}
+	partner, err := h.UserRepo.GetByTelegramID(ctx, partnerID)
+	if err != nil || partner == nil {
+		return nil
+	}
+	partner.RememberPartner(user.TelegramID)
+	_ = h.UserRepo.Update(ctx, partner)
+	return partner
 }
 
 // FIX: Tambahkan parameter isEdit dan msgID
-func (h *BotHandler) sendMainMenu(chatID int64, user *core.User, isEdit bool, msgID int) {
+func (h *BotHandler) sendMainMenu(ctx context.Context, chatID int64, user *core.User, isEdit bool, msgID int) {
 	caption := h.I18n.Get(user.LanguageCode, "welcome_caption")
 
 	btnInbox := h.I18n.Get(user.LanguageCode, "inbox_menu_btn")
@@ -418,20 +611,20 @@ func (h *BotHandler) sendMainMenu(chatID int64, user *core.User, isEdit bool, ms
 		},
 	}
 
-	h.sendOrEdit(chatID, caption, keyboard, isEdit, msgID)
+	h.sendOrEdit(ctx, chatID, caption, keyboard, isEdit, msgID)
 }
 
-func (h *BotHandler) sendInfoMessage(chatID int64, lang string, key string, isEdit bool, msgID int) {
+func (h *BotHandler) sendInfoMessage(ctx context.Context, chatID int64, lang string, key string, isEdit bool, msgID int) {
 	text := h.I18n.Get(lang, key)
 	keyboard := telegram.InlineKeyboardMarkup{
 		InlineKeyboard: [][]telegram.InlineKeyboardButton{
 			{{Text: "🏠 Main Menu", CallbackData: "back:menu"}},
 		},
 	}
-	h.sendOrEdit(chatID, text, keyboard, isEdit, msgID)
+	h.sendOrEdit(ctx, chatID, text, keyboard, isEdit, msgID)
 }
 
-func (h *BotHandler) sendUserProfile(chatID int64, user *core.User, isEdit bool) {
+func (h *BotHandler) sendUserProfile(ctx context.Context, chatID int64, user *core.User, isEdit bool) {
 	viewTemplate := h.I18n.Get(user.LanguageCode, "profile_view")
 	
 	gender := user.Gender
@@ -443,17 +636,24 @@ func (h *BotHandler) sendUserProfile(chatID int64, user *core.User, isEdit bool)
 	if pref == "female" { pref = h.I18n.Get(user.LanguageCode, "btn_female") }
 	if pref == "both" { pref = h.I18n.Get(user.LanguageCode, "btn_both") }
 
-	loc := user.Location
-	if loc == "" || loc == "-" {
+	loc := escapeHTML(core.LocationLabel(user.Location, user.City))
+	if loc == "" {
 		// Jika kosong, tampilkan ini
 		loc = "🌍 Global / Not Set"
 	}
 
+	age := h.I18n.Get(user.LanguageCode, "age_not_set")
+	if bracket, ok := user.AgeBracket(); ok {
+		age = h.I18n.Get(user.LanguageCode, bracket.Label)
+	}
+
+	interests := h.formatInterests(user)
+
 	statusText := "Free"
 	if user.IsVIP { statusText = "🌟 VIP" }
 
 	// FIX: Menggunakan escapeHTML untuk nama user
-	text := fmt.Sprintf(viewTemplate, escapeHTML(user.FirstName), gender, pref, loc, statusText)
+	text := fmt.Sprintf(viewTemplate, escapeHTML(user.FirstName), gender, pref, age, loc, interests, statusText)
 
 	keyboard := telegram.InlineKeyboardMarkup{
 		InlineKeyboard: [][]telegram.InlineKeyboardButton{
@@ -466,81 +666,554 @@ func (h *BotHandler) sendUserProfile(chatID int64, user *core.User, isEdit bool)
 				{Text: h.I18n.Get(user.LanguageCode, "btn_lang"), CallbackData: "edit:lang_from_profile"},
 			},
 			{
-				{Text: "🏠 Main Menu", CallbackData: "back:menu"},
+				{Text: h.I18n.Get(user.LanguageCode, "btn_edit_interests"), CallbackData: "edit:interests"},
+			},
+			{
+				{Text: fmt.Sprintf(h.I18n.Get(user.LanguageCode, "btn_age_range"), h.ageRangeLabel(user)), CallbackData: "edit:agerange"},
+			},
+			{
+				{Text: fmt.Sprintf(h.I18n.Get(user.LanguageCode, "btn_same_lang"), h.onOff(user.LanguageCode, user.SameLanguageOnly)), CallbackData: "toggle:samelang"},
+			},
+			{
+				{Text: fmt.Sprintf(h.I18n.Get(user.LanguageCode, "btn_allow_media"), h.onOff(user.LanguageCode, user.AllowMedia)), CallbackData: "toggle:media"},
+			},
+			{
+				{Text: fmt.Sprintf(h.I18n.Get(user.LanguageCode, "btn_protect_content"), h.onOff(user.LanguageCode, user.ProtectsContent())), CallbackData: "toggle:protect"},
 			},
 		},
 	}
+	if user.BirthYear == 0 {
+		// Tahun lahir hanya bisa diisi sekali supaya batas umur mood dating tidak diakali
+		keyboard.InlineKeyboard[2] = append(keyboard.InlineKeyboard[2], telegram.InlineKeyboardButton{Text: h.I18n.Get(user.LanguageCode, "btn_set_age"), CallbackData: "edit:age"})
+	}
+	if h.Translator != nil {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []telegram.InlineKeyboardButton{
+			{Text: fmt.Sprintf(h.I18n.Get(user.LanguageCode, "btn_auto_translate"), h.onOff(user.LanguageCode, user.AutoTranslate)), CallbackData: "toggle:translate"},
+		})
+	}
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []telegram.InlineKeyboardButton{
+		{Text: "🏠 Main Menu", CallbackData: "back:menu"},
+	})
+
+	h.sendOrEdit(ctx, chatID, text, keyboard, isEdit, user.LastMessageID)
+}
 
-	h.sendOrEdit(chatID, text, keyboard, isEdit, user.LastMessageID)
+// ageRangeLabel menampilkan filter umur partner (VIP) di tombol profil
+func (h *BotHandler) ageRangeLabel(user *core.User) string {
+	for _, b := range core.AgeBrackets {
+		min, max := core.ParseAgeRange(b.Code)
+		if user.AgeMin == min && user.AgeMax == max {
+			return h.I18n.Get(user.LanguageCode, b.Label)
+		}
+	}
+	return h.I18n.Get(user.LanguageCode, "age_range_any")
 }
 
-func (h *BotHandler) relayMessage(sender *core.User, msg *telegram.Message) {
+// onOff menampilkan status sebuah pengaturan di tombol profil
+func (h *BotHandler) onOff(lang string, enabled bool) string {
+	if enabled {
+		return h.I18n.Get(lang, "setting_on")
+	}
+	return h.I18n.Get(lang, "setting_off")
+}
+
+// formatInterests menampilkan tag minat user, mis. "🎵 Music, 🎮 Games"
+func (h *BotHandler) formatInterests(user *core.User) string {
+	var labels []string
+	for _, opt := range core.AvailableInterests {
+		if user.HasInterest(opt.Code) {
+			labels = append(labels, fmt.Sprintf("%s %s", opt.Icon, h.I18n.Get(user.LanguageCode, opt.Label)))
+		}
+	}
+	if len(labels) == 0 {
+		return h.I18n.Get(user.LanguageCode, "interests_none")
+	}
+	return strings.Join(labels, ", ")
+}
+
+func (h *BotHandler) relayMessage(ctx context.Context, sender *core.User, msg *telegram.Message) {
 	if sender.PartnerID == 0 {
-		_, _ = h.Bot.SendMessage(sender.TelegramID, h.I18n.Get(sender.LanguageCode, "partner_lost"))
-		sender.Status = "idle"
-		_ = h.UserRepo.Update(sender)
+		_, _ = h.Bot.SendMessage(ctx, sender.TelegramID, h.I18n.Get(sender.LanguageCode, "partner_lost"))
+		h.releaseChat(ctx, sender, "idle")
 		return
 	}
 
 	h.AFK.Touch(sender.TelegramID)
 	
 	
+	// Media dicek dulu terhadap media policy; yang ditolak tidak diteruskan dan pengirim diberi penjelasan
+	mediaType := messageMediaType(msg)
+	if mediaType != "" {
+		exchanged := h.Sessions.Exchanged(ctx, sender.TelegramID)
+		if rule, denied := h.mediaPolicy().Check(mediaType, sender, exchanged); denied != "" {
+			h.sendMediaDenied(ctx, sender, mediaType, rule, exchanged, denied)
+			return
+		}
+	}
+
+	// Foto/video/file ditahan sampai partner mau menerima media
+	if core.MediaNeedsConsent(mediaType) && !h.partnerAcceptsMedia(ctx, sender, msg, mediaType) {
+		return
+	}
+
+	h.deliverMessage(ctx, sender, msg)
+}
+
+// deliverMessage mengirim pesan sender ke partner dan mencatatnya di sesi
+func (h *BotHandler) deliverMessage(ctx context.Context, sender *core.User, msg *telegram.Message) {
+	mediaType := messageMediaType(msg)
+	spoiler := mediaType != "" && h.mediaPolicy().Rule(mediaType).Action == core.MediaSpoiler
+	protect := sender.ProtectsContent()
+
+	// Reply ke pesan di chat ini dikirim sebagai reply ke pasangannya di chat partner
+	reply := h.replyParameters(ctx, sender, msg)
+
+	var copyID int
 	var err error
 
 	// 1. Jika FOTO
 	if len(msg.Photo) > 0 {
 		// Kirim action "uploading photo..."
-		_ = h.Bot.SendChatAction(sender.PartnerID, "upload_photo")
+		_ = h.Bot.SendChatAction(ctx, sender.PartnerID, "upload_photo")
 		
 		// Ambil foto kualitas tertinggi (terakhir di array)
 		bestPhoto := msg.Photo[len(msg.Photo)-1]
 		
-		// Kirim Foto dengan SPOILER (Blur)
+		// Kirim Foto, dengan SPOILER (Blur) jika diatur media policy
 		req := telegram.SendPhotoRequest{
 			ChatID:     sender.PartnerID,
 			Photo:      bestPhoto.FileID, // Gunakan FileID dari Telegram
 			Caption:    msg.Caption, // Caption jika ada
-			HasSpoiler: true,     // AKTIFKAN BLUR
+			HasSpoiler: spoiler,
+			ProtectContent: protect,
+			ReplyParameters: reply,
 		}
-		_, err = h.Bot.SendPhoto(req)
+		copyID, err = h.Bot.SendPhoto(ctx, req)
 
 	// 2. Jika VIDEO
 	} else if msg.Video != nil {
-		_ = h.Bot.SendChatAction(sender.PartnerID, "upload_video")
+		_ = h.Bot.SendChatAction(ctx, sender.PartnerID, "upload_video")
 		
 		req := telegram.SendVideoRequest{
 			ChatID:     sender.PartnerID,
 			Video:      msg.Video.FileID,
 			Caption:    msg.Caption,
-			HasSpoiler: true, // AKTIFKAN BLUR
+			HasSpoiler: spoiler,
+			ProtectContent: protect,
+			ReplyParameters: reply,
+		}
+		copyID, err = h.Bot.SendVideo(ctx, req)
+
+	// 3. Jika GIF (dicek sebelum dokumen, karena Telegram juga mengisi Document untuk GIF)
+	} else if msg.Animation != nil {
+		_ = h.Bot.SendChatAction(ctx, sender.PartnerID, "upload_video")
+
+		copyID, err = h.Bot.SendAnimation(ctx, telegram.SendAnimationRequest{
+			ChatID:          sender.PartnerID,
+			Animation:       msg.Animation.FileID,
+			Caption:         msg.Caption,
+			HasSpoiler:      spoiler,
+			ProtectContent:  protect,
+			ReplyParameters: reply,
+		})
+
+	// 4. Jika VOICE NOTE / VIDEO NOTE
+	} else if msg.Voice != nil || msg.VideoNote != nil {
+		action := "record_voice"
+		if msg.VideoNote != nil {
+			action = "record_video_note"
 		}
-		_, err = h.Bot.SendVideo(req)
+		_ = h.Bot.SendChatAction(ctx, sender.PartnerID, action)
+		// Voice & video note tidak bisa di-spoiler, jadi copy biasa
+		copyID, err = h.copyToPartner(ctx, sender, msg, reply)
 
-	// 3. Jika VOICE NOTE
-	} else if msg.Voice != nil {
-		_ = h.Bot.SendChatAction(sender.PartnerID, "record_voice")
-		// Voice tidak bisa di-spoiler, jadi copy biasa
-		_, err = h.Bot.CopyMessage(sender.PartnerID, sender.TelegramID, msg.MessageID)
+	// 5. Jika AUDIO / DOKUMEN
+	} else if msg.Audio != nil || msg.Document != nil {
+		_ = h.Bot.SendChatAction(ctx, sender.PartnerID, "upload_document")
+		copyID, err = h.copyToPartner(ctx, sender, msg, reply)
 
-	// 4. Jika STIKER
-	} else if msg.Sticker != nil {
-		// Stiker tidak ada chat action khusus, kirim langsung
-		_, err = h.Bot.CopyMessage(sender.PartnerID, sender.TelegramID, msg.MessageID)
+	// 6. Jika STIKER, KONTAK, LOKASI, atau POLLING
+	} else if mediaType != "" {
+		// Tidak ada chat action khusus, kirim langsung
+		copyID, err = h.copyToPartner(ctx, sender, msg, reply)
 
-	// 5. Jika TEKS BIASA
+	// 7. Jika TEKS BIASA
 	} else {
-		_ = h.Bot.SendChatAction(sender.PartnerID, "typing")
-		_, err = h.Bot.CopyMessage(sender.PartnerID, sender.TelegramID, msg.MessageID)
+		_ = h.Bot.SendChatAction(ctx, sender.PartnerID, "typing")
+		if translated := h.translateForPartner(ctx, sender, msg.Text); translated != "" {
+			// Partner VIP dengan auto-translate: teks asli (dengan formatnya) + terjemahannya dalam satu pesan
+			text, entities := withTranslation(msg.Text, msg.Entities, translated)
+			copyID, err = h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
+				ChatID:          sender.PartnerID,
+				Text:            text,
+				Entities:        entities,
+				ProtectContent:  protect,
+				ReplyParameters: reply,
+			})
+		} else {
+			copyID, err = h.copyToPartner(ctx, sender, msg, reply)
+		}
 	}
 	
 	// Error Handling
-	if err != nil {
+	if err == nil {
+		h.Sessions.CountMessage(ctx, sender.TelegramID)
+		h.Sessions.LinkRelay(ctx, sender.TelegramID, msg.MessageID, copyID)
+	} else {
 		log.Printf("Failed to relay message from %d to %d: %v", sender.TelegramID, sender.PartnerID, err)
-		h.stopChat(sender)
+
+		if service.MarkUnreachable(ctx, h.UserRepo, sender.PartnerID, err) {
+			// Partner memblokir bot / akun dihapus: tidak ada gunanya melanjutkan chat
+			h.stopChat(ctx, sender)
+			return
+		}
+
+		// Gangguan sementara atau pesan ditolak: chat tetap berjalan, cukup beri tahu pengirim
+		_, _ = h.Bot.SendMessage(ctx, sender.TelegramID, h.I18n.Get(sender.LanguageCode, "relay_failed"))
+	}
+}
+
+// messageMediaType menentukan jenis media pesan untuk media policy ("" = teks biasa / tidak dikenal)
+func messageMediaType(msg *telegram.Message) string {
+	switch {
+	case len(msg.Photo) > 0:
+		return core.MediaPhoto
+	case msg.Video != nil:
+		return core.MediaVideo
+	case msg.Animation != nil:
+		return core.MediaAnimation
+	case msg.VideoNote != nil:
+		return core.MediaVideoNote
+	case msg.Voice != nil:
+		return core.MediaVoice
+	case msg.Audio != nil:
+		return core.MediaAudio
+	case msg.Document != nil:
+		return core.MediaDocument
+	case msg.Sticker != nil:
+		return core.MediaSticker
+	case msg.Contact != nil:
+		return core.MediaContact
+	case msg.Location != nil:
+		return core.MediaLocation
+	case msg.Poll != nil:
+		return core.MediaPoll
+	}
+	return ""
+}
+
+// mediaPolicy mengembalikan media policy dari config (default jika config tidak memuatnya)
+func (h *BotHandler) mediaPolicy() core.MediaPolicy {
+	if h.MediaPolicy == nil {
+		return core.DefaultMediaPolicy()
+	}
+	return h.MediaPolicy
+}
+
+// sendMediaDenied menjelaskan ke pengirim kenapa medianya tidak diteruskan
+func (h *BotHandler) sendMediaDenied(ctx context.Context, sender *core.User, mediaType string, rule core.MediaRule, exchanged int, denied string) {
+	lang := sender.LanguageCode
+	kind := h.I18n.Get(lang, "media_type_"+mediaType)
+
+	text := fmt.Sprintf(h.I18n.Get(lang, "media_denied_"+denied), kind)
+	if denied == core.MediaDeniedTooEarly {
+		text = fmt.Sprintf(h.I18n.Get(lang, "media_denied_early"), kind, rule.MinMessages-exchanged)
+	}
+	_, _ = h.Bot.SendMessage(ctx, sender.TelegramID, text)
+}
+
+// partnerAcceptsMedia mengecek apakah partner mau menerima media dari sender. Jika belum memilih,
+// media ditahan dan partner diminta persetujuan; jika menolak, pengirim diberi tahu.
+func (h *BotHandler) partnerAcceptsMedia(ctx context.Context, sender *core.User, msg *telegram.Message, mediaType string) bool {
+	lang := sender.LanguageCode
+
+	allowed, decided := h.Sessions.MediaConsent(ctx, sender.PartnerID)
+	if decided {
+		if !allowed {
+			_, _ = h.Bot.SendMessage(ctx, sender.TelegramID, h.I18n.Get(lang, "media_consent_refused"))
+		}
+		return allowed
+	}
+
+	partner, err := h.UserRepo.GetByTelegramID(ctx, sender.PartnerID)
+	if err != nil || partner == nil {
+		_, _ = h.Bot.SendMessage(ctx, sender.TelegramID, h.I18n.Get(lang, "relay_failed"))
+		return false
+	}
+	if partner.AllowMedia {
+		return true
+	}
+
+	held := h.Sessions.HoldMedia(ctx, partner.TelegramID, *msg)
+	if held == 0 {
+		_, _ = h.Bot.SendMessage(ctx, sender.TelegramID, h.I18n.Get(lang, "media_consent_full"))
+		return false
+	}
+	if held == 1 {
+		h.sendMediaConsentPrompt(ctx, partner, mediaType)
+	}
+	_, _ = h.Bot.SendMessage(ctx, sender.TelegramID, h.I18n.Get(lang, "media_consent_waiting"))
+	return false
+}
+
+// sendMediaConsentPrompt meminta receiver memilih apakah media dari partnernya boleh ditampilkan
+func (h *BotHandler) sendMediaConsentPrompt(ctx context.Context, receiver *core.User, mediaType string) {
+	session := h.Sessions.Active(ctx, receiver.TelegramID)
+	if session == nil {
+		return
+	}
+	lang := receiver.LanguageCode
+
+	text := fmt.Sprintf(h.I18n.Get(lang, "media_consent_prompt"), h.I18n.Get(lang, "media_type_"+mediaType))
+	keyboard := telegram.InlineKeyboardMarkup{
+		InlineKeyboard: [][]telegram.InlineKeyboardButton{
+			{
+				{Text: h.I18n.Get(lang, "btn_media_allow"), CallbackData: fmt.Sprintf("media:allow:%d", session.ID)},
+				{Text: h.I18n.Get(lang, "btn_media_decline"), CallbackData: fmt.Sprintf("media:decline:%d", session.ID)},
+			},
+		},
+	}
+	h.sendRequest(ctx, telegram.SendMessageRequest{ChatID: receiver.TelegramID, Text: text, ReplyMarkup: keyboard})
+}
+
+// handleMediaConsent memproses tombol "media:allow|decline:<ID sesi>" dari prompt persetujuan media
+func (h *BotHandler) handleMediaConsent(ctx context.Context, user *core.User, data string, msgID int) {
+	lang := user.LanguageCode
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 {
+		return
+	}
+
+	// Prompt dari sesi yang sudah selesai tidak berlaku lagi
+	session := h.Sessions.Active(ctx, user.TelegramID)
+	if user.Status != "chatting" || session == nil || strconv.FormatInt(session.ID, 10) != parts[2] {
+		_ = h.Bot.EditMessageText(ctx, user.TelegramID, msgID, h.I18n.Get(lang, "media_consent_expired"), nil)
+		return
+	}
+
+	allowed := parts[1] == "allow"
+	key := "media_consent_declined"
+	if allowed {
+		key = "media_consent_allowed"
 	}
+	_ = h.Bot.EditMessageText(ctx, user.TelegramID, msgID, h.I18n.Get(lang, key), nil)
+	h.setMediaConsent(ctx, user, allowed)
 }
 
-func (h *BotHandler) stopChat(initiator *core.User) {
+// setMediaConsent menyimpan pilihan receiver di sesi ini sekaligus sebagai default profil,
+// lalu meneruskan (atau membuang) media dari partner yang sedang ditahan
+func (h *BotHandler) setMediaConsent(ctx context.Context, receiver *core.User, allowed bool) {
+	held := h.Sessions.SetMediaConsent(ctx, receiver.TelegramID, allowed)
+
+	if receiver.AllowMedia != allowed {
+		receiver.AllowMedia = allowed
+		_ = h.UserRepo.Update(ctx, receiver)
+	}
+
+	if len(held) == 0 {
+		return
+	}
+	sender, err := h.UserRepo.GetByTelegramID(ctx, receiver.PartnerID)
+	if err != nil || sender == nil || sender.PartnerID != receiver.TelegramID {
+		return
+	}
+
+	if !allowed {
+		_, _ = h.Bot.SendMessage(ctx, sender.TelegramID, h.I18n.Get(sender.LanguageCode, "media_consent_refused"))
+		return
+	}
+	for i := range held {
+		h.deliverMessage(ctx, sender, &held[i])
+	}
+}
+
+// handleMediaCommand: /media saat chat mengganti pilihan menerima media di sesi ini, di luar chat mengganti default profil
+func (h *BotHandler) handleMediaCommand(ctx context.Context, user *core.User) {
+	lang := user.LanguageCode
+
+	current := user.AllowMedia
+	if user.Status == "chatting" {
+		if allowed, decided := h.Sessions.MediaConsent(ctx, user.TelegramID); decided {
+			current = allowed
+		}
+	}
+
+	key := "media_consent_off"
+	if !current {
+		key = "media_consent_on"
+	}
+	_, _ = h.Bot.SendMessage(ctx, user.TelegramID, h.I18n.Get(lang, key))
+
+	if user.Status == "chatting" {
+		h.setMediaConsent(ctx, user, !current)
+		return
+	}
+	user.AllowMedia = !current
+	_ = h.UserRepo.Update(ctx, user)
+}
+
+// handleUnsend menarik pesan yang dibalas dengan /unsend: salinannya di chat partner dihapus,
+// begitu juga pesan asli & perintah /unsend di chat pengirim
+func (h *BotHandler) handleUnsend(ctx context.Context, user *core.User, msg *telegram.Message) {
+	lang := user.LanguageCode
+	if user.Status != "chatting" || user.PartnerID == 0 {
+		_, _ = h.Bot.SendMessage(ctx, user.TelegramID, h.I18n.Get(lang, "unsend_not_chatting"))
+		return
+	}
+	if msg.ReplyToMessage == nil {
+		_, _ = h.Bot.SendMessage(ctx, user.TelegramID, h.I18n.Get(lang, "unsend_usage"))
+		return
+	}
+
+	original := msg.ReplyToMessage.MessageID
+	copyID, sentAt, ok := h.Sessions.RelayedCopy(ctx, user.TelegramID, original)
+	if !ok {
+		// Pesan dari partner, prompt bot, atau pesan yang dikirim sebelum bot restart
+		_, _ = h.Bot.SendMessage(ctx, user.TelegramID, h.I18n.Get(lang, "unsend_not_found"))
+		return
+	}
+	if h.UnsendWindow > 0 && time.Since(sentAt) > h.UnsendWindow {
+		_, _ = h.Bot.SendMessage(ctx, user.TelegramID, fmt.Sprintf(h.I18n.Get(lang, "unsend_expired"), int(h.UnsendWindow.Minutes())))
+		return
+	}
+
+	if err := h.Bot.DeleteMessage(ctx, user.PartnerID, copyID); err != nil {
+		log.Printf("Failed to unsend message %d from %d: %v", original, user.TelegramID, err)
+		_, _ = h.Bot.SendMessage(ctx, user.TelegramID, h.I18n.Get(lang, "unsend_failed"))
+		return
+	}
+	h.Sessions.Unlink(ctx, user.TelegramID, original)
+
+	_ = h.Bot.DeleteMessage(ctx, user.TelegramID, original)
+	_ = h.Bot.DeleteMessage(ctx, user.TelegramID, msg.MessageID)
+	_, _ = h.Bot.SendMessage(ctx, user.TelegramID, h.I18n.Get(lang, "unsend_done"))
+}
+
+// replyParameters mencari pasangan pesan yang dibalas sender di chat partner (nil jika bukan reply
+// atau pesan yang dibalas tidak tercatat, mis. dikirim sebelum bot restart)
+func (h *BotHandler) replyParameters(ctx context.Context, sender *core.User, msg *telegram.Message) *telegram.ReplyParameters {
+	if msg.ReplyToMessage == nil {
+		return nil
+	}
+	target, ok := h.Sessions.Counterpart(ctx, sender.TelegramID, msg.ReplyToMessage.MessageID)
+	if !ok {
+		return nil
+	}
+	// Pesan tujuan bisa saja sudah dihapus partner, pesan tetap dikirim tanpa reply
+	return &telegram.ReplyParameters{MessageID: target, AllowSendingWithoutReply: true}
+}
+
+// copyToPartner menyalin pesan sender ke partner apa adanya
+func (h *BotHandler) copyToPartner(ctx context.Context, sender *core.User, msg *telegram.Message, reply *telegram.ReplyParameters) (int, error) {
+	return h.Bot.CopyMessageComplex(ctx, telegram.CopyMessageRequest{
+		ChatID:          sender.PartnerID,
+		FromChatID:      sender.TelegramID,
+		MessageID:       msg.MessageID,
+		ProtectContent:  sender.ProtectsContent(),
+		ReplyParameters: reply,
+	})
+}
+
+// handleEditedMessage meneruskan editan pesan ke salinannya di chat partner.
+// Pesan yang tidak tercatat (dikirim sebelum bot restart, atau di luar chat) diabaikan.
+func (h *BotHandler) handleEditedMessage(ctx context.Context, msg *telegram.Message) {
+	// Live location juga dikirim sebagai edited_message, tapi salinannya bukan live location
+	if msg.From == nil || msg.Location != nil {
+		return
+	}
+	sender, err := h.UserRepo.GetByTelegramID(ctx, msg.From.ID)
+	if err != nil || sender == nil || sender.Status != "chatting" || sender.PartnerID == 0 {
+		return
+	}
+
+	copyID, ok := h.Sessions.Counterpart(ctx, sender.TelegramID, msg.MessageID)
+	if !ok {
+		return
+	}
+
+	if msg.Text != "" {
+		req := telegram.EditMessageTextRequest{
+			ChatID: sender.PartnerID, MessageID: copyID, Text: msg.Text, Entities: msg.Entities,
+		}
+		if translated := h.translateForPartner(ctx, sender, msg.Text); translated != "" {
+			// Salinan berisi teks asli + terjemahan, jadi terjemahannya ikut diperbarui
+			req.Text, req.Entities = withTranslation(msg.Text, msg.Entities, translated)
+		}
+		err = h.Bot.EditMessageTextComplex(ctx, req)
+	} else {
+		err = h.Bot.EditMessageCaption(ctx, telegram.EditMessageCaptionRequest{
+			ChatID: sender.PartnerID, MessageID: copyID, Caption: msg.Caption, CaptionEntities: msg.CaptionEntities,
+		})
+	}
+
+	if err != nil && !telegram.IsMessageNotModified(err) {
+		log.Printf("Failed to relay edit of message %d from %d: %v", msg.MessageID, sender.TelegramID, err)
+	}
+}
+
+// translateForPartner menerjemahkan teks ke bahasa partner jika partner VIP mengaktifkan auto-translate.
+// Return kosong jika tidak perlu / tidak bisa diterjemahkan.
+func (h *BotHandler) translateForPartner(ctx context.Context, sender *core.User, text string) string {
+	if h.Translator == nil || strings.TrimSpace(text) == "" {
+		return ""
+	}
+
+	partner, err := h.UserRepo.GetByTelegramID(ctx, sender.PartnerID)
+	if err != nil || partner == nil || !partner.IsVIP || !partner.AutoTranslate || partner.LanguageCode == sender.LanguageCode {
+		return ""
+	}
+
+	translated, err := h.Translator.Translate(ctx, text, sender.LanguageCode, partner.LanguageCode)
+	if err != nil {
+		if !errors.Is(err, translate.ErrUnsupported) {
+			log.Printf("Failed to translate message for %d: %v", partner.TelegramID, err)
+		}
+		return ""
+	}
+	if strings.EqualFold(strings.TrimSpace(translated), strings.TrimSpace(text)) {
+		return ""
+	}
+	return translated
+}
+
+// withTranslation menambahkan terjemahan (miring) di bawah teks asli tanpa membuang format pesan user.
+// Offset entity Telegram dihitung dalam UTF-16 code unit, jadi pesannya dikirim tanpa ParseMode.
+func withTranslation(text string, entities []telegram.MessageEntity, translated string) (string, []telegram.MessageEntity) {
+	prefix := text + "\n\n🌐 "
+	merged := make([]telegram.MessageEntity, 0, len(entities)+1)
+	merged = append(merged, entities...)
+	merged = append(merged, telegram.MessageEntity{Type: "italic", Offset: utf16Len(prefix), Length: utf16Len(translated)})
+	return prefix + translated, merged
+}
+
+func utf16Len(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// handleBlock memblokir partner saat ini (chat langsung diakhiri) atau partner terakhir.
+// User yang diblokir tidak akan pernah dipasangkan lagi oleh matchmaker.
+func (h *BotHandler) handleBlock(ctx context.Context, user *core.User) {
+	targetID := user.PartnerID
+	inChat := user.Status == "chatting" && targetID != 0
+	if !inChat && user.Status != "secret_mode" {
+		targetID = user.LastPartnerID
+	}
+
+	if targetID == 0 || (!inChat && user.Status == "secret_mode") {
+		_, _ = h.Bot.SendMessage(ctx, user.TelegramID, h.I18n.Get(user.LanguageCode, "block_none"))
+		return
+	}
+
+	user.Block(targetID)
+	_ = h.UserRepo.Update(ctx, user)
+	_, _ = h.Bot.SendMessage(ctx, user.TelegramID, h.I18n.Get(user.LanguageCode, "block_done"))
+
+	if inChat {
+		h.stopChat(ctx, user)
+	}
+}
+
+func (h *BotHandler) stopChat(ctx context.Context, initiator *core.User) {
 	// 1. IDLE: Jika tidak sedang ngapa-ngapain, langsung kasih menu search
 	
 	h.AFK.Stop(initiator.TelegramID)
@@ -549,80 +1222,101 @@ func (h *BotHandler) stopChat(initiator *core.User) {
 	}
 	
 	if initiator.Status == "idle" {
-		h.sendMoodSelector(initiator.TelegramID, initiator.LanguageCode, false, 0)
+		h.sendMoodSelector(ctx, initiator.TelegramID, initiator.LanguageCode, false, 0)
 		return
 	}
 
 	// 2. QUEUE: Jika sedang antri, batalkan antrian
 	if initiator.Status == "queue" {
-		initiator.Status = "idle"
-		initiator.PartnerID = 0 
-		_ = h.UserRepo.Update(initiator)
+		h.Matchmaker.Remove(initiator.TelegramID)
+
+		// Compare-and-swap: matchmaker bisa saja baru memasangkan user ini sepersekian detik sebelumnya
+		if !h.setStatus(ctx, initiator, "idle") {
+			fresh, _ := h.UserRepo.GetByTelegramID(ctx, initiator.TelegramID)
+			if fresh != nil && fresh.Status == "chatting" {
+				// Sudah terlanjur dapat partner, akhiri chat-nya dengan benar
+				h.stopChat(ctx, fresh)
+				return
+			}
+		}
 
 		// Ubah pesan "Searching..." jadi "Cancelled"
 		if initiator.LastMessageID != 0 {
-			_ = h.Bot.EditMessageText(initiator.TelegramID, initiator.LastMessageID, "⛔ Search cancelled.", nil)
+			_ = h.Bot.EditMessageText(ctx, initiator.TelegramID, initiator.LastMessageID, "⛔ Search cancelled.", nil)
 		} else {
-			_, _ = h.Bot.SendMessage(initiator.TelegramID, "⛔ Search cancelled.")
+			_, _ = h.Bot.SendMessage(ctx, initiator.TelegramID, "⛔ Search cancelled.")
 		}
 		
-		h.sendMoodSelector(initiator.TelegramID, initiator.LanguageCode, false, 0)
+		h.sendMoodSelector(ctx, initiator.TelegramID, initiator.LanguageCode, false, 0)
+		return
+	}
+
+	// Status lain (mis. sedang mengisi lokasi): batalkan saja
+	if initiator.Status != "chatting" {
+		if h.setStatus(ctx, initiator, "idle") {
+			h.sendMoodSelector(ctx, initiator.TelegramID, initiator.LanguageCode, false, 0)
+		}
 		return
 	}
 
 	// 3. CHATTING: Jika sedang chat, putuskan hubungan
 	partnerID := initiator.PartnerID
+
+	// Compare-and-swap: partner bisa saja sudah mengakhiri chat duluan (dan sudah memberi tahu user ini)
+	if !h.releaseChat(ctx, initiator, "idle") {
+		return
+	}
 	
 	// --- AWAL PERUBAHAN: LOGIKA SIMPAN MANTAN & TOMBOL RECONNECT ---
 	
-	// Simpan Mantan & Reset Initiator
-	initiator.LastPartnerID = partnerID 
-	initiator.Status = "idle"
-	initiator.PartnerID = 0
-	_ = h.UserRepo.Update(initiator)
+	session := h.Sessions.End(ctx, initiator.TelegramID, initiator.TelegramID)
+
+	// Simpan Mantan
+	initiator.RememberPartner(partnerID)
+	_ = h.UserRepo.Update(ctx, initiator)
 	
 	// Kirim pesan Stop + Tombol Reconnect (Teaser)
 	stopText := h.I18n.Get(initiator.LanguageCode, "chat_ended")
 	reconnectBtn := telegram.InlineKeyboardMarkup{
 		InlineKeyboard: [][]telegram.InlineKeyboardButton{
 			{{Text: h.I18n.Get(initiator.LanguageCode, "btn_reconnect"), CallbackData: "cmd:reconnect_teaser"}},
+			{{Text: h.I18n.Get(initiator.LanguageCode, "btn_block"), CallbackData: "cmd:block"}},
 		},
 	}
 	// Gunakan SendMessageComplex karena ada tombolnya
-	_, _ = h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+	_, _ = h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 		ChatID: initiator.TelegramID, Text: stopText, ReplyMarkup: reconnectBtn, ParseMode: "HTML",
 	})
 
+	h.sendRatingPrompt(ctx, initiator, session)
+
 	// Tampilkan Menu Search lagi
-	h.sendMoodSelector(initiator.TelegramID, initiator.LanguageCode, false, 0)
+	h.sendMoodSelector(ctx, initiator.TelegramID, initiator.LanguageCode, false, 0)
 
 	// Reset Partner (Korban)
 	if partnerID != 0 {
-		partner, err := h.UserRepo.GetByTelegramID(partnerID)
-		if err == nil && partner != nil && partner.PartnerID == initiator.TelegramID {
-			partner.LastPartnerID = initiator.TelegramID
-			partner.Status = "idle"
-			partner.PartnerID = 0
-			_ = h.UserRepo.Update(partner)
-
+		if partner := h.releasePartner(ctx, partnerID, initiator); partner != nil {
 			// Kirim pesan Partner Left + Tombol Reconnect (Teaser) ke Partner juga
 			stopTextPartner := h.I18n.Get(partner.LanguageCode, "partner_left")
 			reconnectBtnPartner := telegram.InlineKeyboardMarkup{
 				InlineKeyboard: [][]telegram.InlineKeyboardButton{
 					{{Text: h.I18n.Get(partner.LanguageCode, "btn_reconnect"), CallbackData: "cmd:reconnect_teaser"}},
+					{{Text: h.I18n.Get(partner.LanguageCode, "btn_block"), CallbackData: "cmd:block"}},
 				},
 			}
-			_, _ = h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+			_, _ = h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 				ChatID: partner.TelegramID, Text: stopTextPartner, ReplyMarkup: reconnectBtnPartner, ParseMode: "HTML",
 			})
 
-			h.sendMoodSelector(partner.TelegramID, partner.LanguageCode, false, 0)
+			h.sendRatingPrompt(ctx, partner, session)
+
+			h.sendMoodSelector(ctx, partner.TelegramID, partner.LanguageCode, false, 0)
 		}
 	}
 	// --- AKHIR PERUBAHAN ---
 }
 
-func (h *BotHandler) startOnboarding(msg *telegram.Message) {
+func (h *BotHandler) startOnboarding(ctx context.Context, msg *telegram.Message) {
 	newUser := &core.User{
 		TelegramID:   msg.From.ID,
 		Username:     msg.From.Username,
@@ -632,17 +1326,17 @@ func (h *BotHandler) startOnboarding(msg *telegram.Message) {
 	}
 	
 
-	if err := h.UserRepo.Create(newUser); err != nil {
+	if err := h.UserRepo.Create(ctx, newUser); err != nil {
 		log.Printf("Failed to create user: %v", err)
 		return
 	}
 
 	// FIX: Jangan langsung menu utama! Kirim sapaan & tanya Gender.
-	_, _ = h.Bot.SendMessage(msg.Chat.ID, h.I18n.Get(newUser.LanguageCode, "welcome"))
-	h.sendGenderSelector(msg.Chat.ID, newUser.LanguageCode, false, 0)
+	_, _ = h.Bot.SendMessage(ctx, msg.Chat.ID, h.I18n.Get(newUser.LanguageCode, "welcome"))
+	h.sendGenderSelector(ctx, msg.Chat.ID, newUser.LanguageCode, false, 0)
 }
 
-func (h *BotHandler) sendGenderSelector(chatID int64, lang string, isEdit bool, msgID int) {
+func (h *BotHandler) sendGenderSelector(ctx context.Context, chatID int64, lang string, isEdit bool, msgID int) {
 	text := h.I18n.Get(lang, "ask_gender")
 	rows := [][]telegram.InlineKeyboardButton{
 		{{Text: h.I18n.Get(lang, "btn_male"), CallbackData: "gender:male"}, {Text: h.I18n.Get(lang, "btn_female"), CallbackData: "gender:female"}},
@@ -651,10 +1345,10 @@ func (h *BotHandler) sendGenderSelector(chatID int64, lang string, isEdit bool,
 		rows = append(rows, []telegram.InlineKeyboardButton{{Text: h.I18n.Get(lang, "btn_back"), CallbackData: "back:profile"}})
 	}
 
-	h.sendOrEdit(chatID, text, telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, isEdit, msgID)
+	h.sendOrEdit(ctx, chatID, text, telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, isEdit, msgID)
 }
 
-func (h *BotHandler) sendPreferenceSelector(chatID int64, lang string, isEdit bool, msgID int) {
+func (h *BotHandler) sendPreferenceSelector(ctx context.Context, chatID int64, lang string, isEdit bool, msgID int) {
 	text := h.I18n.Get(lang, "ask_preference")
 	rows := [][]telegram.InlineKeyboardButton{
 		{{Text: h.I18n.Get(lang, "btn_male"), CallbackData: "pref:male"}, {Text: h.I18n.Get(lang, "btn_female"), CallbackData: "pref:female"}},
@@ -664,10 +1358,10 @@ func (h *BotHandler) sendPreferenceSelector(chatID int64, lang string, isEdit bo
 		rows = append(rows, []telegram.InlineKeyboardButton{{Text: h.I18n.Get(lang, "btn_back"), CallbackData: "back:profile"}})
 	}
 
-	h.sendOrEdit(chatID, text, telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, isEdit, msgID)
+	h.sendOrEdit(ctx, chatID, text, telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, isEdit, msgID)
 }
 
-func (h *BotHandler) sendLangSelector(chatID int64, lang string, isEdit bool, msgID int, origin string) {
+func (h *BotHandler) sendLangSelector(ctx context.Context, chatID int64, lang string, isEdit bool, msgID int, origin string) {
 	text := h.I18n.Get(lang, "ask_lang")
 	
 	var rows [][]telegram.InlineKeyboardButton
@@ -693,10 +1387,10 @@ func (h *BotHandler) sendLangSelector(chatID int64, lang string, isEdit bool, ms
 	
 	rows = append(rows, []telegram.InlineKeyboardButton{{Text: h.I18n.Get(lang, "btn_back"), CallbackData: backCallback}})
 	
-	h.sendOrEdit(chatID, text, telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, isEdit, msgID)
+	h.sendOrEdit(ctx, chatID, text, telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, isEdit, msgID)
 }
 
-func (h *BotHandler) sendMoodSelector(chatID int64, lang string, isEdit bool, msgID int) {
+func (h *BotHandler) sendMoodSelector(ctx context.Context, chatID int64, lang string, isEdit bool, msgID int) {
 	text := h.I18n.Get(lang, "select_mood")
 	
 	var rows [][]telegram.InlineKeyboardButton
@@ -716,10 +1410,10 @@ func (h *BotHandler) sendMoodSelector(chatID int64, lang string, isEdit bool, ms
 	// Tambahkan Tombol Back ke Menu Utama
 	rows = append(rows, []telegram.InlineKeyboardButton{{Text: "🏠 Main Menu", CallbackData: "back:menu"}})
 	
-	h.sendOrEdit(chatID, text, telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, isEdit, msgID)
+	h.sendOrEdit(ctx, chatID, text, telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, isEdit, msgID)
 }
 
-func (h *BotHandler) sendLocationSelector(chatID int64, lang string, isEdit bool, msgID int) {
+func (h *BotHandler) sendLocationSelector(ctx context.Context, chatID int64, lang string, isEdit bool, msgID int) {
 	text := h.I18n.Get(lang, "ask_location")
 
 	var rows [][]telegram.InlineKeyboardButton
@@ -727,7 +1421,7 @@ func (h *BotHandler) sendLocationSelector(chatID int64, lang string, isEdit bool
 
 	for _, c := range core.AvailableCountries {
 		btnText := fmt.Sprintf("%s %s", c.Icon, c.Label)
-		currentRow = append(currentRow, telegram.InlineKeyboardButton{Text: btnText, CallbackData: "setloc:" + c.Label + "|" + c.Icon})
+		currentRow = append(currentRow, telegram.InlineKeyboardButton{Text: btnText, CallbackData: "setloc:" + c.Code})
 		
 		if len(currentRow) == 2 {
 			rows = append(rows, currentRow)
@@ -736,29 +1430,219 @@ func (h *BotHandler) sendLocationSelector(chatID int64, lang string, isEdit bool
 	}
 	if len(currentRow) > 0 { rows = append(rows, currentRow) }
 
+	rows = append(rows, []telegram.InlineKeyboardButton{
+		{Text: h.I18n.Get(lang, "btn_share_location"), CallbackData: "loc:share"},
+		{Text: h.I18n.Get(lang, "btn_set_city"), CallbackData: "loc:city"},
+	})
+
+	rows = append(rows, []telegram.InlineKeyboardButton{{Text: h.I18n.Get(lang, "btn_back"), CallbackData: "back:profile"}})
+
+	h.sendOrEdit(ctx, chatID, text, telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, isEdit, msgID)
+}
+
+// askLocationInput meminta user membagikan lokasi (tombol Share Location) atau mengetik nama kota
+func (h *BotHandler) askLocationInput(ctx context.Context, user *core.User, share bool) {
+	if user.Status == "chatting" || user.Status == "secret_mode" {
+		return
+	}
+	lang := user.LanguageCode
+
+	if !share && !core.IsSpecificLocation(user.Location) {
+		_, _ = h.Bot.SendMessage(ctx, user.TelegramID, h.I18n.Get(lang, "city_needs_country"))
+		return
+	}
+
+	h.cleanStatus(ctx, user)
+	if user.Status != "idle" {
+		// Baru saja dapat partner
+		return
+	}
+	if !h.setStatus(ctx, user, "awaiting_location") {
+		return
+	}
+
+	text := h.I18n.Get(lang, "ask_city")
+	keyboard := [][]telegram.KeyboardButton{{{Text: h.I18n.Get(lang, "btn_cancel_location")}}}
+	if share {
+		text = h.I18n.Get(lang, "ask_share_location")
+		keyboard = append([][]telegram.KeyboardButton{{{Text: h.I18n.Get(lang, "btn_send_location"), RequestLocation: true}}}, keyboard...)
+	}
+
+	_, _ = h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
+		ChatID:      user.TelegramID,
+		Text:        text,
+		ParseMode:   "HTML",
+		ReplyMarkup: telegram.ReplyKeyboardMarkup{Keyboard: keyboard, ResizeKeyboard: true, OneTimeKeyboard: true},
+	})
+}
+
+// handleLocationInput memproses lokasi yang dibagikan user atau nama kota yang diketik
+func (h *BotHandler) handleLocationInput(ctx context.Context, user *core.User, msg *telegram.Message) {
+	lang := user.LanguageCode
+	chatID := user.TelegramID
+	removeKeyboard := telegram.ReplyKeyboardRemove{RemoveKeyboard: true}
+
+	resultKey := "location_saved"
+	switch {
+	case msg.Location != nil:
+		code, ok := core.CountryFromCoordinates(msg.Location.Latitude, msg.Location.Longitude)
+		if !ok {
+			// Status tetap awaiting_location supaya user bisa pilih manual atau coba lagi
+			_, _ = h.Bot.SendMessage(ctx, chatID, h.I18n.Get(lang, "location_unsupported"))
+			return
+		}
+		if code != user.Location {
+			user.City = ""
+		}
+		user.Location = code
+
+	case msg.Text == "" || msg.Text == h.I18n.Get(lang, "btn_cancel_location") || strings.HasPrefix(msg.Text, "/"):
+		resultKey = "location_cancelled"
+
+	default:
+		if !core.IsSpecificLocation(user.Location) {
+			resultKey = "city_needs_country"
+			break
+		}
+		user.City = core.CleanCity(msg.Text)
+	}
+
+	if user.Status == "awaiting_location" {
+		h.setStatus(ctx, user, "idle")
+	}
+	_ = h.UserRepo.Update(ctx, user)
+
+	text := h.I18n.Get(lang, resultKey)
+	if resultKey == "location_saved" {
+		text = fmt.Sprintf(text, escapeHTML(core.LocationLabel(user.Location, user.City)))
+	}
+	_, _ = h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
+		ChatID: chatID, Text: text, ParseMode: "HTML", ReplyMarkup: removeKeyboard,
+	})
+	h.sendUserProfile(ctx, chatID, user, false)
+}
+
+// askBirthYear meminta user mengetik tahun lahir (dari tombol profil)
+func (h *BotHandler) askBirthYear(ctx context.Context, user *core.User) {
+	if user.BirthYear != 0 || user.Status == "chatting" || user.Status == "secret_mode" {
+		return
+	}
+
+	h.cleanStatus(ctx, user)
+	if user.Status != "idle" {
+		// Baru saja dapat partner
+		return
+	}
+	if !h.setStatus(ctx, user, "awaiting_birth_year") {
+		return
+	}
+
+	_, _ = h.Bot.SendMessage(ctx, user.TelegramID, h.I18n.Get(user.LanguageCode, "ask_birth_year"))
+}
+
+// handleBirthYearInput memproses tahun lahir yang diketik user
+func (h *BotHandler) handleBirthYearInput(ctx context.Context, user *core.User, msg *telegram.Message) {
+	lang := user.LanguageCode
+	chatID := user.TelegramID
+	onboarding := user.Status == "onboarding"
+
+	// Command saat mengisi dari profil = batal. Saat onboarding tahun lahir wajib diisi.
+	if strings.HasPrefix(msg.Text, "/") && !onboarding {
+		h.setStatus(ctx, user, "idle")
+		h.sendUserProfile(ctx, chatID, user, false)
+		return
+	}
+
+	year, err := strconv.Atoi(strings.TrimSpace(msg.Text))
+	if err != nil || !core.ValidBirthYear(year) {
+		_, _ = h.Bot.SendMessage(ctx, chatID, h.I18n.Get(lang, "birth_year_invalid"))
+		return
+	}
+
+	user.BirthYear = year
+	_ = h.UserRepo.Update(ctx, user)
+	h.setStatus(ctx, user, "idle")
+
+	if onboarding {
+		_, _ = h.Bot.SendMessage(ctx, chatID, h.I18n.Get(lang, "setup_complete"))
+		h.sendMainMenu(ctx, chatID, user, false, 0)
+		return
+	}
+	h.sendUserProfile(ctx, chatID, user, false)
+}
+
+// sendAgeRangeSelector menampilkan pilihan filter umur partner (VIP)
+func (h *BotHandler) sendAgeRangeSelector(ctx context.Context, chatID int64, user *core.User, msgID int) {
+	lang := user.LanguageCode
+
+	rows := [][]telegram.InlineKeyboardButton{
+		{{Text: h.I18n.Get(lang, "age_range_any"), CallbackData: "agerange:any"}},
+	}
+	var currentRow []telegram.InlineKeyboardButton
+	for _, b := range core.AgeBrackets {
+		min, _ := core.ParseAgeRange(b.Code)
+		if min < core.AdultAge {
+			// Filter ke kelompok di bawah umur tidak ditawarkan
+			continue
+		}
+		currentRow = append(currentRow, telegram.InlineKeyboardButton{Text: h.I18n.Get(lang, b.Label), CallbackData: "agerange:" + b.Code})
+		if len(currentRow) == 2 {
+			rows = append(rows, currentRow)
+			currentRow = []telegram.InlineKeyboardButton{}
+		}
+	}
+	if len(currentRow) > 0 { rows = append(rows, currentRow) }
+
 	rows = append(rows, []telegram.InlineKeyboardButton{{Text: h.I18n.Get(lang, "btn_back"), CallbackData: "back:profile"}})
 
-	h.sendOrEdit(chatID, text, telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, isEdit, msgID)
+	h.sendOrEdit(ctx, chatID, h.I18n.Get(lang, "ask_age_range"), telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, true, msgID)
 }
 
-func (h *BotHandler) sendOrEdit(chatID int64, text string, markup telegram.InlineKeyboardMarkup, isEdit bool, msgID int) {
+// sendInterestSelector menampilkan semua tag minat; tag yang sudah dipilih diberi tanda ✅
+func (h *BotHandler) sendInterestSelector(ctx context.Context, chatID int64, user *core.User, msgID int) {
+	lang := user.LanguageCode
+	text := fmt.Sprintf(h.I18n.Get(lang, "ask_interests"), core.MaxInterests)
+
+	var rows [][]telegram.InlineKeyboardButton
+	var currentRow []telegram.InlineKeyboardButton
+
+	for _, opt := range core.AvailableInterests {
+		btnText := fmt.Sprintf("%s %s", opt.Icon, h.I18n.Get(lang, opt.Label))
+		if user.HasInterest(opt.Code) {
+			btnText = "✅ " + btnText
+		}
+		currentRow = append(currentRow, telegram.InlineKeyboardButton{Text: btnText, CallbackData: "interest:" + opt.Code})
+
+		if len(currentRow) == 2 {
+			rows = append(rows, currentRow)
+			currentRow = []telegram.InlineKeyboardButton{}
+		}
+	}
+	if len(currentRow) > 0 { rows = append(rows, currentRow) }
+
+	rows = append(rows, []telegram.InlineKeyboardButton{{Text: h.I18n.Get(lang, "btn_back"), CallbackData: "back:profile"}})
+
+	h.sendOrEdit(ctx, chatID, text, telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, true, msgID)
+}
+
+func (h *BotHandler) sendOrEdit(ctx context.Context, chatID int64, text string, markup telegram.InlineKeyboardMarkup, isEdit bool, msgID int) {
 	if isEdit {
-		_ = h.Bot.EditMessageText(chatID, msgID, text, markup)
+		_ = h.Bot.EditMessageText(ctx, chatID, msgID, text, markup)
 	} else {
-		newMsgID, _ := h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+		newMsgID, _ := h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 			ChatID: chatID, Text: text, ReplyMarkup: markup, ParseMode: "HTML",
 		})
 		if newMsgID != 0 {
-			user, _ := h.UserRepo.GetByTelegramID(chatID)
+			user, _ := h.UserRepo.GetByTelegramID(ctx, chatID)
 			if user != nil {
 				user.LastMessageID = newMsgID
-				_ = h.UserRepo.Update(user)
+				_ = h.UserRepo.Update(ctx, user)
 			}
 		}
 	}
 }
 
-func (h *BotHandler) handleCallback(cb *telegram.CallbackQuery) {
+func (h *BotHandler) handleCallback(ctx context.Context, cb *telegram.CallbackQuery) {
 	telegramID := cb.From.ID
 	chatID := cb.Message.Chat.ID
 	msgID := cb.Message.MessageID
@@ -769,68 +1653,80 @@ func (h *BotHandler) handleCallback(cb *telegram.CallbackQuery) {
 	   data != "clear_inbox" &&
 	   data != "clear_yes" && 
 	   data != "clear_no"{
-		h.Bot.AnswerCallbackQuery(cb.ID, "", false)
+		h.Bot.AnswerCallbackQuery(ctx, cb.ID, "", false)
 	}
 
-	user, err := h.UserRepo.GetByTelegramID(cb.From.ID)
+	user, err := h.UserRepo.GetByTelegramID(ctx, cb.From.ID)
 	if err != nil || user == nil { return }
 
 	if strings.HasPrefix(data, "stop_sec:") {
 		targetIDStr := strings.TrimPrefix(data, "stop_sec:")
 		targetID, _ := strconv.ParseInt(targetIDStr, 10, 64)
 
-		if user.Status == "chatting" && user.PartnerID != 0 {
-			partner, _ := h.UserRepo.GetByTelegramID(user.PartnerID)
-			if partner != nil {
-				h.Bot.SendMessage(partner.TelegramID, h.I18n.Get(partner.LanguageCode, "partner_stopped"))
-				partner.Status = "idle"
-				partner.PartnerID = 0
-				h.UserRepo.Update(partner)
+		// Status diubah lewat compare-and-swap; jika gagal (status baru saja berubah), tombol bisa ditekan lagi
+		switch user.Status {
+		case "chatting":
+			partnerID := user.PartnerID
+			if !h.releaseChat(ctx, user, "secret_mode") {
+				return
+			}
+			session := h.Sessions.End(ctx, user.TelegramID, user.TelegramID)
+			if partnerID != 0 {
+				if partner := h.releasePartner(ctx, partnerID, user); partner != nil {
+					h.Bot.SendMessage(ctx, partner.TelegramID, h.I18n.Get(partner.LanguageCode, "partner_stopped"))
+					h.sendRatingPrompt(ctx, partner, session)
+				}
+			}
+			user.RememberPartner(partnerID)
+		case "queue":
+			h.Matchmaker.Remove(user.TelegramID)
+			fallthrough
+		default:
+			if !h.setStatus(ctx, user, "secret_mode") {
+				return
 			}
 		}
-		user.PartnerID = 0
-		user.Status = "secret_mode"
 		user.LastPartnerID = targetID 
-		h.UserRepo.Update(user)
+		h.UserRepo.Update(ctx, user)
 
-		_ = h.Bot.DeleteMessage(chatID, msgID)
-		h.Bot.SendMessage(chatID, h.I18n.Get(user.LanguageCode, "secret_mode_start"))
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+		h.Bot.SendMessage(ctx, chatID, h.I18n.Get(user.LanguageCode, "secret_mode_start"))
 		return
 	}
 
 	// --- INBOX CALLBACKS ---
 	if strings.HasPrefix(data, "peek:") {
 		// [PERBAIKAN] Panggil HandlePeek tanpa userRepo get lagi (sudah ada diatas)
-		h.Inbox.HandlePeek(cb, user)
+		h.Inbox.HandlePeek(ctx, cb, user)
 		return
 	}
 
 	if data == "clear_inbox" {
 		// Klik pertama -> Tanya Dulu
-		h.Inbox.HandleAskClear(cb, user)
+		h.Inbox.HandleAskClear(ctx, cb, user)
 		return
 	}
 	
 	if data == "clear_yes" {
 		// Klik Ya -> Eksekusi
-		h.Inbox.HandleConfirmClear(cb, user)
+		h.Inbox.HandleConfirmClear(ctx, cb, user)
 		return
 	}
 
 	if data == "clear_no" {
 		// Klik Batal -> Balikin Tombol
-		h.Inbox.HandleCancelClear(cb, user)
+		h.Inbox.HandleCancelClear(ctx, cb, user)
 		return
 	}
 
 	if data == "clear_inbox" {
-		h.Inbox.HandleClear(cb, user)
+		h.Inbox.HandleClear(ctx, cb, user)
 		return
 	}
 
 	if data == "cmd:inbox" {
-		_ = h.Bot.DeleteMessage(chatID, msgID)
-		h.Inbox.ShowInbox(user)
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+		h.Inbox.ShowInbox(ctx, user)
 		return
 	}
 
@@ -844,52 +1740,57 @@ func (h *BotHandler) handleCallback(cb *telegram.CallbackQuery) {
 	// Jika Gender/Pref kosong DAN user mencoba klik tombol fitur (bukan tombol setup)
 	if (user.Gender == "" || user.Preference == "") && !isSetupAction {
 		// Paksa kembali ke pemilihan Gender
-		h.sendGenderSelector(chatID, user.LanguageCode, true, msgID)
+		h.sendGenderSelector(ctx, chatID, user.LanguageCode, true, msgID)
 		return
 	}
 	// ---------------------------
 
 	if data == "reveal:agree" {
 		// Hapus pesan permintaan agar tidak bisa diklik 2x
-		_ = h.Bot.DeleteMessage(chatID, msgID)
-		h.executeReveal(user)
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+		h.executeReveal(ctx, user)
 		return
 	}
 	if data == "cmd:inbox" {
-		_ = h.Bot.DeleteMessage(chatID, msgID)
-		h.Inbox.ShowInbox(user)
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+		h.Inbox.ShowInbox(ctx, user)
 		return
 	}
 	if data == "reveal:reject" {
-		_ = h.Bot.DeleteMessage(chatID, msgID)
-		_, _ = h.Bot.SendMessage(chatID, h.I18n.Get(user.LanguageCode, "share_rejected"))
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+		_, _ = h.Bot.SendMessage(ctx, chatID, h.I18n.Get(user.LanguageCode, "share_rejected"))
 		return
 	}
 
 	if strings.HasPrefix(data, "report:") {
 		reason := strings.Split(data, ":")[1]
-		_ = h.Bot.DeleteMessage(chatID, msgID) // Hapus menu pilihan
-		h.Report.HandleReportCallback(user, reason)
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID) // Hapus menu pilihan
+		h.Report.HandleReportCallback(ctx, user, reason)
 		return
 	}
 	if strings.HasPrefix(data, "admin:") {
-		h.Report.HandleAdminAction(telegramID, data, msgID)
+		h.Report.HandleAdminAction(ctx, telegramID, data, msgID)
 		return
 	}
 
 	if data == "cmd:stop" {
-		h.stopChat(user)
+		h.stopChat(ctx, user)
+		return
+	}
+
+	if data == "cmd:block" {
+		h.handleBlock(ctx, user)
 		return
 	}
 
 	if data == "cmd:delete_me" {
-		_ = h.Bot.DeleteMessage(chatID, msgID)
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
 		return
 	}
 
 	if data == "cmd:reconnect_teaser" {
 		if user.IsVIP {
-			h.handleReconnect(user)
+			h.handleReconnect(ctx, user)
 		} else {
 			pitchText := h.I18n.Get(user.LanguageCode, "vip_pitch")
 			keyboard := telegram.InlineKeyboardMarkup{
@@ -897,7 +1798,7 @@ func (h *BotHandler) handleCallback(cb *telegram.CallbackQuery) {
 					{{Text: h.I18n.Get(user.LanguageCode, "btn_vip"), CallbackData: "cmd:vip"}},
 				},
 			}
-			_, _ = h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+			_, _ = h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 				ChatID: chatID, Text: pitchText, ReplyMarkup: keyboard, ParseMode: "HTML",
 			})
 		}
@@ -907,7 +1808,7 @@ func (h *BotHandler) handleCallback(cb *telegram.CallbackQuery) {
 	// Pembayaran
 	if strings.HasPrefix(data, "buy:") {
 		planID := strings.TrimPrefix(data, "buy:")
-		h.Payment.SendVIPInvoice(chatID, planID, user.LanguageCode)
+		h.Payment.SendVIPInvoice(ctx, chatID, planID, user.LanguageCode)
 		return
 	}
 
@@ -916,15 +1817,15 @@ func (h *BotHandler) handleCallback(cb *telegram.CallbackQuery) {
 		
 		// 1. Hapus pesan panel agar tidak nyampah (kecuali user minta panel baru)
 		if action != "panel" {
-			_ = h.Bot.DeleteMessage(chatID, msgID)
+			_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
 		}
 
 		if action == "panel" {
 			// Cek lagi status sebelum kirim panel baru
 			if user.Status == "chatting" && user.PartnerID != 0 {
-				h.sendGamePanel(user)
+				h.sendGamePanel(ctx, user)
 			} else {
-				_, _ = h.Bot.SendMessage(chatID, "⚠️ You need a partner to play!")
+				_, _ = h.Bot.SendMessage(ctx, chatID, "⚠️ You need a partner to play!")
 			}
 			return
 		}
@@ -933,7 +1834,7 @@ func (h *BotHandler) handleCallback(cb *telegram.CallbackQuery) {
 		// Jika user sudah /stop atau /next, statusnya pasti "idle" atau "queue".
 		// Jadi kita tolak aksinya biar gak error kirim ke partner 0 atau mantan.
 		if user.Status != "chatting" || user.PartnerID == 0 {
-			_, _ = h.Bot.SendMessage(chatID, "⚠️ <b>Session ended.</b> You cannot play game anymore.")
+			_, _ = h.Bot.SendMessage(ctx, chatID, "⚠️ <b>Session ended.</b> You cannot play game anymore.")
 			return
 		}
 
@@ -947,35 +1848,36 @@ func (h *BotHandler) handleCallback(cb *telegram.CallbackQuery) {
 
 			msgText := fmt.Sprintf("%s\n\n<i>%s</i>\n <i>%s</i>", header, question, footer)
 			
-			// Kirim ke DUA belah pihak
-			_, _ = h.Bot.SendMessage(user.TelegramID, msgText)
-			_, _ = h.Bot.SendMessage(user.PartnerID, msgText)
+			// Kirim ke DUA belah pihak, dicatat berpasangan supaya reply ke prompt ini ikut tersambung
+			ownID, _ := h.Bot.SendMessage(ctx, user.TelegramID, msgText)
+			partnerID, _ := h.Bot.SendMessage(ctx, user.PartnerID, msgText)
+			h.Sessions.LinkMessages(ctx, user.TelegramID, ownID, partnerID)
 		}
 		return
 	}
 
 	// --- NAVIGASI MENU UTAMA ---
 	if data == "cmd:search" {
-		_ = h.Bot.DeleteMessage(chatID, msgID) 
-		h.cleanStatus(user)
-		h.sendMoodSelector(chatID, user.LanguageCode, false, 0)
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID) 
+		h.cleanStatus(ctx, user)
+		h.sendMoodSelector(ctx, chatID, user.LanguageCode, false, 0)
 		return
 	}
 	if data == "cmd:profile" {
-		_ = h.Bot.DeleteMessage(chatID, msgID)
-		h.sendUserProfile(chatID, user, false)
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+		h.sendUserProfile(ctx, chatID, user, false)
 		return
 	}
 	
 	if data == "cmd:vip" {
-		_ = h.Bot.DeleteMessage(chatID, msgID)
-		h.sendVipInfo(chatID, user.LanguageCode, false, 0)
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+		h.sendVipInfo(ctx, chatID, user.LanguageCode, false, 0)
 		return
 	}
 
 	if data == "cmd:help" {
-		_ = h.Bot.DeleteMessage(chatID, msgID)
-		h.sendHelpMenu(chatID, user.LanguageCode, false, 0)
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+		h.sendHelpMenu(ctx, chatID, user.LanguageCode, false, 0)
 		return
 	}
 	
@@ -990,52 +1892,111 @@ func (h *BotHandler) handleCallback(cb *telegram.CallbackQuery) {
 				{{Text: "🔙 Back to Help", CallbackData: "back:help_menu"}},
 			},
 		}
-		h.sendOrEdit(chatID, text, keyboard, true, msgID)
+		h.sendOrEdit(ctx, chatID, text, keyboard, true, msgID)
 		return
 	}
 
 	if data == "back:help_menu" {
-		h.sendHelpMenu(chatID, user.LanguageCode, true, msgID)
+		h.sendHelpMenu(ctx, chatID, user.LanguageCode, true, msgID)
 		return
 	}
 
 	if data == "cmd:about" {
-		_ = h.Bot.DeleteMessage(chatID, msgID)
-		h.sendInfoMessage(chatID, user.LanguageCode, "about_text", false, 0)
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+		h.sendInfoMessage(ctx, chatID, user.LanguageCode, "about_text", false, 0)
 		return
 	}
 
 	// --- NAVIGASI EDIT/SETTING ---
 	if data == "edit:lang_from_menu" {
-		_ = h.Bot.DeleteMessage(chatID, msgID)
-		h.sendLangSelector(chatID, user.LanguageCode, false, 0, "menu")
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+		h.sendLangSelector(ctx, chatID, user.LanguageCode, false, 0, "menu")
 		return
 	}
 
 	if data == "back:menu" {
-		_ = h.Bot.DeleteMessage(chatID, msgID)
-		h.sendMainMenu(chatID, user, false, 0)
+		_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+		h.sendMainMenu(ctx, chatID, user, false, 0)
 		return
 	}
 
 	if data == "back:profile" {
-		h.sendUserProfile(chatID, user, true)
+		h.sendUserProfile(ctx, chatID, user, true)
 		return
 	}
 	if data == "edit:gender" {
-		h.sendGenderSelector(chatID, user.LanguageCode, true, msgID)
+		h.sendGenderSelector(ctx, chatID, user.LanguageCode, true, msgID)
 		return
 	}
 	if data == "edit:pref" {
-		h.sendPreferenceSelector(chatID, user.LanguageCode, true, msgID)
+		h.sendPreferenceSelector(ctx, chatID, user.LanguageCode, true, msgID)
 		return
 	}
 	if data == "edit:loc" {
-		h.sendLocationSelector(chatID, user.LanguageCode, true, msgID)
+		h.sendLocationSelector(ctx, chatID, user.LanguageCode, true, msgID)
 		return
 	}
 	if data == "edit:lang_from_profile" {
-		h.sendLangSelector(chatID, user.LanguageCode, true, msgID, "profile")
+		h.sendLangSelector(ctx, chatID, user.LanguageCode, true, msgID, "profile")
+		return
+	}
+	if data == "loc:share" || data == "loc:city" {
+		h.askLocationInput(ctx, user, data == "loc:share")
+		return
+	}
+	if data == "toggle:samelang" {
+		user.SameLanguageOnly = !user.SameLanguageOnly
+		_ = h.UserRepo.Update(ctx, user)
+		h.sendUserProfile(ctx, chatID, user, true)
+		return
+	}
+	if data == "toggle:protect" {
+		protect := !user.ProtectsContent()
+		user.ProtectContent = &protect
+		_ = h.UserRepo.Update(ctx, user)
+		h.sendUserProfile(ctx, chatID, user, true)
+		return
+	}
+	if data == "toggle:media" {
+		user.AllowMedia = !user.AllowMedia
+		_ = h.UserRepo.Update(ctx, user)
+		h.sendUserProfile(ctx, chatID, user, true)
+		return
+	}
+	if strings.HasPrefix(data, "media:") {
+		h.handleMediaConsent(ctx, user, data, msgID)
+		return
+	}
+	if data == "toggle:translate" {
+		if !user.IsVIP {
+			// Fitur VIP: tampilkan info paket
+			h.sendVipInfo(ctx, chatID, user.LanguageCode, true, msgID)
+			return
+		}
+		user.AutoTranslate = !user.AutoTranslate
+		_ = h.UserRepo.Update(ctx, user)
+		h.sendUserProfile(ctx, chatID, user, true)
+		return
+	}
+	if strings.HasPrefix(data, "rate:") {
+		h.handleRating(ctx, user, data, msgID)
+		return
+	}
+	if data == "edit:interests" {
+		h.sendInterestSelector(ctx, chatID, user, msgID)
+		return
+	}
+	if data == "edit:age" {
+		h.askBirthYear(ctx, user)
+		return
+	}
+	if data == "edit:agerange" {
+		if !user.IsVIP {
+			// Fitur VIP: tampilkan info paket
+			h.sendVipInfo(ctx, chatID, user.LanguageCode, true, msgID)
+			return
+		}
+		h.sendAgeRangeSelector(ctx, chatID, user, msgID)
 		return
 	}
 
@@ -1047,64 +2008,101 @@ func (h *BotHandler) handleCallback(cb *telegram.CallbackQuery) {
 		if len(parts) > 2 { origin = parts[2] }
 
 		user.LanguageCode = lang
-		_ = h.UserRepo.Update(user)
+		_ = h.UserRepo.Update(ctx, user)
 
 		if origin == "menu" {
-			_ = h.Bot.DeleteMessage(chatID, msgID)
-			h.sendMainMenu(chatID, user, false, 0)
+			_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+			h.sendMainMenu(ctx, chatID, user, false, 0)
 		} else {
-			h.sendUserProfile(chatID, user, true)
+			h.sendUserProfile(ctx, chatID, user, true)
 		}
 	
 	} else if strings.HasPrefix(data, "setloc:") {
-		rawData := strings.TrimPrefix(data, "setloc:")
-		parts := strings.Split(rawData, "|")
-		locName := parts[0]
-		locIcon := ""
-		if len(parts) > 1 { locIcon = parts[1] }
-		
-		user.Location = fmt.Sprintf("%s %s", locIcon, locName)
-		_ = h.UserRepo.Update(user)
-		h.sendUserProfile(chatID, user, true)
+		// Format baru "setloc:ID"; tombol lama "setloc:Indonesia|🇮🇩" tetap dikenali
+		code := core.NormalizeLocation(strings.TrimPrefix(data, "setloc:"))
+		if code == "" {
+			return
+		}
+
+		if code != user.Location {
+			user.City = "" // Kota lama tidak berlaku untuk negara lain
+		}
+		user.Location = code
+		_ = h.UserRepo.Update(ctx, user)
+		h.sendUserProfile(ctx, chatID, user, true)
+
+	} else if strings.HasPrefix(data, "interest:") {
+		code := strings.TrimPrefix(data, "interest:")
+		// Tag sudah penuh (MaxInterests) atau tidak dikenal: tampilan tetap, tidak ada yang berubah
+		if user.ToggleInterest(code) {
+			_ = h.UserRepo.Update(ctx, user)
+			h.sendInterestSelector(ctx, chatID, user, msgID)
+		}
+
+	} else if strings.HasPrefix(data, "agerange:") {
+		if !user.IsVIP {
+			return
+		}
+		user.AgeMin, user.AgeMax = 0, 0
+		if code := strings.TrimPrefix(data, "agerange:"); code != "any" {
+			user.AgeMin, user.AgeMax = core.ParseAgeRange(code)
+		}
+		_ = h.UserRepo.Update(ctx, user)
+		h.sendUserProfile(ctx, chatID, user, true)
 
 	} else if strings.HasPrefix(data, "gender:") {
 		gender := strings.Split(data, ":")[1]
 		user.Gender = gender
-		_ = h.UserRepo.Update(user)
+		_ = h.UserRepo.Update(ctx, user)
 		
 		// Jika ini bagian dari onboarding (status masih onboarding/kosong)
 		if user.Status == "onboarding" || user.Preference == "" {
-			h.sendPreferenceSelector(chatID, user.LanguageCode, true, msgID)
+			h.sendPreferenceSelector(ctx, chatID, user.LanguageCode, true, msgID)
 		} else {
-			h.sendUserProfile(chatID, user, true)
+			h.sendUserProfile(ctx, chatID, user, true)
 		}
 
 	} else if strings.HasPrefix(data, "pref:") {
 		pref := strings.Split(data, ":")[1]
 		user.Preference = pref
-		_ = h.UserRepo.Update(user)
+		_ = h.UserRepo.Update(ctx, user)
 		
+		// Onboarding belum selesai sampai tahun lahir diisi (diketik sebagai pesan teks)
+		if user.Status == "onboarding" && user.BirthYear == 0 {
+			h.sendOrEdit(ctx, chatID, h.I18n.Get(user.LanguageCode, "ask_birth_year"), telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{}}, true, msgID)
+			return
+		}
+
 		// Jika selesai onboarding, arahkan ke Menu Utama
 		if user.Status == "onboarding" {
 			// Update status biar ga dianggap onboarding lagi
-			user.Status = "idle"
-			_ = h.UserRepo.Update(user)
+			h.setStatus(ctx, user, "idle")
 			
-			_, _ = h.Bot.SendMessage(chatID, h.I18n.Get(user.LanguageCode, "setup_complete"))
+			_, _ = h.Bot.SendMessage(ctx, chatID, h.I18n.Get(user.LanguageCode, "setup_complete"))
 			
 			// Hapus selector lama, kirim menu utama baru
-			_ = h.Bot.DeleteMessage(chatID, msgID)
-			h.sendMainMenu(chatID, user, false, 0)
+			_ = h.Bot.DeleteMessage(ctx, chatID, msgID)
+			h.sendMainMenu(ctx, chatID, user, false, 0)
 		} else {
-			h.sendUserProfile(chatID, user, true)
+			h.sendUserProfile(ctx, chatID, user, true)
 		}
 
 	} else if strings.HasPrefix(data, "mood:") {
 		mood := strings.Split(data, ":")[1]
+		if mood == "dating" && !user.IsAdult() {
+			_, _ = h.Bot.SendMessage(ctx, chatID, h.I18n.Get(user.LanguageCode, "dating_adults_only"))
+			return
+		}
+		// Tombol mood lama yang ditekan saat sedang chat tidak boleh memutus chat
+		if user.Status == "chatting" {
+			return
+		}
 		user.CurrentMood = mood
-		user.Status = "queue"
-		user.PartnerID = 0
-		_ = h.UserRepo.Update(user)
+		user.LastMessageID = msgID // Pesan ini jadi "Searching...", dihapus saat match
+		_ = h.UserRepo.Update(ctx, user)
+		if !h.setStatus(ctx, user, "queue") {
+			return
+		}
 		
 		cancelBtn := []telegram.InlineKeyboardButton{
 			{Text: "❌ Cancel / Stop", CallbackData: "cmd:stop"},
@@ -1116,33 +2114,36 @@ func (h *BotHandler) handleCallback(cb *telegram.CallbackQuery) {
 		searchText := fmt.Sprintf(h.I18n.Get(user.LanguageCode, "joined_queue"), mood)
 		searchText += "\n\n⏳ <i>Looking for a perfect match...</i>"
 		
-		_ = h.Bot.EditMessageText(chatID, msgID, searchText, cancelMarkup)
+		_ = h.Bot.EditMessageText(ctx, chatID, msgID, searchText, cancelMarkup)
+
+		// Langsung cari pasangan di antrian memori
+		h.Matchmaker.Enqueue(ctx, user)
 	}
 }
 
-func (h *BotHandler) sendRequest(req telegram.SendMessageRequest) {
-	_, _ = h.Bot.SendMessageComplex(req)
+func (h *BotHandler) sendRequest(ctx context.Context, req telegram.SendMessageRequest) {
+	_, _ = h.Bot.SendMessageComplex(ctx, req)
 }
 
 // [BARU] Fungsi Meminta Izin Reveal
-func (h *BotHandler) handleRevealRequest(sender *core.User) {
+func (h *BotHandler) handleRevealRequest(ctx context.Context, sender *core.User) {
 	// 1. Cek apakah sedang chatting
 	if sender.Status != "chatting" || sender.PartnerID == 0 {
-		_, _ = h.Bot.SendMessage(sender.TelegramID, "⚠️ You are not in a chat.")
+		_, _ = h.Bot.SendMessage(ctx, sender.TelegramID, "⚠️ You are not in a chat.")
 		return
 	}
 
 	// 2. Cek apakah pengirim punya username
 	if sender.Username == "" {
-		_, _ = h.Bot.SendMessage(sender.TelegramID, h.I18n.Get(sender.LanguageCode, "share_error_no_username"))
+		_, _ = h.Bot.SendMessage(ctx, sender.TelegramID, h.I18n.Get(sender.LanguageCode, "share_error_no_username"))
 		return
 	}
 
 	// 3. Kirim Konfirmasi ke Pengirim
-	_, _ = h.Bot.SendMessage(sender.TelegramID, h.I18n.Get(sender.LanguageCode, "share_request_sent"))
+	_, _ = h.Bot.SendMessage(ctx, sender.TelegramID, h.I18n.Get(sender.LanguageCode, "share_request_sent"))
 
 	// 4. Kirim Permintaan ke Partner
-	partner, err := h.UserRepo.GetByTelegramID(sender.PartnerID)
+	partner, err := h.UserRepo.GetByTelegramID(ctx, sender.PartnerID)
 	if err != nil || partner == nil { return }
 
 	msgText := h.I18n.Get(partner.LanguageCode, "share_request_received")
@@ -1154,13 +2155,13 @@ func (h *BotHandler) handleRevealRequest(sender *core.User) {
 			},
 		},
 	}
-	_, _ = h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+	_, _ = h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 		ChatID: partner.TelegramID, Text: msgText, ReplyMarkup: keyboard, ParseMode: "HTML",
 	})
 }
 
 // [BARU] Fungsi Eksekusi Tukar Kontak
-func (h *BotHandler) executeReveal(accepter *core.User) {
+func (h *BotHandler) executeReveal(ctx context.Context, accepter *core.User) {
 	// Accepter adalah orang yang mengklik "Accept"
 	
 	// 1. Cek validitas chat
@@ -1168,27 +2169,27 @@ func (h *BotHandler) executeReveal(accepter *core.User) {
 		return
 	}
 
-	requester, err := h.UserRepo.GetByTelegramID(accepter.PartnerID)
+	requester, err := h.UserRepo.GetByTelegramID(ctx, accepter.PartnerID)
 	if err != nil || requester == nil { return }
 
 	// 2. Cek Username (Double Check)
 	if accepter.Username == "" || requester.Username == "" {
 		errMsg := h.I18n.Get(accepter.LanguageCode, "share_error_no_username")
-		_, _ = h.Bot.SendMessage(accepter.TelegramID, errMsg)
-		_, _ = h.Bot.SendMessage(requester.TelegramID, errMsg)
+		_, _ = h.Bot.SendMessage(ctx, accepter.TelegramID, errMsg)
+		_, _ = h.Bot.SendMessage(ctx, requester.TelegramID, errMsg)
 		return
 	}
 
 	// 3. Kirim Kontak Requester ke Accepter
 	msgToAccepter := fmt.Sprintf(h.I18n.Get(accepter.LanguageCode, "share_accepted_us"), requester.FirstName, requester.Username)
-	_, _ = h.Bot.SendMessage(accepter.TelegramID, msgToAccepter)
+	_, _ = h.Bot.SendMessage(ctx, accepter.TelegramID, msgToAccepter)
 
 	// 4. Kirim Kontak Accepter ke Requester
 	msgToRequester := fmt.Sprintf(h.I18n.Get(requester.LanguageCode, "share_accepted_us"), accepter.FirstName, accepter.Username)
-	_, _ = h.Bot.SendMessage(requester.TelegramID, msgToRequester)
+	_, _ = h.Bot.SendMessage(ctx, requester.TelegramID, msgToRequester)
 }
 
-func (h *BotHandler) handleNext(initiator *core.User) {
+func (h *BotHandler) handleNext(ctx context.Context, initiator *core.User) {
 	// 1. Jika User IDLE (Gak ngapa-ngapain)
 	if initiator.Status == "idle" {
 		// UPDATE: Jika user mengetik /next saat idle (biasanya karena diputus partner duluan),
@@ -1196,9 +2197,15 @@ func (h *BotHandler) handleNext(initiator *core.User) {
 		// Ini memperbaiki bug di mana user B stuck di menu saat user A menekan /next duluan.
 		
 		if initiator.CurrentMood != "" {
-			initiator.Status = "queue"
-			initiator.PartnerID = 0
-			_ = h.UserRepo.Update(initiator)
+			// Mood terakhir dating hanya boleh diulang oleh user dewasa (umur bisa diubah sejak chat terakhir)
+			if initiator.CurrentMood == "dating" && !initiator.IsAdult() {
+				_, _ = h.Bot.SendMessage(ctx, initiator.TelegramID, h.I18n.Get(initiator.LanguageCode, "dating_adults_only"))
+				h.sendMoodSelector(ctx, initiator.TelegramID, initiator.LanguageCode, false, 0)
+				return
+			}
+			if !h.setStatus(ctx, initiator, "queue") {
+				return
+			}
 
 			// Kirim pesan searching
 			cancelBtn := []telegram.InlineKeyboardButton{
@@ -1213,21 +2220,23 @@ func (h *BotHandler) handleNext(initiator *core.User) {
 			
 			// Jika ada pesan terakhir (misal menu mood dari pemutusan sebelumnya), edit saja biar rapi
 			if initiator.LastMessageID != 0 {
-				_ = h.Bot.EditMessageText(initiator.TelegramID, initiator.LastMessageID, searchText, cancelMarkup)
+				_ = h.Bot.EditMessageText(ctx, initiator.TelegramID, initiator.LastMessageID, searchText, cancelMarkup)
 			} else {
-				msgID, _ := h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+				msgID, _ := h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 					ChatID: initiator.TelegramID, Text: searchText, ReplyMarkup: cancelMarkup, ParseMode: "HTML",
 				})
 				if msgID != 0 {
 					initiator.LastMessageID = msgID
-					_ = h.UserRepo.Update(initiator)
+					_ = h.UserRepo.Update(ctx, initiator)
 				}
 			}
+
+			h.Matchmaker.Enqueue(ctx, initiator)
 			return
 		}
 
 		// Jika mood kosong (user baru banget atau error), baru tampilkan menu
-		h.sendMoodSelector(initiator.TelegramID, initiator.LanguageCode, false, 0)
+		h.sendMoodSelector(ctx, initiator.TelegramID, initiator.LanguageCode, false, 0)
 		return
 	}
 
@@ -1244,29 +2253,45 @@ func (h *BotHandler) handleNext(initiator *core.User) {
 		searchText := fmt.Sprintf("⏭ <b>Skipping...</b>\n"+h.I18n.Get(initiator.LanguageCode, "joined_queue"), mood)
 
 		if initiator.LastMessageID != 0 {
-			_ = h.Bot.EditMessageText(initiator.TelegramID, initiator.LastMessageID, searchText, cancelMarkup)
+			_ = h.Bot.EditMessageText(ctx, initiator.TelegramID, initiator.LastMessageID, searchText, cancelMarkup)
 		} else {
-			msgID, _ := h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+			msgID, _ := h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 				ChatID: initiator.TelegramID, Text: searchText, ReplyMarkup: cancelMarkup, ParseMode: "HTML",
 			})
 			if msgID != 0 {
 				initiator.LastMessageID = msgID
-				_ = h.UserRepo.Update(initiator)
+				_ = h.UserRepo.Update(ctx, initiator)
 			}
 		}
 		return
 	}
 
+	// Status lain (mis. sedang mengisi lokasi): tampilkan pilihan mood
+	if initiator.Status != "chatting" {
+		h.sendMoodSelector(ctx, initiator.TelegramID, initiator.LanguageCode, false, 0)
+		return
+	}
+
 	// 3. Jika User CHATTING
 	partnerID := initiator.PartnerID
 	currentMood := initiator.CurrentMood
 
-	// A. Update Initiator (Pelaku Next) -> Langsung masuk QUEUE
-	initiator.LastPartnerID = partnerID
-	initiator.Status = "queue" // Langsung antri lagi
-	initiator.PartnerID = 0
+	// A. Update Initiator (Pelaku Next) -> Langsung masuk QUEUE (compare-and-swap)
+	if !h.releaseChat(ctx, initiator, "queue") {
+		// Partner sudah mengakhiri chat duluan: langsung cari partner baru dari status terbaru
+		if initiator.Status == "idle" {
+			h.handleNext(ctx, initiator)
+		}
+		return
+	}
+
+	session := h.Sessions.End(ctx, initiator.TelegramID, initiator.TelegramID)
+
+	initiator.RememberPartner(partnerID) // Partner ini tidak akan dipasangkan lagi selama cooldown
 	initiator.CurrentMood = currentMood // Pastikan mood tetap sama
-	_ = h.UserRepo.Update(initiator)
+	_ = h.UserRepo.Update(ctx, initiator)
+
+	h.sendRatingPrompt(ctx, initiator, session)
 
 	// Tampilkan Animasi Searching ke Initiator
 	cancelBtn := []telegram.InlineKeyboardButton{
@@ -1278,20 +2303,17 @@ func (h *BotHandler) handleNext(initiator *core.User) {
 
 	searchText := fmt.Sprintf("⏭ <b>Skipping...</b>\n"+h.I18n.Get(initiator.LanguageCode, "joined_queue"), currentMood)
 
-	_, _ = h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+	searchMsgID, _ := h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 		ChatID: initiator.TelegramID, Text: searchText, ReplyMarkup: cancelMarkup, ParseMode: "HTML",
 	})
+	if searchMsgID != 0 {
+		initiator.LastMessageID = searchMsgID
+		_ = h.UserRepo.Update(ctx, initiator)
+	}
 
 	// B. Update Partner (Korban yang di-skip) -> Jadi IDLE
 	if partnerID != 0 {
-		partner, err := h.UserRepo.GetByTelegramID(partnerID)
-		if err == nil && partner != nil && partner.PartnerID == initiator.TelegramID {
-
-			partner.LastPartnerID = initiator.TelegramID
-			partner.Status = "idle"
-			partner.PartnerID = 0
-			_ = h.UserRepo.Update(partner)
-
+		if partner := h.releasePartner(ctx, partnerID, initiator); partner != nil {
 			// Beritahu partner kalau dia ditinggal
 			stopTextPartner := h.I18n.Get(partner.LanguageCode, "partner_left")
 
@@ -1299,22 +2321,28 @@ func (h *BotHandler) handleNext(initiator *core.User) {
 			reconnectBtnPartner := telegram.InlineKeyboardMarkup{
 				InlineKeyboard: [][]telegram.InlineKeyboardButton{
 					{{Text: h.I18n.Get(partner.LanguageCode, "btn_reconnect"), CallbackData: "cmd:reconnect_teaser"}},
+					{{Text: h.I18n.Get(partner.LanguageCode, "btn_block"), CallbackData: "cmd:block"}},
 				},
 			}
-			_, _ = h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+			_, _ = h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 				ChatID: partner.TelegramID, Text: stopTextPartner, ReplyMarkup: reconnectBtnPartner, ParseMode: "HTML",
 			})
 
 			// Kembalikan partner ke menu mood (tapi jika dia ketik /next setelah ini, dia akan masuk if idle di atas)
-			h.sendMoodSelector(partner.TelegramID, partner.LanguageCode, false, 0)
+			h.sendRatingPrompt(ctx, partner, session)
+
+			h.sendMoodSelector(ctx, partner.TelegramID, partner.LanguageCode, false, 0)
 		}
 	}
+
+	// C. Cari partner baru setelah partner lama sudah dilepas
+	h.Matchmaker.Enqueue(ctx, initiator)
 }
 
-func (h *BotHandler) sendGamePanel(user *core.User) {
+func (h *BotHandler) sendGamePanel(ctx context.Context, user *core.User) {
 	if user.PartnerID == 0 {
 		// Pesan error ini juga bisa ditaruh di locales kalau mau, tapi teks ini jarang muncul
-		_, _ = h.Bot.SendMessage(user.TelegramID, "⚠️ Cari partner dulu baru bisa main game!")
+		_, _ = h.Bot.SendMessage(ctx, user.TelegramID, "⚠️ Cari partner dulu baru bisa main game!")
 		return
 	}
 
@@ -1336,7 +2364,7 @@ func (h *BotHandler) sendGamePanel(user *core.User) {
 		},
 	}
 	
-	_, _ = h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+	_, _ = h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 		ChatID: user.TelegramID, Text: text, ReplyMarkup: keyboard, ParseMode: "HTML",
 	})
 }
\ No newline at end of file
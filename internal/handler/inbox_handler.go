@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"otterchatbot/internal/core"
 	"otterchatbot/internal/repository"
@@ -15,12 +16,12 @@ const InviteBannerURL = "https://i.ibb.co.com/C5SFnyx8/Untitled-design-3.png"
 
 type InboxHandler struct {
 	Bot       *telegram.Client
-	InboxRepo *repository.InboxRepository
-	UserRepo  *repository.UserRepository
+	InboxRepo repository.InboxStore
+	UserRepo  repository.UserStore
 	I18n      *i18n.I18nService
 }
 
-func NewInboxHandler(bot *telegram.Client, inboxRepo *repository.InboxRepository, userRepo *repository.UserRepository, i18n *i18n.I18nService) *InboxHandler {
+func NewInboxHandler(bot *telegram.Client, inboxRepo repository.InboxStore, userRepo repository.UserStore, i18n *i18n.I18nService) *InboxHandler {
 	return &InboxHandler{
 		Bot:       bot,
 		InboxRepo: inboxRepo,
@@ -29,16 +30,16 @@ func NewInboxHandler(bot *telegram.Client, inboxRepo *repository.InboxRepository
 	}
 }
 
-func (h *InboxHandler) HandleInlineQuery(query *telegram.InlineQuery) {
+func (h *InboxHandler) HandleInlineQuery(ctx context.Context, query *telegram.InlineQuery) {
 	// Ubah versi cache ke v3 agar memaksa refresh tampilan di HP
 	resultID := fmt.Sprintf("%d_v3", query.From.ID)
-	deepLink := fmt.Sprintf("https://t.me/%s?start=secret_%d", h.Bot.GetBotUsername(), query.From.ID)
+	deepLink := fmt.Sprintf("https://t.me/%s?start=secret_%d", h.Bot.GetBotUsername(ctx), query.From.ID)
 
 	// [LOGIKA BARU] Prioritas Bahasa: Database > HP > Default
 	var lang string
 
 	// 1. Cek Database dulu (Apakah user sudah set /lang?)
-	user, err := h.UserRepo.GetByTelegramID(query.From.ID)
+	user, err := h.UserRepo.GetByTelegramID(ctx, query.From.ID)
 	if err == nil && user != nil {
 		lang = user.LanguageCode
 		log.Printf("👤 [INLINE] User ditemukan di DB. Menggunakan Bahasa DB: '%s'", lang)
@@ -84,10 +85,10 @@ func (h *InboxHandler) HandleInlineQuery(query *telegram.InlineQuery) {
 	}
 
 	results := []interface{}{article}
-	h.Bot.AnswerInlineQuery(query.ID, results)
+	h.Bot.AnswerInlineQuery(ctx, query.ID, results)
 }
 
-func (h *InboxHandler) HandleIncomingSecretMessage(sender *core.User, text string) {
+func (h *InboxHandler) HandleIncomingSecretMessage(ctx context.Context, sender *core.User, text string) {
 	targetID := sender.LastPartnerID 
 
 	msg := &core.InboxMessage{
@@ -96,45 +97,48 @@ func (h *InboxHandler) HandleIncomingSecretMessage(sender *core.User, text strin
 		Message:    text,
 	}
 
-	if err := h.InboxRepo.SaveMessage(msg); err != nil {
-		h.Bot.SendMessage(sender.TelegramID, "❌ System Error.")
+	if err := h.InboxRepo.SaveMessage(ctx, msg); err != nil {
+		h.Bot.SendMessage(ctx, sender.TelegramID, "❌ System Error.")
 		return
 	}
 
-	h.Bot.SendMessage(sender.TelegramID, h.I18n.Get(sender.LanguageCode, "secret_sent_success"))
+	h.Bot.SendMessage(ctx, sender.TelegramID, h.I18n.Get(sender.LanguageCode, "secret_sent_success"))
 
-	sender.Status = "idle"
+	// Keluar dari secret mode lewat compare-and-swap, status tidak ikut disimpan oleh Update
+	if ok, _ := h.UserRepo.SetStatusIf(ctx, sender.TelegramID, "secret_mode", "idle"); ok {
+		sender.Status = "idle"
+	}
 	sender.LastPartnerID = 0 
-	h.UserRepo.Update(sender)
+	h.UserRepo.Update(ctx, sender)
 
-	h.notifyReceiver(targetID)
+	h.notifyReceiver(ctx, targetID)
 }
 
-func (h *InboxHandler) notifyReceiver(targetID int64) {
-	target, err := h.UserRepo.GetByTelegramID(targetID)
+func (h *InboxHandler) notifyReceiver(ctx context.Context, targetID int64) {
+	target, err := h.UserRepo.GetByTelegramID(ctx, targetID)
 	if err != nil || target == nil { return }
 
 	notifText := h.I18n.Get(target.LanguageCode, "secret_received")
-	h.Bot.SendMessage(targetID, notifText)
+	h.Bot.SendMessage(ctx, targetID, notifText)
 }
 
-func (h *InboxHandler) ShowInbox(user *core.User) {
-	messages, err := h.InboxRepo.GetMessagesByReceiver(user.TelegramID)
+func (h *InboxHandler) ShowInbox(ctx context.Context, user *core.User) {
+	messages, err := h.InboxRepo.GetMessagesByReceiver(ctx, user.TelegramID)
 	if err != nil {
-		h.Bot.SendMessage(user.TelegramID, "❌ Error fetching inbox.")
+		h.Bot.SendMessage(ctx, user.TelegramID, "❌ Error fetching inbox.")
 		return
 	}
 
 	lang := user.LanguageCode
 
 	if len(messages) == 0 {
-		h.Bot.SendMessage(user.TelegramID, h.I18n.Get(lang, "inbox_empty"))
+		h.Bot.SendMessage(ctx, user.TelegramID, h.I18n.Get(lang, "inbox_empty"))
 		return
 	}
 
 	// 1. Kirim Header
 	header := fmt.Sprintf(h.I18n.Get(lang, "inbox_header"), len(messages))
-	h.Bot.SendMessage(user.TelegramID, header)
+	h.Bot.SendMessage(ctx, user.TelegramID, header)
 
 	// 2. Loop dan kirim pesan satu per satu dengan tombol PEEK
 	for _, msg := range messages {
@@ -151,7 +155,7 @@ func (h *InboxHandler) ShowInbox(user *core.User) {
 			},
 		}
 
-		h.Bot.SendMessageWithMarkup(user.TelegramID, formattedMsg, keyboard)
+		h.Bot.SendMessageWithMarkup(ctx, user.TelegramID, formattedMsg, keyboard)
 	}
 
 	// 3. Tombol Bersihkan Inbox (Paling Bawah)
@@ -160,10 +164,10 @@ func (h *InboxHandler) ShowInbox(user *core.User) {
 			{{Text: h.I18n.Get(lang, "btn_clear_inbox"), CallbackData: "clear_inbox"}},
 		},
 	}
-	h.Bot.SendMessageWithMarkup(user.TelegramID, "👇", clearKeyboard)
+	h.Bot.SendMessageWithMarkup(ctx, user.TelegramID, "👇", clearKeyboard)
 }
 
-func (h *InboxHandler) HandlePeek(cb *telegram.CallbackQuery, user *core.User) {
+func (h *InboxHandler) HandlePeek(ctx context.Context, cb *telegram.CallbackQuery, user *core.User) {
 	parts := strings.Split(cb.Data, ":")
 	if len(parts) < 2 { return }
 	
@@ -185,21 +189,21 @@ func (h *InboxHandler) HandlePeek(cb *telegram.CallbackQuery, user *core.User) {
 	if !user.IsVIP {
 		alertText := h.I18n.Get(user.LanguageCode, "peek_locked")
 		// [PERBAIKAN] Bersihkan HTML sebelum kirim ke Popup
-		h.Bot.AnswerCallbackQuery(cb.ID, stripHTML(alertText), true) 
+		h.Bot.AnswerCallbackQuery(ctx, cb.ID, stripHTML(alertText), true) 
 		return
 	}
 
 	// 2. Ambil Pesan
-	msg, err := h.InboxRepo.GetMessageByID(msgID)
+	msg, err := h.InboxRepo.GetMessageByID(ctx, msgID)
 	if err != nil || msg == nil {
-		h.Bot.AnswerCallbackQuery(cb.ID, "❌ Message not found.", false)
+		h.Bot.AnswerCallbackQuery(ctx, cb.ID, "❌ Message not found.", false)
 		return
 	}
 
 	// 3. Ambil Info Pengirim
-	sender, err := h.UserRepo.GetByTelegramID(msg.SenderID)
+	sender, err := h.UserRepo.GetByTelegramID(ctx, msg.SenderID)
 	if err != nil || sender == nil {
-		h.Bot.AnswerCallbackQuery(cb.ID, "❌ Sender not found.", false)
+		h.Bot.AnswerCallbackQuery(ctx, cb.ID, "❌ Sender not found.", false)
 		return
 	}
 
@@ -221,21 +225,21 @@ func (h *InboxHandler) HandlePeek(cb *telegram.CallbackQuery, user *core.User) {
 	clueText := fmt.Sprintf(h.I18n.Get(user.LanguageCode, "peek_result"), genderText, maskedName)
 	
 	// [PERBAIKAN] Bersihkan HTML sebelum kirim ke Popup
-	h.Bot.AnswerCallbackQuery(cb.ID, stripHTML(clueText), true)
+	h.Bot.AnswerCallbackQuery(ctx, cb.ID, stripHTML(clueText), true)
 }
 
-func (h *InboxHandler) HandleClear(cb *telegram.CallbackQuery, user *core.User) {
-	_ = h.InboxRepo.DeleteMessagesByReceiver(user.TelegramID)
+func (h *InboxHandler) HandleClear(ctx context.Context, cb *telegram.CallbackQuery, user *core.User) {
+	_ = h.InboxRepo.DeleteMessagesByReceiver(ctx, user.TelegramID)
 	
 	confirmText := h.I18n.Get(user.LanguageCode, "inbox_cleared")
 	// PERBAIKAN: Hapus "_ ="
-	h.Bot.AnswerCallbackQuery(cb.ID, confirmText, true)
+	h.Bot.AnswerCallbackQuery(ctx, cb.ID, confirmText, true)
 	
-	h.Bot.EditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, confirmText, nil)
+	h.Bot.EditMessageText(ctx, cb.Message.Chat.ID, cb.Message.MessageID, confirmText, nil)
 }
 
 // [PERBARUAN] 1. Tahap Tanya: Ubah tombol hapus jadi pertanyaan konfirmasi
-func (h *InboxHandler) HandleAskClear(cb *telegram.CallbackQuery, user *core.User) {
+func (h *InboxHandler) HandleAskClear(ctx context.Context, cb *telegram.CallbackQuery, user *core.User) {
 	// Teks konfirmasi
 	text := h.I18n.Get(user.LanguageCode, "inbox_confirm_text")
 	
@@ -250,25 +254,25 @@ func (h *InboxHandler) HandleAskClear(cb *telegram.CallbackQuery, user *core.Use
 	}
 
 	// Edit pesan tombol tadi menjadi pesan konfirmasi
-	h.Bot.EditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, text, &keyboard)
+	h.Bot.EditMessageText(ctx, cb.Message.Chat.ID, cb.Message.MessageID, text, &keyboard)
 }
 
 // [PERBARUAN] 2. Tahap Eksekusi: Hapus data jika user klik YA
-func (h *InboxHandler) HandleConfirmClear(cb *telegram.CallbackQuery, user *core.User) {
+func (h *InboxHandler) HandleConfirmClear(ctx context.Context, cb *telegram.CallbackQuery, user *core.User) {
 	// Hapus pesan di database
-	_ = h.InboxRepo.DeleteMessagesByReceiver(user.TelegramID)
+	_ = h.InboxRepo.DeleteMessagesByReceiver(ctx, user.TelegramID)
 	
 	confirmText := h.I18n.Get(user.LanguageCode, "inbox_cleared")
 	
 	// Tampilkan Popup Sukses
-	h.Bot.AnswerCallbackQuery(cb.ID, confirmText, true)
+	h.Bot.AnswerCallbackQuery(ctx, cb.ID, confirmText, true)
 	
 	// Ubah pesan konfirmasi jadi status "Telah Dihapus" (Hilangkan tombol)
-	h.Bot.EditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, confirmText, nil)
+	h.Bot.EditMessageText(ctx, cb.Message.Chat.ID, cb.Message.MessageID, confirmText, nil)
 }
 
 // [PERBARUAN] 3. Tahap Batal: Kembalikan tombol seperti semula jika user klik TIDAK
-func (h *InboxHandler) HandleCancelClear(cb *telegram.CallbackQuery, user *core.User) {
+func (h *InboxHandler) HandleCancelClear(ctx context.Context, cb *telegram.CallbackQuery, user *core.User) {
 	// Kembalikan ke tampilan tombol awal (👇 + Tombol Clear)
 	initialText := "👇"
 	
@@ -278,5 +282,5 @@ func (h *InboxHandler) HandleCancelClear(cb *telegram.CallbackQuery, user *core.
 		},
 	}
 
-	h.Bot.EditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, initialText, &keyboard)
+	h.Bot.EditMessageText(ctx, cb.Message.Chat.ID, cb.Message.MessageID, initialText, &keyboard)
 }
\ No newline at end of file
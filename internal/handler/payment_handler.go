@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"otterchatbot/config"
@@ -12,12 +13,12 @@ import (
 
 type PaymentHandler struct {
 	Bot      *telegram.Client
-	UserRepo *repository.UserRepository
+	UserRepo repository.UserStore
 	Config   *config.Config
 	I18n     *i18n.I18nService
 }
 
-func NewPaymentHandler(bot *telegram.Client, userRepo *repository.UserRepository, cfg *config.Config, i18n *i18n.I18nService) *PaymentHandler {
+func NewPaymentHandler(bot *telegram.Client, userRepo repository.UserStore, cfg *config.Config, i18n *i18n.I18nService) *PaymentHandler {
 	return &PaymentHandler{
 		Bot:      bot,
 		UserRepo: userRepo,
@@ -26,7 +27,7 @@ func NewPaymentHandler(bot *telegram.Client, userRepo *repository.UserRepository
 	}
 }
 
-func (h *PaymentHandler) SendVIPInvoice(chatID int64, planID string, lang string) {
+func (h *PaymentHandler) SendVIPInvoice(ctx context.Context, chatID int64, planID string, lang string) {
 	// 1. Cari Paket di Config
 	var selectedPlan *config.VIPPlan
 	for _, plan := range h.Config.VIPPlans {
@@ -38,7 +39,7 @@ func (h *PaymentHandler) SendVIPInvoice(chatID int64, planID string, lang string
 
 	if selectedPlan == nil {
 		log.Printf("Error: Plan ID '%s' not found in pricing.json", planID)
-		_, _ = h.Bot.SendMessage(chatID, "❌ Error: Paket tidak ditemukan di sistem.")
+		_, _ = h.Bot.SendMessage(ctx, chatID, "❌ Error: Paket tidak ditemukan di sistem.")
 		return
 	}
 
@@ -64,17 +65,17 @@ func (h *PaymentHandler) SendVIPInvoice(chatID int64, planID string, lang string
 	}
 
 	// 4. Kirim & Cek Error
-	err := h.Bot.SendInvoice(req)
+	err := h.Bot.SendInvoice(ctx, req)
 	if err != nil {
 		log.Printf("Failed to send invoice: %v", err)
 		// Debugging: Kirim pesan error ke user agar tahu salahnya dimana
 		errorMsg := fmt.Sprintf("❌ Telegram Refused: %v\n\nCheck BotFather > Payments.", err)
-		_, _ = h.Bot.SendMessage(chatID, errorMsg)
+		_, _ = h.Bot.SendMessage(ctx, chatID, errorMsg)
 	}
 }
 
 // HandlePreCheckout (Validasi sebelum bayar)
-func (h *PaymentHandler) HandlePreCheckout(query *telegram.PreCheckoutQuery) {
+func (h *PaymentHandler) HandlePreCheckout(ctx context.Context, query *telegram.PreCheckoutQuery) {
 	isValidPlan := false
 	for _, plan := range h.Config.VIPPlans {
 		if plan.ID == query.InvoicePayload {
@@ -84,21 +85,21 @@ func (h *PaymentHandler) HandlePreCheckout(query *telegram.PreCheckoutQuery) {
 	}
 
 	if !isValidPlan {
-		_ = h.Bot.AnswerPreCheckoutQuery(query.ID, false, "Plan no longer exists.")
+		_ = h.Bot.AnswerPreCheckoutQuery(ctx, query.ID, false, "Plan no longer exists.")
 		return
 	}
 
 	// Terima Transaksi
-	_ = h.Bot.AnswerPreCheckoutQuery(query.ID, true, "")
+	_ = h.Bot.AnswerPreCheckoutQuery(ctx, query.ID, true, "")
 }
 
 // HandleSuccessfulPayment (Aktivasi VIP)
-func (h *PaymentHandler) HandleSuccessfulPayment(msg *telegram.Message) {
+func (h *PaymentHandler) HandleSuccessfulPayment(ctx context.Context, msg *telegram.Message) {
 	payment := msg.SuccessfulPayment
 	telegramID := msg.From.ID
 	chargeID := payment.TelegramPaymentChargeID
 	
-	user, err := h.UserRepo.GetByTelegramID(telegramID)
+	user, err := h.UserRepo.GetByTelegramID(ctx, telegramID)
 	if err != nil || user == nil { return }
 
 	// Security: Anti-Replay
@@ -118,7 +119,7 @@ func (h *PaymentHandler) HandleSuccessfulPayment(msg *telegram.Message) {
 
 	if days == 0 {
 		log.Printf("Unknown plan payload: %s", payment.InvoicePayload)
-		_, _ = h.Bot.SendMessage(telegramID, "⚠️ Error activating VIP. Contact admin.")
+		_, _ = h.Bot.SendMessage(ctx, telegramID, "⚠️ Error activating VIP. Contact admin.")
 		return
 	}
 
@@ -137,14 +138,14 @@ func (h *PaymentHandler) HandleSuccessfulPayment(msg *telegram.Message) {
 	user.VipExpiresAt = &expiry
 	user.LastChargeID = chargeID
 
-	if err := h.UserRepo.Update(user); err != nil {
+	if err := h.UserRepo.Update(ctx, user); err != nil {
 		log.Printf("DB Update Failed: %v", err)
-		_, _ = h.Bot.SendMessage(telegramID, "⚠️ Database error. Contact admin.")
+		_, _ = h.Bot.SendMessage(ctx, telegramID, "⚠️ Database error. Contact admin.")
 		return
 	}
 
 	successMsg := fmt.Sprintf("🌟 <b>PAYMENT SUCCESSFUL!</b>\n\nVIP Active for <b>%d days</b>.\nEnjoy your features!", days)
-	_, _ = h.Bot.SendMessage(telegramID, successMsg)
+	_, _ = h.Bot.SendMessage(ctx, telegramID, successMsg)
 	
 	log.Printf("SUCCESS: User %d bought %d days via Stars.", telegramID, days)
 }
\ No newline at end of file
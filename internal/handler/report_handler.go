@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"otterchatbot/config"
@@ -14,12 +15,12 @@ import (
 
 type ReportHandler struct {
 	Bot      *telegram.Client
-	UserRepo *repository.UserRepository
+	UserRepo repository.UserStore
 	Config   *config.Config
 	I18n     *i18n.I18nService
 }
 
-func NewReportHandler(bot *telegram.Client, repo *repository.UserRepository, cfg *config.Config, i18n *i18n.I18nService) *ReportHandler {
+func NewReportHandler(bot *telegram.Client, repo repository.UserStore, cfg *config.Config, i18n *i18n.I18nService) *ReportHandler {
 	return &ReportHandler{
 		Bot:      bot,
 		UserRepo: repo,
@@ -29,9 +30,9 @@ func NewReportHandler(bot *telegram.Client, repo *repository.UserRepository, cfg
 }
 
 // [PEMBARUAN 5] Menggunakan i18n (Multi-bahasa)
-func (h *ReportHandler) HandleReportCommand(reporter *core.User) {
+func (h *ReportHandler) HandleReportCommand(ctx context.Context, reporter *core.User) {
 	if reporter.PartnerID == 0 {
-		h.Bot.SendMessage(reporter.TelegramID, h.I18n.Get(reporter.LanguageCode, "report_error_no_chat"))
+		h.Bot.SendMessage(ctx, reporter.TelegramID, h.I18n.Get(reporter.LanguageCode, "report_error_no_chat"))
 		return
 	}
 
@@ -47,25 +48,25 @@ func (h *ReportHandler) HandleReportCommand(reporter *core.User) {
 		},
 	}
 
-	h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+	h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 		ChatID: reporter.TelegramID, Text: text, ReplyMarkup: keyboard, ParseMode: "HTML",
 	})
 }
 
-func (h *ReportHandler) HandleReportCallback(reporter *core.User, reasonCode string) {
+func (h *ReportHandler) HandleReportCallback(ctx context.Context, reporter *core.User, reasonCode string) {
 	targetID := reporter.PartnerID
 	if targetID == 0 {
 		targetID = reporter.LastPartnerID
 	}
 
 	if targetID == 0 {
-		h.Bot.SendMessage(reporter.TelegramID, h.I18n.Get(reporter.LanguageCode, "report_error_generic"))
+		h.Bot.SendMessage(ctx, reporter.TelegramID, h.I18n.Get(reporter.LanguageCode, "report_error_generic"))
 		return
 	}
 
-	targetUser, err := h.UserRepo.GetByTelegramID(targetID)
+	targetUser, err := h.UserRepo.GetByTelegramID(ctx, targetID)
 	if err != nil || targetUser == nil {
-		h.Bot.SendMessage(reporter.TelegramID, h.I18n.Get(reporter.LanguageCode, "report_error_generic"))
+		h.Bot.SendMessage(ctx, reporter.TelegramID, h.I18n.Get(reporter.LanguageCode, "report_error_generic"))
 		return
 	}
 
@@ -79,8 +80,13 @@ func (h *ReportHandler) HandleReportCallback(reporter *core.User, reasonCode str
 	reasonText := reasonMap[reasonCode]
 	if reasonText == "" { reasonText = "Other" }
 
+	// User yang dilaporkan otomatis diblokir oleh reporter agar tidak dipasangkan lagi
+	if reporter.Block(targetID) {
+		_ = h.UserRepo.Update(ctx, reporter)
+	}
+
 	// A. Beritahu Reporter (Sesuai bahasa Reporter)
-	h.Bot.SendMessage(reporter.TelegramID, h.I18n.Get(reporter.LanguageCode, "report_sent"))
+	h.Bot.SendMessage(ctx, reporter.TelegramID, h.I18n.Get(reporter.LanguageCode, "report_sent"))
 
 	// B. Kirim ke Semua Admin
 	for _, adminIDStr := range h.Config.AdminIDs {
@@ -112,18 +118,18 @@ func (h *ReportHandler) HandleReportCallback(reporter *core.User, reasonCode str
 			},
 		}
 
-		h.Bot.SendMessageComplex(telegram.SendMessageRequest{
+		h.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 			ChatID: adminID, Text: reportCard, ReplyMarkup: actions, ParseMode: "HTML",
 		})
 	}
 }
 
-func (h *ReportHandler) HandleAdminAction(adminID int64, data string, msgID int) {
+func (h *ReportHandler) HandleAdminAction(ctx context.Context, adminID int64, data string, msgID int) {
 	parts := strings.Split(data, ":")
 	action := parts[1] // ban, warn, dismiss
 
 	if action == "dismiss" {
-		h.Bot.EditMessageText(adminID, msgID, "✅ <b>Report Dismissed.</b> No action taken.", nil)
+		h.Bot.EditMessageText(ctx, adminID, msgID, "✅ <b>Report Dismissed.</b> No action taken.", nil)
 		return
 	}
 
@@ -131,28 +137,33 @@ func (h *ReportHandler) HandleAdminAction(adminID int64, data string, msgID int)
 	targetIDStr := parts[2]
 	targetID, _ := strconv.ParseInt(targetIDStr, 10, 64)
 
-	targetUser, err := h.UserRepo.GetByTelegramID(targetID)
+	targetUser, err := h.UserRepo.GetByTelegramID(ctx, targetID)
 	if err != nil || targetUser == nil {
-		h.Bot.SendMessage(adminID, "❌ User not found.")
+		h.Bot.SendMessage(ctx, adminID, "❌ User not found.")
 		return
 	}
 
 	if action == "ban" {
 		targetUser.IsBanned = true
-		targetUser.Status = "banned"
-		targetUser.PartnerID = 0
-		_ = h.UserRepo.Update(targetUser)
+		_ = h.UserRepo.Update(ctx, targetUser)
+
+		// Status diubah lewat compare-and-swap dari status yang baru dibaca
+		if targetUser.Status == "chatting" {
+			_, _ = h.UserRepo.ReleaseMatch(ctx, targetID, targetUser.PartnerID, "banned")
+		} else {
+			_, _ = h.UserRepo.SetStatusIf(ctx, targetID, targetUser.Status, "banned")
+		}
 
 		// [PEMBARUAN 5] Kirim notifikasi sesuai bahasa Target User
-		h.Bot.SendMessage(targetID, h.I18n.Get(targetUser.LanguageCode, "ban_notification"))
+		h.Bot.SendMessage(ctx, targetID, h.I18n.Get(targetUser.LanguageCode, "ban_notification"))
 
-		h.Bot.EditMessageText(adminID, msgID, fmt.Sprintf("🚫 <b>BANNED!</b>\nUser %s has been banned.", targetUser.FirstName), nil)
+		h.Bot.EditMessageText(ctx, adminID, msgID, fmt.Sprintf("🚫 <b>BANNED!</b>\nUser %s has been banned.", targetUser.FirstName), nil)
 		log.Printf("User %d BANNED by Admin %d", targetID, adminID)
 
 	} else if action == "warn" {
 		// [PEMBARUAN 5] Kirim peringatan sesuai bahasa Target User
-		h.Bot.SendMessage(targetID, h.I18n.Get(targetUser.LanguageCode, "warn_notification"))
+		h.Bot.SendMessage(ctx, targetID, h.I18n.Get(targetUser.LanguageCode, "warn_notification"))
 		
-		h.Bot.EditMessageText(adminID, msgID, fmt.Sprintf("⚠️ <b>Warned!</b>\nWarning sent to %s.", targetUser.FirstName), nil)
+		h.Bot.EditMessageText(ctx, adminID, msgID, fmt.Sprintf("⚠️ <b>Warned!</b>\nWarning sent to %s.", targetUser.FirstName), nil)
 	}
 }
\ No newline at end of file
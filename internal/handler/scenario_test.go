@@ -0,0 +1,579 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"otterchatbot/config"
+	"otterchatbot/internal/core"
+	"otterchatbot/internal/repository"
+	"otterchatbot/internal/service"
+	"otterchatbot/pkg/i18n"
+	"otterchatbot/pkg/telegram"
+	"otterchatbot/pkg/telegram/telegramtest"
+	"otterchatbot/pkg/translate"
+)
+
+// scenario adalah bot lengkap (handler + matchmaker + store memori) yang berbicara dengan Bot API palsu
+type scenario struct {
+	t      *testing.T
+	ctx    context.Context
+	srv    *telegramtest.Server
+	stores *repository.Stores
+	bot    *BotHandler
+	i18n   *i18n.I18nService
+}
+
+var testPlan = config.VIPPlan{ID: "vip_week", Days: 7, Price: 50, TitleKey: "vip_week_title", DescKey: "vip_week_desc"}
+
+func newScenario(t *testing.T) *scenario {
+	t.Helper()
+
+	tr := i18n.NewI18n("en")
+	if err := tr.LoadLanguages("../../locales"); err != nil {
+		t.Fatalf("load locales: %v", err)
+	}
+
+	srv := telegramtest.NewServer(t)
+	client := srv.Client()
+	stores := repository.NewMemoryStores()
+	cfg := &config.Config{DefaultLang: "en", VIPPlans: []config.VIPPlan{testPlan}}
+
+	sessions := service.NewChatSessionService(stores.Sessions)
+	matchmaker := service.NewMatchmakerService(stores.Users, sessions, client, tr)
+	afk := service.NewAFKService(stores.Users, client, tr)
+	bot := NewBotHandler(client, stores.Users, stores.Inbox, tr, cfg, service.NewGameService(), afk, matchmaker, sessions)
+
+	return &scenario{t: t, ctx: context.Background(), srv: srv, stores: stores, bot: bot, i18n: tr}
+}
+
+// send meneruskan update dari server palsu ke handler, seperti dispatcher di main
+func (s *scenario) send(update telegram.Update) {
+	s.bot.HandleUpdate(s.ctx, update)
+}
+
+func (s *scenario) user(telegramID int64) *core.User {
+	s.t.Helper()
+	user, err := s.stores.Users.GetByTelegramID(s.ctx, telegramID)
+	if err != nil || user == nil {
+		s.t.Fatalf("user %d not found: %v", telegramID, err)
+	}
+	return user
+}
+
+func (s *scenario) lastMessage(chatID int64) telegramtest.SentMessage {
+	s.t.Helper()
+	msg, ok := s.srv.LastMessage(chatID)
+	if !ok {
+		s.t.Fatalf("bot never wrote to chat %d", chatID)
+	}
+	return msg
+}
+
+// press menekan tombol dengan callback data tertentu di pesan terakhir yang memilikinya
+func (s *scenario) press(from telegram.User, data string) {
+	s.t.Helper()
+	messages := s.srv.Messages(from.ID)
+	for i := len(messages) - 1; i >= 0; i-- {
+		for _, btn := range messages[i].Buttons() {
+			if btn.CallbackData == data {
+				s.send(s.srv.PressButton(from, messages[i].MessageID, data))
+				return
+			}
+		}
+	}
+	s.t.Fatalf("chat %d has no button %q", from.ID, data)
+}
+
+// onboard menjalankan /start sampai profil lengkap
+func (s *scenario) onboard(from telegram.User, gender string, birthYear string) {
+	s.t.Helper()
+	s.send(s.srv.SendText(from, "/start"))
+	s.press(from, "gender:"+gender)
+	s.press(from, "pref:both")
+	s.send(s.srv.SendText(from, birthYear))
+}
+
+var (
+	alice = telegram.User{ID: 101, FirstName: "Alice", Username: "alice"}
+	bob   = telegram.User{ID: 202, FirstName: "Bob", Username: "bob"}
+)
+
+func TestScenarioOnboarding(t *testing.T) {
+	s := newScenario(t)
+
+	s.send(s.srv.SendText(alice, "/start"))
+	if got := s.user(alice.ID); got.Status != "onboarding" {
+		t.Fatalf("status after /start = %q, want onboarding", got.Status)
+	}
+	if msg := s.lastMessage(alice.ID); msg.Text != s.i18n.Get("en", "ask_gender") {
+		t.Fatalf("first question = %q, want gender selector", msg.Text)
+	}
+
+	s.press(alice, "gender:female")
+	s.press(alice, "pref:both")
+	if msg := s.lastMessage(alice.ID); msg.Text != s.i18n.Get("en", "ask_birth_year") {
+		t.Fatalf("after preference = %q, want birth year question", msg.Text)
+	}
+
+	s.send(s.srv.SendText(alice, "not a year"))
+	if msg := s.lastMessage(alice.ID); msg.Text != s.i18n.Get("en", "birth_year_invalid") {
+		t.Fatalf("invalid year reply = %q", msg.Text)
+	}
+
+	s.send(s.srv.SendText(alice, "1995"))
+	got := s.user(alice.ID)
+	if got.Status != "idle" || got.Gender != "female" || got.Preference != "both" || got.BirthYear != 1995 {
+		t.Fatalf("profile after onboarding = %+v", got)
+	}
+	found := false
+	for _, btn := range s.lastMessage(alice.ID).Buttons() {
+		found = found || btn.CallbackData == "cmd:search"
+	}
+	if !found {
+		t.Fatal("main menu with search button not shown after onboarding")
+	}
+}
+
+func TestScenarioMatchingAndRelay(t *testing.T) {
+	s := newScenario(t)
+	s.onboard(alice, "female", "1995")
+	s.onboard(bob, "male", "1993")
+
+	s.press(alice, "cmd:search")
+	s.press(alice, "mood:fun")
+	if got := s.user(alice.ID); got.Status != "queue" {
+		t.Fatalf("alice status after picking mood = %q, want queue", got.Status)
+	}
+
+	s.press(bob, "cmd:search")
+	s.press(bob, "mood:fun")
+
+	a, b := s.user(alice.ID), s.user(bob.ID)
+	if a.Status != "chatting" || a.PartnerID != bob.ID || b.Status != "chatting" || b.PartnerID != alice.ID {
+		t.Fatalf("not paired: alice=%s/%d bob=%s/%d", a.Status, a.PartnerID, b.Status, b.PartnerID)
+	}
+	for _, id := range []int64{alice.ID, bob.ID} {
+		if msg := s.lastMessage(id); !strings.Contains(msg.Text, s.i18n.Get("en", "match_title")) {
+			t.Fatalf("chat %d did not get a match card: %q", id, msg.Text)
+		}
+	}
+
+	// Pesan teks diteruskan sebagai salinan tanpa identitas pengirim
+	update := s.srv.SendText(alice, "hi bob")
+	s.send(update)
+	relayed := s.lastMessage(bob.ID)
+	if relayed.Text != "hi bob" {
+		t.Fatalf("bob received %q, want relayed text", relayed.Text)
+	}
+
+	// Edit ikut diteruskan ke salinannya
+	s.send(s.srv.EditMessage(alice, update.Message.MessageID, "hi bob!"))
+	edited := s.lastMessage(bob.ID)
+	if edited.MessageID != relayed.MessageID || !edited.Edited || edited.Text != "hi bob!" {
+		t.Fatalf("edit not relayed: %+v", edited)
+	}
+
+	s.send(s.srv.SendText(bob, "/stop"))
+	a, b = s.user(alice.ID), s.user(bob.ID)
+	if a.Status != "idle" || a.PartnerID != 0 || b.Status != "idle" || b.PartnerID != 0 {
+		t.Fatalf("chat not ended: alice=%s/%d bob=%s/%d", a.Status, a.PartnerID, b.Status, b.PartnerID)
+	}
+
+	sentBefore := len(s.srv.Messages(bob.ID))
+	s.send(s.srv.SendText(alice, "anyone there?"))
+	if got := len(s.srv.Messages(bob.ID)); got != sentBefore {
+		t.Fatalf("message relayed after chat ended")
+	}
+}
+
+func TestScenarioPayment(t *testing.T) {
+	s := newScenario(t)
+	s.onboard(alice, "female", "1995")
+
+	s.press(alice, "cmd:vip")
+	s.send(s.srv.PressButton(alice, s.lastMessage(alice.ID).MessageID, "buy:"+testPlan.ID))
+	invoice, ok := s.srv.LastInvoice(alice.ID)
+	if !ok {
+		t.Fatal("no invoice sent")
+	}
+	if invoice.Params["payload"] != testPlan.ID || invoice.Params["currency"] != "XTR" {
+		t.Fatalf("invoice params = %v", invoice.Params)
+	}
+
+	s.send(s.srv.PreCheckout(alice, "XTR", testPlan.Price, "unknown_plan"))
+	s.send(s.srv.PreCheckout(alice, "XTR", testPlan.Price, testPlan.ID))
+	answers := s.srv.PreCheckoutAnswers()
+	if len(answers) != 2 || answers[0].Ok || !answers[1].Ok {
+		t.Fatalf("pre-checkout answers = %+v, want reject unknown plan then accept", answers)
+	}
+
+	s.send(s.srv.SuccessfulPayment(alice, "XTR", testPlan.Price, testPlan.ID, "charge-1"))
+	got := s.user(alice.ID)
+	if !got.IsVIP || got.VipExpiresAt == nil || got.LastChargeID != "charge-1" {
+		t.Fatalf("VIP not activated: %+v", got)
+	}
+	expiry := *got.VipExpiresAt
+	if d := time.Until(expiry); d < 6*24*time.Hour || d > 7*24*time.Hour {
+		t.Fatalf("VIP expires in %v, want about %d days", d, testPlan.Days)
+	}
+
+	// Update pembayaran yang sama dikirim ulang tidak boleh menambah masa VIP
+	s.send(s.srv.SuccessfulPayment(alice, "XTR", testPlan.Price, testPlan.ID, "charge-1"))
+	if got := s.user(alice.ID); !got.VipExpiresAt.Equal(expiry) {
+		t.Fatalf("replayed payment extended VIP to %v", got.VipExpiresAt)
+	}
+}
+
+func TestScenarioReconnectRequiresIdle(t *testing.T) {
+	s := newScenario(t)
+	s.onboard(alice, "female", "1995")
+	s.onboard(bob, "male", "1993")
+
+	vip := s.user(alice.ID)
+	vip.IsVIP = true
+	if err := s.stores.Users.Update(s.ctx, vip); err != nil {
+		t.Fatalf("grant VIP: %v", err)
+	}
+
+	s.press(alice, "cmd:search")
+	s.press(alice, "mood:fun")
+	s.press(bob, "cmd:search")
+	s.press(bob, "mood:fun")
+	s.send(s.srv.SendText(bob, "/stop"))
+
+	// Alice sedang mencari partner baru: reconnect ditolak dan antriannya tidak diganggu
+	s.press(alice, "mood:fun")
+	s.send(s.srv.SendText(alice, "/reconnect"))
+	if a, b := s.user(alice.ID), s.user(bob.ID); a.Status != "queue" || b.Status != "idle" {
+		t.Fatalf("reconnect from queue changed status: alice=%s bob=%s", a.Status, b.Status)
+	}
+
+	s.send(s.srv.SendText(alice, "/stop"))
+
+	// Sisa sesi yang tidak pernah ditutup (mis. bot crash berkali-kali di tengah chat) harus ikut ditutup semua
+	for i, partnerID := range []int64{303, 404} {
+		stale := &core.ChatSession{UserA: alice.ID, UserB: partnerID, Mood: "fun", StartedAt: time.Now().Add(-time.Duration(i+1) * time.Hour)}
+		if err := s.stores.Sessions.CreateSession(s.ctx, stale); err != nil {
+			t.Fatalf("create stale session: %v", err)
+		}
+	}
+
+	s.send(s.srv.SendText(alice, "/reconnect"))
+	a, b := s.user(alice.ID), s.user(bob.ID)
+	if a.Status != "chatting" || a.PartnerID != bob.ID || b.Status != "chatting" || b.PartnerID != alice.ID {
+		t.Fatalf("reconnect failed: alice=%s/%d bob=%s/%d", a.Status, a.PartnerID, b.Status, b.PartnerID)
+	}
+	// Hanya sesi reconnect yang aktif; sesi lama sudah ditutup
+	for id, want := range map[int64]int{alice.ID: 4, bob.ID: 2} {
+		history, err := s.stores.Sessions.GetSessionsByUser(s.ctx, id, 0)
+		if err != nil || len(history) != want {
+			t.Fatalf("sessions of %d = %d, %v; want %d", id, len(history), err, want)
+		}
+		if history[0].Mood != core.SessionMoodReconnect || !history[0].IsActive() {
+			t.Fatalf("latest session of %d is not the reconnect: %+v", id, history[0])
+		}
+		for _, old := range history[1:] {
+			if old.IsActive() {
+				t.Fatalf("session %d of user %d still active after reconnect", old.ID, id)
+			}
+		}
+	}
+}
+
+func TestScenarioDatingRequiresAdult(t *testing.T) {
+	s := newScenario(t)
+	s.onboard(alice, "female", strconv.Itoa(time.Now().Year()-16))
+	refused := s.i18n.Get("en", "dating_adults_only")
+
+	s.press(alice, "cmd:search")
+	s.press(alice, "mood:dating")
+	if got := s.user(alice.ID); got.Status != "idle" || got.CurrentMood == "dating" {
+		t.Fatalf("minor joined dating queue: %s/%s", got.Status, got.CurrentMood)
+	}
+
+	// Mood dating tersisa dari data lama: /next tidak boleh langsung mengantrikan ulang
+	minor := s.user(alice.ID)
+	minor.CurrentMood = "dating"
+	if err := s.stores.Users.Update(s.ctx, minor); err != nil {
+		t.Fatalf("set mood: %v", err)
+	}
+	s.send(s.srv.SendText(alice, "/next"))
+	if got := s.user(alice.ID); got.Status != "idle" {
+		t.Fatalf("/next queued a minor for dating: %s", got.Status)
+	}
+	messages := s.srv.Messages(alice.ID)
+	if len(messages) < 2 || messages[len(messages)-2].Text != refused {
+		t.Fatal("/next did not explain the dating age limit")
+	}
+
+	// Antrian yang dipulihkan dari database juga dicek
+	if ok, err := s.stores.Users.SetStatusIf(s.ctx, alice.ID, "idle", "queue"); !ok || err != nil {
+		t.Fatalf("set queue: %v, %v", ok, err)
+	}
+	s.bot.Matchmaker.Enqueue(s.ctx, s.user(alice.ID))
+	if got := s.user(alice.ID); got.Status != "idle" {
+		t.Fatalf("matchmaker kept a minor in the dating queue: %s", got.Status)
+	}
+	if msg := s.lastMessage(alice.ID); msg.Text != refused {
+		t.Fatalf("matchmaker refusal = %q", msg.Text)
+	}
+}
+
+// stubTranslator menerjemahkan dari kamus kalimat utuh
+type stubTranslator map[string]string
+
+func (t stubTranslator) Translate(ctx context.Context, text string, from string, to string) (string, error) {
+	if translated, ok := t[text]; ok {
+		return translated, nil
+	}
+	return "", translate.ErrUnsupported
+}
+
+// sentEntities membaca ulang entities yang dikirim bot dalam request
+func sentEntities(t *testing.T, msg telegramtest.SentMessage) []telegram.MessageEntity {
+	t.Helper()
+	raw, err := json.Marshal(msg.Params["entities"])
+	if err != nil {
+		t.Fatalf("marshal entities: %v", err)
+	}
+	var entities []telegram.MessageEntity
+	if err := json.Unmarshal(raw, &entities); err != nil {
+		t.Fatalf("unmarshal entities: %v", err)
+	}
+	return entities
+}
+
+func TestScenarioAutoTranslateKeepsFormatting(t *testing.T) {
+	s := newScenario(t)
+	s.bot.Translator = stubTranslator{"hi bob 👋": "halo bob 👋", "hi bob!": "halo bob!"}
+	s.onboard(alice, "female", "1995")
+	s.onboard(bob, "male", "1993")
+
+	s.press(alice, "cmd:search")
+	s.press(alice, "mood:fun")
+	s.press(bob, "cmd:search")
+	s.press(bob, "mood:fun")
+
+	// Bob (VIP) memakai bahasa lain dan menyalakan auto-translate
+	partner := s.user(bob.ID)
+	partner.LanguageCode, partner.IsVIP, partner.AutoTranslate = "id", true, true
+	if err := s.stores.Users.Update(s.ctx, partner); err != nil {
+		t.Fatalf("enable auto-translate: %v", err)
+	}
+
+	bold := telegram.MessageEntity{Type: "bold", Offset: 3, Length: 3}
+	update := s.srv.SendMessage(alice, telegram.Message{Text: "hi bob 👋", Entities: []telegram.MessageEntity{bold}})
+	s.send(update)
+
+	// Emoji dihitung 2 code unit UTF-16: "hi bob 👋\n\n🌐 " = 14
+	relayed := s.lastMessage(bob.ID)
+	want := []telegram.MessageEntity{bold, {Type: "italic", Offset: 14, Length: 11}}
+	if relayed.Text != "hi bob 👋\n\n🌐 halo bob 👋" || relayed.Params["parse_mode"] != nil {
+		t.Fatalf("relayed text = %q (parse_mode %v)", relayed.Text, relayed.Params["parse_mode"])
+	}
+	if got := sentEntities(t, relayed); !reflect.DeepEqual(got, want) {
+		t.Fatalf("relayed entities = %+v, want %+v", got, want)
+	}
+
+	s.send(s.srv.EditMessage(alice, update.Message.MessageID, "hi bob!"))
+	edited := s.lastMessage(bob.ID)
+	want = []telegram.MessageEntity{bold, {Type: "italic", Offset: 12, Length: 9}}
+	if !edited.Edited || edited.Text != "hi bob!\n\n🌐 halo bob!" || edited.Params["parse_mode"] != nil {
+		t.Fatalf("edited copy = %q (parse_mode %v)", edited.Text, edited.Params["parse_mode"])
+	}
+	if got := sentEntities(t, edited); !reflect.DeepEqual(got, want) {
+		t.Fatalf("edited entities = %+v, want %+v", got, want)
+	}
+}
+
+func TestScenarioAutoTranslateFallsBackToOriginal(t *testing.T) {
+	s := newScenario(t)
+	s.bot.Translator = stubTranslator{"hi bob": "halo bob"}
+	s.onboard(alice, "female", "1995")
+	s.onboard(bob, "male", "1993")
+
+	s.press(alice, "cmd:search")
+	s.press(alice, "mood:fun")
+	s.press(bob, "cmd:search")
+	s.press(bob, "mood:fun")
+
+	// Auto-translate belum aktif: pesan diteruskan apa adanya
+	s.send(s.srv.SendText(alice, "hi bob"))
+	if got := s.lastMessage(bob.ID).Text; got != "hi bob" {
+		t.Fatalf("relayed without auto-translate = %q", got)
+	}
+
+	partner := s.user(bob.ID)
+	partner.LanguageCode, partner.IsVIP, partner.AutoTranslate = "id", true, true
+	if err := s.stores.Users.Update(s.ctx, partner); err != nil {
+		t.Fatalf("enable auto-translate: %v", err)
+	}
+
+	// Translator gagal (pasangan/kalimat tidak didukung): pesan asli tetap sampai tanpa terjemahan
+	s.send(s.srv.SendText(alice, "how are you?"))
+	if got := s.lastMessage(bob.ID).Text; got != "how are you?" {
+		t.Fatalf("relayed after failed translation = %q", got)
+	}
+
+	s.send(s.srv.SendText(alice, "hi bob"))
+	if got := s.lastMessage(bob.ID).Text; got != "hi bob\n\n🌐 halo bob" {
+		t.Fatalf("relayed translation = %q", got)
+	}
+}
+
+func TestScenarioSkipsBotBlockedUsers(t *testing.T) {
+	s := newScenario(t)
+	s.onboard(alice, "female", "1995")
+	s.onboard(bob, "male", "1993")
+
+	s.press(bob, "cmd:search")
+	s.press(bob, "mood:fun")
+
+	// Bob memblokir bot saat menunggu di antrian
+	s.srv.BlockBot(bob.ID, true)
+	blocked := s.user(bob.ID)
+	blocked.BotBlocked = true
+	if err := s.stores.Users.Update(s.ctx, blocked); err != nil {
+		t.Fatalf("mark blocked: %v", err)
+	}
+
+	s.press(alice, "cmd:search")
+	s.press(alice, "mood:fun")
+	if a := s.user(alice.ID); a.Status != "queue" || a.PartnerID != 0 {
+		t.Fatalf("alice matched with a user who blocked the bot: %s/%d", a.Status, a.PartnerID)
+	}
+}
+
+// matchAliceAndBob meng-onboard alice & bob lalu memasangkan keduanya
+func (s *scenario) matchAliceAndBob() {
+	s.t.Helper()
+	s.onboard(alice, "female", "1995")
+	s.onboard(bob, "male", "1993")
+	s.press(alice, "cmd:search")
+	s.press(alice, "mood:fun")
+	s.press(bob, "cmd:search")
+	s.press(bob, "mood:fun")
+	if got := s.user(alice.ID); got.Status != "chatting" || got.PartnerID != bob.ID {
+		s.t.Fatalf("alice not matched with bob: %s/%d", got.Status, got.PartnerID)
+	}
+}
+
+// unsend membalas pesan original dengan /unsend
+func (s *scenario) unsend(from telegram.User, original telegram.Update) {
+	s.send(s.srv.SendMessage(from, telegram.Message{Text: "/unsend", ReplyToMessage: original.Message}))
+}
+
+func TestScenarioUnsend(t *testing.T) {
+	s := newScenario(t)
+	s.matchAliceAndBob()
+
+	secret := s.srv.SendText(alice, "oops, wrong chat")
+	s.send(secret)
+	relayed := s.lastMessage(bob.ID)
+
+	// Pesan dari partner tidak bisa ditarik
+	fromBob := s.srv.SendText(bob, "hello")
+	s.send(fromBob)
+	s.unsend(alice, fromBob)
+	if got := s.lastMessage(alice.ID).Text; got != s.i18n.Get("en", "unsend_not_found") {
+		t.Fatalf("unsend partner message = %q", got)
+	}
+
+	s.unsend(alice, secret)
+	if got := s.lastMessage(alice.ID).Text; got != s.i18n.Get("en", "unsend_done") {
+		t.Fatalf("unsend reply = %q", got)
+	}
+	for _, msg := range s.srv.Messages(bob.ID) {
+		if msg.MessageID == relayed.MessageID && !msg.Deleted {
+			t.Fatal("relayed copy still visible to bob")
+		}
+	}
+
+	// Pesan yang sudah ditarik tidak bisa ditarik lagi
+	s.unsend(alice, secret)
+	if got := s.lastMessage(alice.ID).Text; got != s.i18n.Get("en", "unsend_not_found") {
+		t.Fatalf("second unsend = %q", got)
+	}
+}
+
+func TestScenarioUnsendWindow(t *testing.T) {
+	s := newScenario(t)
+	s.bot.UnsendWindow = time.Minute
+	s.matchAliceAndBob()
+
+	old := s.srv.SendText(alice, "sent a while ago")
+	s.send(old)
+	relayed := s.lastMessage(bob.ID)
+
+	// Window diperkecil setelah pesan dikirim: pesannya sekarang sudah kedaluwarsa
+	time.Sleep(2 * time.Millisecond)
+	s.bot.UnsendWindow = time.Millisecond
+	s.unsend(alice, old)
+
+	want := strings.Replace(s.i18n.Get("en", "unsend_expired"), "%d", "0", 1)
+	if got := s.lastMessage(alice.ID).Text; got != want {
+		t.Fatalf("expired unsend = %q, want %q", got, want)
+	}
+	if got := s.lastMessage(bob.ID); got.MessageID != relayed.MessageID || got.Deleted {
+		t.Fatal("expired message was deleted for bob")
+	}
+
+	// Tanpa pesan yang dibalas, /unsend hanya menjelaskan cara pakai
+	s.send(s.srv.SendText(alice, "/unsend"))
+	if got := s.lastMessage(alice.ID).Text; got != s.i18n.Get("en", "unsend_usage") {
+		t.Fatalf("unsend without reply = %q", got)
+	}
+}
+
+func TestScenarioProtectContent(t *testing.T) {
+	s := newScenario(t)
+	s.matchAliceAndBob()
+
+	protected := func(msg telegramtest.SentMessage) bool {
+		return msg.Params["protect_content"] == true
+	}
+
+	// User biasa: tidak diproteksi secara default
+	s.send(s.srv.SendText(alice, "plain"))
+	if protected(s.lastMessage(bob.ID)) {
+		t.Fatal("regular user's message was protected by default")
+	}
+
+	// VIP: diproteksi secara default
+	vip := s.user(alice.ID)
+	vip.IsVIP = true
+	if err := s.stores.Users.Update(s.ctx, vip); err != nil {
+		t.Fatalf("make vip: %v", err)
+	}
+	s.send(s.srv.SendText(alice, "vip"))
+	if !protected(s.lastMessage(bob.ID)) {
+		t.Fatal("VIP message was not protected by default")
+	}
+	receiver := s.user(bob.ID)
+	receiver.AllowMedia = true
+	if err := s.stores.Users.Update(s.ctx, receiver); err != nil {
+		t.Fatalf("allow media: %v", err)
+	}
+	s.send(s.srv.SendMessage(alice, telegram.Message{Photo: []telegram.PhotoSize{{FileID: "photo-1"}}}))
+	if photo := s.lastMessage(bob.ID); photo.Method != "sendPhoto" || !protected(photo) {
+		t.Fatalf("VIP photo = %s, protected %v", photo.Method, protected(photo))
+	}
+
+	// Pilihan eksplisit di profil mengalahkan default VIP
+	off := false
+	vip = s.user(alice.ID)
+	vip.ProtectContent = &off
+	if err := s.stores.Users.Update(s.ctx, vip); err != nil {
+		t.Fatalf("disable protection: %v", err)
+	}
+	s.send(s.srv.SendText(alice, "unprotected"))
+	if protected(s.lastMessage(bob.ID)) {
+		t.Fatal("message protected after the user turned protection off")
+	}
+}
@@ -1,13 +1,14 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"otterchatbot/internal/core"
 	"otterchatbot/pkg/database"
-	"sort" 
 )
 
+// InboxRepository adalah implementasi InboxStore di atas Supabase
 type InboxRepository struct {
 	DB *database.DB
 }
@@ -16,9 +17,9 @@ func NewInboxRepository(db *database.DB) *InboxRepository {
 	return &InboxRepository{DB: db}
 }
 
-func (r *InboxRepository) SaveMessage(msg *core.InboxMessage) error {
+func (r *InboxRepository) SaveMessage(ctx context.Context, msg *core.InboxMessage) error {
 	var results []core.InboxMessage
-	err := r.DB.Client.DB.From("inbox_messages").Insert(msg).Execute(&results)
+	err := r.DB.Client.DB.From("inbox_messages").Insert(msg).ExecuteWithContext(ctx, &results)
 	if err != nil {
 		log.Printf("Failed to insert inbox message: %v", err)
 		return err
@@ -26,7 +27,7 @@ func (r *InboxRepository) SaveMessage(msg *core.InboxMessage) error {
 	return nil
 }
 
-func (r *InboxRepository) GetMessagesByReceiver(receiverID int64) ([]core.InboxMessage, error) {
+func (r *InboxRepository) GetMessagesByReceiver(ctx context.Context, receiverID int64) ([]core.InboxMessage, error) {
 	var messages []core.InboxMessage
 	idStr := fmt.Sprintf("%d", receiverID)
 	
@@ -34,7 +35,7 @@ func (r *InboxRepository) GetMessagesByReceiver(receiverID int64) ([]core.InboxM
 	err := r.DB.Client.DB.From("inbox_messages").
 		Select("*").
 		Eq("receiver_id", idStr).
-		Execute(&messages)
+		ExecuteWithContext(ctx, &messages)
 
 	if err != nil {
 		return nil, err
@@ -42,35 +43,33 @@ func (r *InboxRepository) GetMessagesByReceiver(receiverID int64) ([]core.InboxM
 
 	// PEMBARUAN: Lakukan sorting manual di Go (Lebih aman)
 	// Urutkan dari yang Terlama (index 0) ke Terbaru
-	sort.Slice(messages, func(i, j int) bool {
-		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
-	})
+	sortInbox(messages)
 
 	return messages, nil
 }
 
-func (r *InboxRepository) DeleteMessagesByReceiver(receiverID int64) error {
+func (r *InboxRepository) DeleteMessagesByReceiver(ctx context.Context, receiverID int64) error {
 	var results []core.InboxMessage
 	idStr := fmt.Sprintf("%d", receiverID)
 	
 	err := r.DB.Client.DB.From("inbox_messages").
 		Delete().
 		Eq("receiver_id", idStr).
-		Execute(&results)
+		ExecuteWithContext(ctx, &results)
 		
 	return err
 }
 
 // Tambahkan fungsi ini di bagian paling bawah file inbox_repo.go
 
-func (r *InboxRepository) GetMessageByID(id int64) (*core.InboxMessage, error) {
+func (r *InboxRepository) GetMessageByID(ctx context.Context, id int64) (*core.InboxMessage, error) {
 	var messages []core.InboxMessage
 	idStr := fmt.Sprintf("%d", id)
 	
 	err := r.DB.Client.DB.From("inbox_messages").
 		Select("*").
 		Eq("id", idStr).
-		Execute(&messages)
+		ExecuteWithContext(ctx, &messages)
 
 	if err != nil {
 		return nil, err
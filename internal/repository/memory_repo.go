@@ -0,0 +1,427 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"otterchatbot/internal/core"
+	"sync"
+	"time"
+)
+
+// MemoryUserRepository adalah implementasi UserStore yang menyimpan data di RAM.
+// Data disimpan sebagai salinan, jadi perubahan pada struct hasil Get tidak tersimpan sebelum Update dipanggil.
+type MemoryUserRepository struct {
+	mu     sync.RWMutex
+	users  map[int64]core.User
+	nextID int64
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users: make(map[int64]core.User),
+	}
+}
+
+func (r *MemoryUserRepository) GetByTelegramID(ctx context.Context, telegramID int64) (*core.User, error) {
+	r.mu.RLock()
+	stored, ok := r.users[telegramID]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	user := stored
+	if expireVIP(&user) {
+		_ = r.Update(ctx, &user)
+		log.Printf("User %d VIP expired and has been downgraded.", user.TelegramID)
+	}
+
+	// Format lokasi lama ("🇮🇩 Indonesia") disimpan ulang sebagai kode negara
+	if user.MigrateLocation() {
+		_ = r.Update(ctx, &user)
+	}
+
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *core.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	user.ID = r.nextID
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	r.users[user.TelegramID] = *user
+	return nil
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, user *core.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Sama seperti Supabase: update user yang belum ada tidak melakukan apa-apa
+	stored, ok := r.users[user.TelegramID]
+	if !ok {
+		return nil
+	}
+
+	// ID & CreatedAt dikelola oleh storage
+	user.ID = stored.ID
+	user.CreatedAt = stored.CreatedAt
+
+	// Status, partner & rating hanya diubah lewat method khususnya
+	updated := *user
+	keepManagedFields(&updated, &stored)
+	r.users[user.TelegramID] = updated
+	return nil
+}
+
+func (r *MemoryUserRepository) GetQueueByMood(ctx context.Context, mood string) ([]core.User, error) {
+	r.mu.RLock()
+	var users []core.User
+	for _, u := range r.users {
+		if u.Status == "queue" && u.CurrentMood == mood {
+			users = append(users, u)
+		}
+	}
+	r.mu.RUnlock()
+
+	migrateLocations(users)
+	sortQueue(users)
+	return users, nil
+}
+
+func (r *MemoryUserRepository) CountAll(ctx context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return int64(len(r.users)), nil
+}
+
+func (r *MemoryUserRepository) GetLiveStats(ctx context.Context) (int, int, int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	chatting, queue, vip := 0, 0, 0
+	for _, u := range r.users {
+		switch u.Status {
+		case "chatting":
+			chatting++
+		case "queue":
+			queue++
+		}
+		if u.IsVIP {
+			vip++
+		}
+	}
+	return chatting, queue, vip
+}
+
+func (r *MemoryUserRepository) GetAllTelegramIDs(ctx context.Context) ([]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]int64, 0, len(r.users))
+	for id := range r.users {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (r *MemoryUserRepository) GetReachableTelegramIDs(ctx context.Context) ([]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]int64, 0, len(r.users))
+	for id, user := range r.users {
+		if !user.BotBlocked {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *MemoryUserRepository) ClaimMatch(ctx context.Context, a, b *core.User, from string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	storedA, okA := r.users[a.TelegramID]
+	storedB, okB := r.users[b.TelegramID]
+	if !okA || !okB || storedA.Status != from || storedB.Status != from {
+		return ErrMatchConflict
+	}
+
+	// Ubah salinan yang tersimpan agar field lain yang mungkin baru berubah tidak tertimpa
+	pairUsers(&storedA, &storedB)
+	r.users[a.TelegramID] = storedA
+	r.users[b.TelegramID] = storedB
+
+	pairUsers(a, b)
+	return nil
+}
+
+func (r *MemoryUserRepository) SetStatusIf(ctx context.Context, telegramID int64, from string, to string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[telegramID]
+	if !ok || stored.Status != from {
+		return false, nil
+	}
+	stored.Status = to
+	stored.PartnerID = 0
+	r.users[telegramID] = stored
+	return true, nil
+}
+
+func (r *MemoryUserRepository) AddRating(ctx context.Context, telegramID int64, rating int, tag string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[telegramID]
+	if !ok {
+		return nil
+	}
+	// Map tag disalin supaya salinan yang sudah dibagikan lewat GetByTelegramID tidak ikut berubah
+	tags := make(map[string]int, len(stored.RatingTags)+1)
+	for k, v := range stored.RatingTags {
+		tags[k] = v
+	}
+	stored.RatingTags = tags
+	stored.AddRating(rating, tag)
+	r.users[telegramID] = stored
+	return nil
+}
+
+func (r *MemoryUserRepository) ReleaseMatch(ctx context.Context, telegramID int64, partnerID int64, to string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[telegramID]
+	if !ok || stored.Status != "chatting" || stored.PartnerID != partnerID {
+		return false, nil
+	}
+	stored.Status = to
+	stored.PartnerID = 0
+	r.users[telegramID] = stored
+	return true, nil
+}
+
+// MemoryInboxRepository adalah implementasi InboxStore yang menyimpan pesan di RAM
+type MemoryInboxRepository struct {
+	mu       sync.RWMutex
+	messages map[int64]core.InboxMessage
+	nextID   int64
+}
+
+func NewMemoryInboxRepository() *MemoryInboxRepository {
+	return &MemoryInboxRepository{
+		messages: make(map[int64]core.InboxMessage),
+	}
+}
+
+func (r *MemoryInboxRepository) SaveMessage(ctx context.Context, msg *core.InboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	msg.ID = r.nextID
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	r.messages[msg.ID] = *msg
+	return nil
+}
+
+func (r *MemoryInboxRepository) GetMessagesByReceiver(ctx context.Context, receiverID int64) ([]core.InboxMessage, error) {
+	r.mu.RLock()
+	var messages []core.InboxMessage
+	for _, m := range r.messages {
+		if m.ReceiverID == receiverID {
+			messages = append(messages, m)
+		}
+	}
+	r.mu.RUnlock()
+
+	sortInbox(messages)
+	return messages, nil
+}
+
+func (r *MemoryInboxRepository) DeleteMessagesByReceiver(ctx context.Context, receiverID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, m := range r.messages {
+		if m.ReceiverID == receiverID {
+			delete(r.messages, id)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryInboxRepository) GetMessageByID(ctx context.Context, id int64) (*core.InboxMessage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	msg, ok := r.messages[id]
+	if !ok {
+		return nil, nil
+	}
+	return &msg, nil
+}
+
+// MemorySessionRepository adalah implementasi SessionStore yang menyimpan sesi di RAM
+type MemorySessionRepository struct {
+	mu       sync.RWMutex
+	sessions map[int64]core.ChatSession
+	nextID   int64
+}
+
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{
+		sessions: make(map[int64]core.ChatSession),
+	}
+}
+
+func (r *MemorySessionRepository) CreateSession(ctx context.Context, session *core.ChatSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	session.ID = r.nextID
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *MemorySessionRepository) EndSession(ctx context.Context, session *core.ChatSession) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.sessions[session.ID]
+	if !ok {
+		return false, fmt.Errorf("chat session %d not found", session.ID)
+	}
+	if !stored.IsActive() {
+		return false, nil
+	}
+	stored.EndedAt = session.EndedAt
+	stored.EndedBy = session.EndedBy
+	stored.MessagesA = session.MessagesA
+	stored.MessagesB = session.MessagesB
+	r.sessions[session.ID] = stored
+	return true, nil
+}
+
+func (r *MemorySessionRepository) GetActiveSession(ctx context.Context, telegramID int64) (*core.ChatSession, error) {
+	r.mu.RLock()
+	var sessions []core.ChatSession
+	for _, s := range r.sessions {
+		if s.Has(telegramID) && s.IsActive() {
+			sessions = append(sessions, s)
+		}
+	}
+	r.mu.RUnlock()
+
+	return latestSession(sessions), nil
+}
+
+func (r *MemorySessionRepository) GetSessionsByUser(ctx context.Context, telegramID int64, limit int) ([]core.ChatSession, error) {
+	r.mu.RLock()
+	var sessions []core.ChatSession
+	for _, s := range r.sessions {
+		if s.Has(telegramID) {
+			sessions = append(sessions, s)
+		}
+	}
+	r.mu.RUnlock()
+
+	sortSessions(sessions)
+	if limit > 0 && len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+	return sessions, nil
+}
+
+func (r *MemorySessionRepository) GetSession(ctx context.Context, id int64) (*core.ChatSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (r *MemorySessionRepository) RateSession(ctx context.Context, id int64, raterID int64, rating int, tag string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok || !session.Has(raterID) || session.HasRated(raterID) {
+		return false, nil
+	}
+	if session.UserA == raterID {
+		session.RatingA, session.TagA = rating, tag
+	} else {
+		session.RatingB, session.TagB = rating, tag
+	}
+	r.sessions[id] = session
+	return true, nil
+}
+
+// MemoryUpdateRepository adalah implementasi UpdateStore di RAM.
+// Hanya berguna selama proses hidup, jadi tidak melindungi dari restart.
+type MemoryUpdateRepository struct {
+	mu        sync.Mutex
+	offset    int
+	processed map[int]time.Time
+}
+
+func NewMemoryUpdateRepository() *MemoryUpdateRepository {
+	return &MemoryUpdateRepository{
+		processed: make(map[int]time.Time),
+	}
+}
+
+func (r *MemoryUpdateRepository) GetOffset(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.offset, nil
+}
+
+func (r *MemoryUpdateRepository) SaveOffset(ctx context.Context, offset int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.offset = offset
+	return nil
+}
+
+func (r *MemoryUpdateRepository) IsProcessed(ctx context.Context, updateID int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.processed[updateID]
+	return ok, nil
+}
+
+func (r *MemoryUpdateRepository) MarkProcessed(ctx context.Context, updateID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processed[updateID] = time.Now()
+	return nil
+}
+
+func (r *MemoryUpdateRepository) PruneProcessed(ctx context.Context, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, at := range r.processed {
+		if at.Before(before) {
+			delete(r.processed, id)
+		}
+	}
+	return nil
+}
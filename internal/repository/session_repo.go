@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"otterchatbot/internal/core"
+	"otterchatbot/pkg/database"
+)
+
+// SessionRepository adalah implementasi SessionStore di atas Supabase.
+// Butuh tabel chat_sessions, dibuat oleh migrations/008_supabase_chat_sessions.sql.
+type SessionRepository struct {
+	DB *database.DB
+}
+
+func NewSessionRepository(db *database.DB) *SessionRepository {
+	return &SessionRepository{DB: db}
+}
+
+func (r *SessionRepository) CreateSession(ctx context.Context, session *core.ChatSession) error {
+	var results []core.ChatSession
+	err := r.DB.Client.DB.From("chat_sessions").Insert(session).ExecuteWithContext(ctx, &results)
+	if err != nil {
+		log.Printf("Failed to insert chat session: %v", err)
+		return err
+	}
+	if len(results) > 0 {
+		session.ID = results[0].ID
+	}
+	return nil
+}
+
+func (r *SessionRepository) EndSession(ctx context.Context, session *core.ChatSession) (bool, error) {
+	var results []core.ChatSession
+	fields := map[string]interface{}{
+		"ended_at":   session.EndedAt,
+		"ended_by":   session.EndedBy,
+		"messages_a": session.MessagesA,
+		"messages_b": session.MessagesB,
+	}
+	// Conditional update: hanya sesi yang belum diakhiri, jadi sesi tidak ditutup dua kali
+	err := r.DB.Client.DB.From("chat_sessions").
+		Update(fields).
+		Eq("id", fmt.Sprintf("%d", session.ID)).
+		IsNull("ended_at").
+		ExecuteWithContext(ctx, &results)
+	if err != nil {
+		log.Printf("Failed to end chat session %d: %v", session.ID, err)
+		return false, err
+	}
+	return len(results) > 0, nil
+}
+
+func (r *SessionRepository) GetActiveSession(ctx context.Context, telegramID int64) (*core.ChatSession, error) {
+	idStr := fmt.Sprintf("%d", telegramID)
+
+	// User bisa tercatat sebagai user_a atau user_b
+	for _, column := range []string{"user_a", "user_b"} {
+		var sessions []core.ChatSession
+		err := r.DB.Client.DB.From("chat_sessions").
+			Select("*").
+			Eq(column, idStr).
+			IsNull("ended_at").
+			ExecuteWithContext(ctx, &sessions)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching active session: %v", err)
+		}
+		if latest := latestSession(sessions); latest != nil {
+			return latest, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *SessionRepository) GetSessionsByUser(ctx context.Context, telegramID int64, limit int) ([]core.ChatSession, error) {
+	idStr := fmt.Sprintf("%d", telegramID)
+
+	var all []core.ChatSession
+	for _, column := range []string{"user_a", "user_b"} {
+		var sessions []core.ChatSession
+		err := r.DB.Client.DB.From("chat_sessions").
+			Select("*").
+			Eq(column, idStr).
+			ExecuteWithContext(ctx, &sessions)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, sessions...)
+	}
+
+	// Sorting manual di Go (sama seperti antrian & inbox)
+	sortSessions(all)
+	if limit > 0 && len(all) > limit {
+		all = all[:limit]
+	}
+	return all, nil
+}
+
+func (r *SessionRepository) GetSession(ctx context.Context, id int64) (*core.ChatSession, error) {
+	var sessions []core.ChatSession
+	err := r.DB.Client.DB.From("chat_sessions").
+		Select("*").
+		Eq("id", fmt.Sprintf("%d", id)).
+		ExecuteWithContext(ctx, &sessions)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	return &sessions[0], nil
+}
+
+func (r *SessionRepository) RateSession(ctx context.Context, id int64, raterID int64, rating int, tag string) (bool, error) {
+	session, err := r.GetSession(ctx, id)
+	if err != nil || session == nil || !session.Has(raterID) {
+		return false, err
+	}
+
+	ratingCol, tagCol := "rating_b", "tag_b"
+	if session.UserA == raterID {
+		ratingCol, tagCol = "rating_a", "tag_a"
+	}
+
+	// Conditional update: hanya jika kolom rating masih 0, jadi rating ganda tidak tersimpan
+	var results []core.ChatSession
+	err = r.DB.Client.DB.From("chat_sessions").
+		Update(map[string]interface{}{ratingCol: rating, tagCol: tag}).
+		Eq("id", fmt.Sprintf("%d", id)).
+		Eq(ratingCol, "0").
+		ExecuteWithContext(ctx, &results)
+	if err != nil {
+		return false, err
+	}
+	return len(results) > 0, nil
+}
@@ -0,0 +1,580 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"otterchatbot/internal/core"
+	"otterchatbot/pkg/database"
+	"time"
+)
+
+// SQLUserRepository adalah implementasi UserStore di atas SQLite / Postgres lokal.
+// Kolom yang dipakai untuk filter disimpan terpisah, sisanya disimpan utuh sebagai JSON di kolom data
+// supaya field baru di core.User tidak butuh migrasi tabel.
+type SQLUserRepository struct {
+	DB *database.SQLDB
+}
+
+func NewSQLUserRepository(db *database.SQLDB) *SQLUserRepository {
+	return &SQLUserRepository{DB: db}
+}
+
+func (r *SQLUserRepository) scanUsers(rows *sql.Rows) ([]core.User, error) {
+	defer rows.Close()
+
+	var users []core.User
+	for rows.Next() {
+		var id int64
+		var data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+
+		var u core.User
+		if err := json.Unmarshal([]byte(data), &u); err != nil {
+			return nil, fmt.Errorf("corrupt user row %d: %v", id, err)
+		}
+		u.ID = id
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (r *SQLUserRepository) GetByTelegramID(ctx context.Context, telegramID int64) (*core.User, error) {
+	rows, err := r.DB.Conn.QueryContext(ctx, r.DB.Rebind(`SELECT id, data FROM users WHERE telegram_id = ?`), telegramID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching user: %v", err)
+	}
+
+	users, err := r.scanUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching user: %v", err)
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	user := &users[0]
+	if expireVIP(user) {
+		_ = r.Update(ctx, user)
+		log.Printf("User %d VIP expired and has been downgraded.", user.TelegramID)
+	}
+
+	// Format lokasi lama ("🇮🇩 Indonesia") disimpan ulang sebagai kode negara
+	if user.MigrateLocation() {
+		_ = r.Update(ctx, user)
+	}
+
+	return user, nil
+}
+
+func (r *SQLUserRepository) Create(ctx context.Context, user *core.User) error {
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	query := r.DB.Rebind(`INSERT INTO users (telegram_id, status, current_mood, is_vip, data) VALUES (?, ?, ?, ?, ?) RETURNING id`)
+	err = r.DB.Conn.QueryRowContext(ctx, query, user.TelegramID, user.Status, user.CurrentMood, user.IsVIP, string(data)).Scan(&user.ID)
+	if err != nil {
+		log.Printf("Failed to insert user: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLUserRepository) Update(ctx context.Context, user *core.User) error {
+	tx, err := r.DB.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Status, partner & rating hanya diubah lewat method khususnya, jadi diambil dari baris yang tersimpan
+	ok, err := r.updateIf(ctx, tx, user.TelegramID, anyStatus, func(u *core.User) {
+		stored := *u
+		*u = *user
+		keepManagedFields(u, &stored)
+	})
+	if err == nil && ok {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Failed to update user: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLUserRepository) GetQueueByMood(ctx context.Context, mood string) ([]core.User, error) {
+	rows, err := r.DB.Conn.QueryContext(ctx, r.DB.Rebind(`SELECT id, data FROM users WHERE status = ? AND current_mood = ?`), "queue", mood)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := r.scanUsers(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	migrateLocations(users)
+	sortQueue(users)
+	return users, nil
+}
+
+func (r *SQLUserRepository) CountAll(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.DB.Conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&count)
+	return count, err
+}
+
+func (r *SQLUserRepository) GetLiveStats(ctx context.Context) (int, int, int) {
+	var chatting, queue, vip int
+
+	_ = r.DB.Conn.QueryRowContext(ctx, r.DB.Rebind(`SELECT COUNT(*) FROM users WHERE status = ?`), "chatting").Scan(&chatting)
+	_ = r.DB.Conn.QueryRowContext(ctx, r.DB.Rebind(`SELECT COUNT(*) FROM users WHERE status = ?`), "queue").Scan(&queue)
+	_ = r.DB.Conn.QueryRowContext(ctx, r.DB.Rebind(`SELECT COUNT(*) FROM users WHERE is_vip = ?`), true).Scan(&vip)
+
+	return chatting, queue, vip
+}
+
+func (r *SQLUserRepository) GetAllTelegramIDs(ctx context.Context) ([]int64, error) {
+	rows, err := r.DB.Conn.QueryContext(ctx, `SELECT telegram_id FROM users`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetReachableTelegramIDs membaca data lengkap karena bot_blocked hanya tersimpan di kolom JSON
+func (r *SQLUserRepository) GetReachableTelegramIDs(ctx context.Context) ([]int64, error) {
+	rows, err := r.DB.Conn.QueryContext(ctx, `SELECT id, data FROM users`)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := r.scanUsers(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for _, u := range users {
+		if !u.BotBlocked {
+			ids = append(ids, u.TelegramID)
+		}
+	}
+	return ids, nil
+}
+
+// updateIf mengubah user di dalam transaksi hanya jika cond terpenuhi untuk data yang tersimpan.
+// Return false (tanpa error) jika user tidak ada atau cond tidak terpenuhi.
+func (r *SQLUserRepository) updateIf(ctx context.Context, tx *sql.Tx, telegramID int64, cond func(u *core.User) bool, mutate func(u *core.User)) (bool, error) {
+	// Postgres: kunci baris agar data JSON yang dibaca tidak berubah sebelum ditulis ulang.
+	// SQLite tidak butuh (dan tidak mendukung) FOR UPDATE karena hanya ada satu koneksi.
+	lock := ""
+	if r.DB.Driver == "postgres" {
+		lock = " FOR UPDATE"
+	}
+
+	var status, data string
+	err := tx.QueryRowContext(ctx, r.DB.Rebind(`SELECT status, data FROM users WHERE telegram_id = ?`+lock), telegramID).Scan(&status, &data)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var u core.User
+	if err := json.Unmarshal([]byte(data), &u); err != nil {
+		return false, fmt.Errorf("corrupt user row %d: %v", telegramID, err)
+	}
+	u.Status = status
+	if !cond(&u) {
+		return false, nil
+	}
+	mutate(&u)
+
+	updated, err := json.Marshal(u)
+	if err != nil {
+		return false, err
+	}
+
+	query := r.DB.Rebind(`UPDATE users SET status = ?, current_mood = ?, is_vip = ?, data = ? WHERE telegram_id = ? AND status = ?`)
+	res, err := tx.ExecContext(ctx, query, u.Status, u.CurrentMood, u.IsVIP, string(updated), telegramID, status)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// anyStatus adalah cond untuk updateIf yang selalu terpenuhi
+func anyStatus(u *core.User) bool { return true }
+
+// statusIs adalah cond untuk updateIf: status tersimpan harus sama dengan from
+func statusIs(from string) func(u *core.User) bool {
+	return func(u *core.User) bool { return u.Status == from }
+}
+
+func (r *SQLUserRepository) ClaimMatch(ctx context.Context, a, b *core.User, from string) error {
+	tx, err := r.DB.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback tidak berpengaruh jika Commit sudah berhasil
+	defer tx.Rollback()
+
+	okA, err := r.updateIf(ctx, tx, a.TelegramID, statusIs(from), func(u *core.User) {
+		u.Status = "chatting"
+		u.PartnerID = b.TelegramID
+	})
+	if err != nil {
+		return err
+	}
+	if !okA {
+		return ErrMatchConflict
+	}
+
+	okB, err := r.updateIf(ctx, tx, b.TelegramID, statusIs(from), func(u *core.User) {
+		u.Status = "chatting"
+		u.PartnerID = a.TelegramID
+	})
+	if err != nil {
+		return err
+	}
+	if !okB {
+		return ErrMatchConflict
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	pairUsers(a, b)
+	return nil
+}
+
+func (r *SQLUserRepository) SetStatusIf(ctx context.Context, telegramID int64, from string, to string) (bool, error) {
+	tx, err := r.DB.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	ok, err := r.updateIf(ctx, tx, telegramID, statusIs(from), func(u *core.User) {
+		u.Status = to
+		u.PartnerID = 0
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// AddRating membaca & menulis ulang baris di dalam transaksi yang mengunci baris (Postgres) /
+// satu-satunya koneksi (SQLite), jadi tidak ada rating yang hilang walau dikirim bersamaan
+func (r *SQLUserRepository) AddRating(ctx context.Context, telegramID int64, rating int, tag string) error {
+	tx, err := r.DB.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ok, err := r.updateIf(ctx, tx, telegramID, anyStatus, func(u *core.User) {
+		u.AddRating(rating, tag)
+	})
+	if err != nil || !ok {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLUserRepository) ReleaseMatch(ctx context.Context, telegramID int64, partnerID int64, to string) (bool, error) {
+	tx, err := r.DB.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	inChat := func(u *core.User) bool { return u.Status == "chatting" && u.PartnerID == partnerID }
+	ok, err := r.updateIf(ctx, tx, telegramID, inChat, func(u *core.User) {
+		u.Status = to
+		u.PartnerID = 0
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// SQLInboxRepository adalah implementasi InboxStore di atas SQLite / Postgres lokal
+type SQLInboxRepository struct {
+	DB *database.SQLDB
+}
+
+func NewSQLInboxRepository(db *database.SQLDB) *SQLInboxRepository {
+	return &SQLInboxRepository{DB: db}
+}
+
+func (r *SQLInboxRepository) scanMessages(rows *sql.Rows) ([]core.InboxMessage, error) {
+	defer rows.Close()
+
+	var messages []core.InboxMessage
+	for rows.Next() {
+		var m core.InboxMessage
+		var createdAt int64
+		if err := rows.Scan(&m.ID, &m.ReceiverID, &m.SenderID, &m.Message, &m.IsRead, &createdAt); err != nil {
+			return nil, err
+		}
+		m.CreatedAt = time.Unix(0, createdAt)
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (r *SQLInboxRepository) SaveMessage(ctx context.Context, msg *core.InboxMessage) error {
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+
+	query := r.DB.Rebind(`INSERT INTO inbox_messages (receiver_id, sender_id, message, is_read, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id`)
+	err := r.DB.Conn.QueryRowContext(ctx, query, msg.ReceiverID, msg.SenderID, msg.Message, msg.IsRead, msg.CreatedAt.UnixNano()).Scan(&msg.ID)
+	if err != nil {
+		log.Printf("Failed to insert inbox message: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLInboxRepository) GetMessagesByReceiver(ctx context.Context, receiverID int64) ([]core.InboxMessage, error) {
+	query := r.DB.Rebind(`SELECT id, receiver_id, sender_id, message, is_read, created_at FROM inbox_messages WHERE receiver_id = ? ORDER BY created_at`)
+	rows, err := r.DB.Conn.QueryContext(ctx, query, receiverID)
+	if err != nil {
+		return nil, err
+	}
+	return r.scanMessages(rows)
+}
+
+func (r *SQLInboxRepository) DeleteMessagesByReceiver(ctx context.Context, receiverID int64) error {
+	_, err := r.DB.Conn.ExecContext(ctx, r.DB.Rebind(`DELETE FROM inbox_messages WHERE receiver_id = ?`), receiverID)
+	return err
+}
+
+func (r *SQLInboxRepository) GetMessageByID(ctx context.Context, id int64) (*core.InboxMessage, error) {
+	query := r.DB.Rebind(`SELECT id, receiver_id, sender_id, message, is_read, created_at FROM inbox_messages WHERE id = ?`)
+	rows, err := r.DB.Conn.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := r.scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	return &messages[0], nil
+}
+
+// SQLSessionRepository adalah implementasi SessionStore di atas SQLite / Postgres lokal
+type SQLSessionRepository struct {
+	DB *database.SQLDB
+}
+
+func NewSQLSessionRepository(db *database.SQLDB) *SQLSessionRepository {
+	return &SQLSessionRepository{DB: db}
+}
+
+const sessionColumns = `id, user_a, user_b, mood, started_at, ended_at, ended_by, messages_a, messages_b, rating_a, tag_a, rating_b, tag_b`
+
+func (r *SQLSessionRepository) scanSessions(rows *sql.Rows) ([]core.ChatSession, error) {
+	defer rows.Close()
+
+	var sessions []core.ChatSession
+	for rows.Next() {
+		var s core.ChatSession
+		var startedAt int64
+		var endedAt sql.NullInt64
+		if err := rows.Scan(&s.ID, &s.UserA, &s.UserB, &s.Mood, &startedAt, &endedAt, &s.EndedBy, &s.MessagesA, &s.MessagesB, &s.RatingA, &s.TagA, &s.RatingB, &s.TagB); err != nil {
+			return nil, err
+		}
+		s.StartedAt = time.Unix(0, startedAt)
+		if endedAt.Valid {
+			t := time.Unix(0, endedAt.Int64)
+			s.EndedAt = &t
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SQLSessionRepository) CreateSession(ctx context.Context, session *core.ChatSession) error {
+	if session.StartedAt.IsZero() {
+		session.StartedAt = time.Now()
+	}
+
+	query := r.DB.Rebind(`INSERT INTO chat_sessions (user_a, user_b, mood, started_at) VALUES (?, ?, ?, ?) RETURNING id`)
+	err := r.DB.Conn.QueryRowContext(ctx, query, session.UserA, session.UserB, session.Mood, session.StartedAt.UnixNano()).Scan(&session.ID)
+	if err != nil {
+		log.Printf("Failed to insert chat session: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *SQLSessionRepository) EndSession(ctx context.Context, session *core.ChatSession) (bool, error) {
+	var endedAt sql.NullInt64
+	if session.EndedAt != nil {
+		endedAt = sql.NullInt64{Int64: session.EndedAt.UnixNano(), Valid: true}
+	}
+
+	query := r.DB.Rebind(`UPDATE chat_sessions SET ended_at = ?, ended_by = ?, messages_a = ?, messages_b = ? WHERE id = ? AND ended_at IS NULL`)
+	res, err := r.DB.Conn.ExecContext(ctx, query, endedAt, session.EndedBy, session.MessagesA, session.MessagesB, session.ID)
+	if err != nil {
+		log.Printf("Failed to end chat session %d: %v", session.ID, err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *SQLSessionRepository) GetActiveSession(ctx context.Context, telegramID int64) (*core.ChatSession, error) {
+	query := r.DB.Rebind(`SELECT ` + sessionColumns + ` FROM chat_sessions WHERE (user_a = ? OR user_b = ?) AND ended_at IS NULL ORDER BY started_at DESC LIMIT 1`)
+	rows, err := r.DB.Conn.QueryContext(ctx, query, telegramID, telegramID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching active session: %v", err)
+	}
+
+	sessions, err := r.scanSessions(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	return &sessions[0], nil
+}
+
+func (r *SQLSessionRepository) GetSessionsByUser(ctx context.Context, telegramID int64, limit int) ([]core.ChatSession, error) {
+	query := `SELECT ` + sessionColumns + ` FROM chat_sessions WHERE user_a = ? OR user_b = ? ORDER BY started_at DESC`
+	args := []interface{}{telegramID, telegramID}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := r.DB.Conn.QueryContext(ctx, r.DB.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	return r.scanSessions(rows)
+}
+
+func (r *SQLSessionRepository) GetSession(ctx context.Context, id int64) (*core.ChatSession, error) {
+	rows, err := r.DB.Conn.QueryContext(ctx, r.DB.Rebind(`SELECT `+sessionColumns+` FROM chat_sessions WHERE id = ?`), id)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := r.scanSessions(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	return &sessions[0], nil
+}
+
+func (r *SQLSessionRepository) RateSession(ctx context.Context, id int64, raterID int64, rating int, tag string) (bool, error) {
+	// Kondisi rating_x = 0 membuat rating ganda (klik dua kali, update terkirim ulang) tidak tersimpan
+	query := `UPDATE chat_sessions SET rating_a = ?, tag_a = ? WHERE id = ? AND user_a = ? AND rating_a = 0`
+	res, err := r.DB.Conn.ExecContext(ctx, r.DB.Rebind(query), rating, tag, id, raterID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return n == 1, err
+	}
+
+	query = `UPDATE chat_sessions SET rating_b = ?, tag_b = ? WHERE id = ? AND user_b = ? AND rating_b = 0`
+	res, err = r.DB.Conn.ExecContext(ctx, r.DB.Rebind(query), rating, tag, id, raterID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// SQLUpdateRepository adalah implementasi UpdateStore di atas SQLite / Postgres lokal
+type SQLUpdateRepository struct {
+	DB *database.SQLDB
+}
+
+func NewSQLUpdateRepository(db *database.SQLDB) *SQLUpdateRepository {
+	return &SQLUpdateRepository{DB: db}
+}
+
+func (r *SQLUpdateRepository) GetOffset(ctx context.Context) (int, error) {
+	var offset int64
+	err := r.DB.Conn.QueryRowContext(ctx, r.DB.Rebind(`SELECT value FROM bot_state WHERE key = ?`), offsetKey).Scan(&offset)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error fetching offset: %v", err)
+	}
+	return int(offset), nil
+}
+
+func (r *SQLUpdateRepository) SaveOffset(ctx context.Context, offset int) error {
+	query := r.DB.Rebind(`INSERT INTO bot_state (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`)
+	_, err := r.DB.Conn.ExecContext(ctx, query, offsetKey, offset)
+	return err
+}
+
+func (r *SQLUpdateRepository) IsProcessed(ctx context.Context, updateID int) (bool, error) {
+	var count int
+	err := r.DB.Conn.QueryRowContext(ctx, r.DB.Rebind(`SELECT COUNT(*) FROM processed_updates WHERE update_id = ?`), updateID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *SQLUpdateRepository) MarkProcessed(ctx context.Context, updateID int) error {
+	query := r.DB.Rebind(`INSERT INTO processed_updates (update_id, processed_at) VALUES (?, ?) ON CONFLICT (update_id) DO NOTHING`)
+	_, err := r.DB.Conn.ExecContext(ctx, query, updateID, time.Now().UnixNano())
+	return err
+}
+
+func (r *SQLUpdateRepository) PruneProcessed(ctx context.Context, before time.Time) error {
+	_, err := r.DB.Conn.ExecContext(ctx, r.DB.Rebind(`DELETE FROM processed_updates WHERE processed_at < ?`), before.UnixNano())
+	return err
+}
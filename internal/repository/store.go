@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"otterchatbot/internal/core"
+	"otterchatbot/pkg/database"
+	"sort"
+	"time"
+)
+
+// UserStore adalah kontrak penyimpanan data user.
+// Handler & service hanya bergantung pada interface ini, bukan pada backend tertentu.
+type UserStore interface {
+	GetByTelegramID(ctx context.Context, telegramID int64) (*core.User, error)
+	Create(ctx context.Context, user *core.User) error
+	// Update menyimpan semua field user KECUALI status & partner_id (hanya diubah lewat ClaimMatch, SetStatusIf,
+	// dan ReleaseMatch) serta rating yang diterima (hanya lewat AddRating), supaya salinan basi tidak menimpanya.
+	Update(ctx context.Context, user *core.User) error
+	GetQueueByMood(ctx context.Context, mood string) ([]core.User, error)
+	CountAll(ctx context.Context) (int64, error)
+	GetLiveStats(ctx context.Context) (int, int, int)
+	GetAllTelegramIDs(ctx context.Context) ([]int64, error)
+	// GetReachableTelegramIDs seperti GetAllTelegramIDs, tanpa user yang memblokir bot (BotBlocked)
+	GetReachableTelegramIDs(ctx context.Context) ([]int64, error)
+
+	// ClaimMatch memasangkan a & b secara atomik: keduanya jadi "chatting" hanya jika keduanya masih berstatus `from`
+	// ("queue" untuk matchmaker, "idle" untuk /reconnect).
+	// Jika salah satu sudah berubah status, tidak ada yang berubah dan ErrMatchConflict dikembalikan.
+	// Hanya kolom status & partner yang diubah; a & b ikut diperbarui jika berhasil.
+	ClaimMatch(ctx context.Context, a, b *core.User, from string) error
+	// SetStatusIf mengubah status hanya jika status saat ini masih `from` (compare-and-swap) dan mengosongkan partner.
+	// Bukan untuk keluar dari "chatting": pakai ReleaseMatch supaya partner ikut dicek.
+	SetStatusIf(ctx context.Context, telegramID int64, from string, to string) (bool, error)
+	// ReleaseMatch mengakhiri chat dari sisi satu user: status jadi `to` dan partner dikosongkan,
+	// hanya jika user masih "chatting" dengan partnerID. Return false jika chat sudah berakhir / berganti partner.
+	ReleaseMatch(ctx context.Context, telegramID int64, partnerID int64, to string) (bool, error)
+	// AddRating menambah rating (dan tag opsional) yang diterima user secara atomik di database,
+	// tanpa membaca lalu menulis ulang seluruh baris
+	AddRating(ctx context.Context, telegramID int64, rating int, tag string) error
+}
+
+// ErrMatchConflict dikembalikan ClaimMatch jika status salah satu user sudah berubah
+var ErrMatchConflict = errors.New("match conflict: user is no longer available")
+
+// InboxStore adalah kontrak penyimpanan pesan rahasia (Secret Message)
+type InboxStore interface {
+	SaveMessage(ctx context.Context, msg *core.InboxMessage) error
+	GetMessagesByReceiver(ctx context.Context, receiverID int64) ([]core.InboxMessage, error)
+	DeleteMessagesByReceiver(ctx context.Context, receiverID int64) error
+	GetMessageByID(ctx context.Context, id int64) (*core.InboxMessage, error)
+}
+
+// SessionStore menyimpan riwayat sesi chat (siapa dengan siapa, berapa lama, siapa yang mengakhiri)
+type SessionStore interface {
+	// CreateSession menyimpan sesi baru dan mengisi session.ID
+	CreateSession(ctx context.Context, session *core.ChatSession) error
+	// EndSession menyimpan EndedAt, EndedBy, dan jumlah pesan sesi, hanya jika sesi belum diakhiri.
+	// Return false jika sesi sudah ditutup duluan (mis. dua /stop bersamaan), sehingga hanya satu yang menang.
+	EndSession(ctx context.Context, session *core.ChatSession) (bool, error)
+	// GetActiveSession mengambil sesi user yang belum diakhiri (nil jika tidak ada)
+	GetActiveSession(ctx context.Context, telegramID int64) (*core.ChatSession, error)
+	// GetSessionsByUser mengambil riwayat sesi user, terbaru dulu (limit 0 = semua)
+	GetSessionsByUser(ctx context.Context, telegramID int64, limit int) ([]core.ChatSession, error)
+	GetSession(ctx context.Context, id int64) (*core.ChatSession, error)
+	// RateSession menyimpan rating raterID untuk partnernya, hanya jika raterID belum pernah menilai sesi ini.
+	// Return false jika sudah pernah menilai (atau bukan peserta sesi).
+	RateSession(ctx context.Context, id int64, raterID int64, rating int, tag string) (bool, error)
+}
+
+// UpdateStore menyimpan posisi getUpdates (offset) dan daftar update yang sudah diproses.
+// Dipakai untuk at-least-once delivery: offset baru disimpan setelah handler selesai,
+// dan update yang terkirim ulang dilewati berdasarkan UpdateID.
+type UpdateStore interface {
+	GetOffset(ctx context.Context) (int, error)
+	SaveOffset(ctx context.Context, offset int) error
+	IsProcessed(ctx context.Context, updateID int) (bool, error)
+	MarkProcessed(ctx context.Context, updateID int) error
+	// PruneProcessed menghapus catatan update yang diproses sebelum waktu tertentu
+	PruneProcessed(ctx context.Context, before time.Time) error
+}
+
+// Stores mengumpulkan semua store yang dipakai aplikasi dari satu backend yang sama
+type Stores struct {
+	Users    UserStore
+	Inbox    InboxStore
+	Updates  UpdateStore
+	Sessions SessionStore
+}
+
+// NewSupabaseStores memakai Supabase (PostgREST) sebagai backend
+func NewSupabaseStores(db *database.DB) *Stores {
+	return &Stores{
+		Users:    NewUserRepository(db),
+		Inbox:    NewInboxRepository(db),
+		Updates:  NewUpdateRepository(db),
+		Sessions: NewSessionRepository(db),
+	}
+}
+
+// NewMemoryStores menyimpan semua data di RAM (hilang saat restart). Cocok untuk development & test.
+func NewMemoryStores() *Stores {
+	return &Stores{
+		Users:    NewMemoryUserRepository(),
+		Inbox:    NewMemoryInboxRepository(),
+		Updates:  NewMemoryUpdateRepository(),
+		Sessions: NewMemorySessionRepository(),
+	}
+}
+
+// NewSQLStores memakai SQLite / Postgres lokal via database/sql
+func NewSQLStores(db *database.SQLDB) *Stores {
+	return &Stores{
+		Users:    NewSQLUserRepository(db),
+		Inbox:    NewSQLInboxRepository(db),
+		Updates:  NewSQLUpdateRepository(db),
+		Sessions: NewSQLSessionRepository(db),
+	}
+}
+
+// migrateLocations mengubah format lokasi lama di hasil query (tanpa menyimpan ke database)
+func migrateLocations(users []core.User) {
+	for i := range users {
+		users[i].MigrateLocation()
+	}
+}
+
+// expireVIP mencabut status VIP jika masa berlakunya sudah lewat.
+// Return true jika ada perubahan data yang perlu disimpan.
+func expireVIP(user *core.User) bool {
+	// 1. Jika bukan VIP, abaikan
+	if !user.IsVIP {
+		return false
+	}
+
+	// 2. Jika tanggal expired kosong (VIP Seumur Hidup), abaikan
+	if user.VipExpiresAt == nil {
+		return false
+	}
+
+	// 3. Cek apakah Waktu Sekarang > Waktu Expired
+	if time.Now().After(*user.VipExpiresAt) {
+		user.IsVIP = false      // Cabut status VIP
+		user.VipExpiresAt = nil // Hapus tanggalnya
+		return true             // Beri tahu bahwa ada perubahan data
+	}
+
+	return false
+}
+
+// keepManagedFields menyalin field yang tidak boleh diubah Update (status, partner, rating) dari data tersimpan
+func keepManagedFields(user *core.User, stored *core.User) {
+	user.Status = stored.Status
+	user.PartnerID = stored.PartnerID
+	user.RatingUp = stored.RatingUp
+	user.RatingDown = stored.RatingDown
+	user.RatingTags = stored.RatingTags
+}
+
+// pairUsers menandai a & b sedang chatting satu sama lain
+func pairUsers(a, b *core.User) {
+	a.Status = "chatting"
+	a.PartnerID = b.TelegramID
+	b.Status = "chatting"
+	b.PartnerID = a.TelegramID
+}
+
+// sortQueue mengurutkan antrian: VIP dulu, lalu siapa yang mendaftar lebih dulu (ID lebih kecil)
+func sortQueue(users []core.User) {
+	sort.SliceStable(users, func(i, j int) bool {
+		if users[i].IsVIP != users[j].IsVIP {
+			return users[i].IsVIP
+		}
+		return users[i].ID < users[j].ID
+	})
+}
+
+// sortInbox mengurutkan pesan dari yang Terlama (index 0) ke Terbaru
+func sortInbox(messages []core.InboxMessage) {
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+}
+
+// sortSessions mengurutkan sesi dari yang Terbaru (index 0) ke Terlama
+func sortSessions(sessions []core.ChatSession) {
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.After(sessions[j].StartedAt)
+	})
+}
+
+// latestSession mengembalikan sesi yang paling baru dimulai (nil jika kosong)
+func latestSession(sessions []core.ChatSession) *core.ChatSession {
+	if len(sessions) == 0 {
+		return nil
+	}
+	sortSessions(sessions)
+	return &sessions[0]
+}
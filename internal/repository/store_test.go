@@ -0,0 +1,483 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"otterchatbot/internal/core"
+	"otterchatbot/pkg/database"
+)
+
+// backends menjalankan kontrak yang sama untuk setiap implementasi lokal (memory & SQLite)
+var backends = []struct {
+	name string
+	open func(t *testing.T) *Stores
+}{
+	{"memory", func(t *testing.T) *Stores { return NewMemoryStores() }},
+	{"sqlite", func(t *testing.T) *Stores {
+		db, err := database.OpenSQL("sqlite", filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("open sqlite: %v", err)
+		}
+		t.Cleanup(func() { db.Conn.Close() })
+		return NewSQLStores(db)
+	}},
+}
+
+func createUser(t *testing.T, store UserStore, user core.User) *core.User {
+	t.Helper()
+	if err := store.Create(context.Background(), &user); err != nil {
+		t.Fatalf("create user %d: %v", user.TelegramID, err)
+	}
+	return &user
+}
+
+func mustGetUser(t *testing.T, store UserStore, telegramID int64) *core.User {
+	t.Helper()
+	user, err := store.GetByTelegramID(context.Background(), telegramID)
+	if err != nil || user == nil {
+		t.Fatalf("get user %d: %v (user=%v)", telegramID, err, user)
+	}
+	return user
+}
+
+func TestUserStoreCreateUpdate(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			users := b.open(t).Users
+
+			created := createUser(t, users, core.User{TelegramID: 1, FirstName: "Otter", Status: "idle", Interests: []string{"music"}})
+			if created.ID == 0 {
+				t.Fatal("Create did not assign an ID")
+			}
+
+			got := mustGetUser(t, users, 1)
+			if got.FirstName != "Otter" || !got.HasInterest("music") {
+				t.Fatalf("round trip lost fields: %+v", got)
+			}
+
+			got.City = "Jakarta"
+			if err := users.Update(ctx, got); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			if got := mustGetUser(t, users, 1); got.City != "Jakarta" || got.ID != created.ID {
+				t.Fatalf("update not persisted: %+v", got)
+			}
+
+			missing, err := users.GetByTelegramID(ctx, 404)
+			if err != nil || missing != nil {
+				t.Fatalf("missing user: got %v, %v", missing, err)
+			}
+		})
+	}
+}
+
+func TestUserStoreQueueOrder(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			users := b.open(t).Users
+
+			createUser(t, users, core.User{TelegramID: 1, Status: "queue", CurrentMood: "chat"})
+			createUser(t, users, core.User{TelegramID: 2, Status: "queue", CurrentMood: "chat", IsVIP: true})
+			createUser(t, users, core.User{TelegramID: 3, Status: "queue", CurrentMood: "chat"})
+			createUser(t, users, core.User{TelegramID: 4, Status: "queue", CurrentMood: "dating"})
+			createUser(t, users, core.User{TelegramID: 5, Status: "idle", CurrentMood: "chat"})
+
+			queue, err := users.GetQueueByMood(ctx, "chat")
+			if err != nil {
+				t.Fatalf("GetQueueByMood: %v", err)
+			}
+			var ids []int64
+			for _, u := range queue {
+				ids = append(ids, u.TelegramID)
+			}
+			want := []int64{2, 1, 3}
+			if len(ids) != len(want) {
+				t.Fatalf("queue = %v, want %v", ids, want)
+			}
+			for i := range want {
+				if ids[i] != want[i] {
+					t.Fatalf("queue = %v, want %v (VIP first, then FIFO)", ids, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUserStoreReachableTelegramIDs(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			users := b.open(t).Users
+			createUser(t, users, core.User{TelegramID: 1, Status: "idle"})
+			createUser(t, users, core.User{TelegramID: 2, Status: "idle", BotBlocked: true})
+
+			all, err := users.GetAllTelegramIDs(context.Background())
+			if err != nil || len(all) != 2 {
+				t.Fatalf("all ids = %v, %v", all, err)
+			}
+			reachable, err := users.GetReachableTelegramIDs(context.Background())
+			if err != nil || len(reachable) != 1 || reachable[0] != 1 {
+				t.Fatalf("reachable ids = %v, %v; want [1]", reachable, err)
+			}
+		})
+	}
+}
+
+func TestUserStoreClaimMatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		from           string
+		statusA        string
+		statusB        string
+		wantErr        error
+		wantA, wantB   string
+		wantPartnerOfA int64
+	}{
+		{name: "both queued", from: "queue", statusA: "queue", statusB: "queue", wantA: "chatting", wantB: "chatting", wantPartnerOfA: 2},
+		{name: "reconnect both idle", from: "idle", statusA: "idle", statusB: "idle", wantA: "chatting", wantB: "chatting", wantPartnerOfA: 2},
+		{name: "reconnect partner queued", from: "idle", statusA: "idle", statusB: "queue", wantErr: ErrMatchConflict, wantA: "idle", wantB: "queue"},
+		{name: "a left queue", from: "queue", statusA: "idle", statusB: "queue", wantErr: ErrMatchConflict, wantA: "idle", wantB: "queue"},
+		{name: "b already chatting", from: "queue", statusA: "queue", statusB: "chatting", wantErr: ErrMatchConflict, wantA: "queue", wantB: "chatting"},
+	}
+
+	for _, b := range backends {
+		for _, tt := range tests {
+			t.Run(b.name+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				users := b.open(t).Users
+
+				a := createUser(t, users, core.User{TelegramID: 1, Status: tt.statusA, CurrentMood: "chat"})
+				bb := createUser(t, users, core.User{TelegramID: 2, Status: tt.statusB, CurrentMood: "chat"})
+
+				// Field lain yang berubah sejak a dibaca tidak boleh tertimpa oleh ClaimMatch
+				fresh := mustGetUser(t, users, 1)
+				fresh.City = "Bandung"
+				if err := users.Update(ctx, fresh); err != nil {
+					t.Fatalf("update: %v", err)
+				}
+
+				err := users.ClaimMatch(ctx, a, bb, tt.from)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ClaimMatch error = %v, want %v", err, tt.wantErr)
+				}
+
+				gotA, gotB := mustGetUser(t, users, 1), mustGetUser(t, users, 2)
+				if gotA.Status != tt.wantA || gotB.Status != tt.wantB {
+					t.Fatalf("status = %q/%q, want %q/%q", gotA.Status, gotB.Status, tt.wantA, tt.wantB)
+				}
+				if gotA.PartnerID != tt.wantPartnerOfA {
+					t.Fatalf("partner of a = %d, want %d", gotA.PartnerID, tt.wantPartnerOfA)
+				}
+				if gotA.City != "Bandung" {
+					t.Fatalf("ClaimMatch overwrote other fields: city = %q", gotA.City)
+				}
+				if tt.wantErr == nil && (a.Status != "chatting" || a.PartnerID != 2 || bb.PartnerID != 1) {
+					t.Fatalf("ClaimMatch did not update the passed users: %+v %+v", a, bb)
+				}
+			})
+		}
+	}
+}
+
+func TestUserStoreSetStatusIf(t *testing.T) {
+	tests := []struct {
+		name       string
+		from, to   string
+		wantOK     bool
+		wantStatus string
+	}{
+		{name: "matching status", from: "queue", to: "idle", wantOK: true, wantStatus: "idle"},
+		{name: "status changed", from: "chatting", to: "idle", wantOK: false, wantStatus: "queue"},
+	}
+
+	for _, b := range backends {
+		for _, tt := range tests {
+			t.Run(b.name+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				users := b.open(t).Users
+				createUser(t, users, core.User{TelegramID: 1, Status: "queue", CurrentMood: "chat"})
+
+				ok, err := users.SetStatusIf(ctx, 1, tt.from, tt.to)
+				if err != nil || ok != tt.wantOK {
+					t.Fatalf("SetStatusIf = %v, %v; want %v", ok, err, tt.wantOK)
+				}
+				if got := mustGetUser(t, users, 1); got.Status != tt.wantStatus {
+					t.Fatalf("status = %q, want %q", got.Status, tt.wantStatus)
+				}
+
+				if ok, err := users.SetStatusIf(ctx, 404, "queue", "idle"); ok || err != nil {
+					t.Fatalf("SetStatusIf on missing user = %v, %v", ok, err)
+				}
+			})
+		}
+	}
+}
+
+func TestUserStoreUpdateKeepsStatus(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			users := b.open(t).Users
+			createUser(t, users, core.User{TelegramID: 1, Status: "queue", CurrentMood: "chat"})
+			createUser(t, users, core.User{TelegramID: 2, Status: "queue", CurrentMood: "chat"})
+
+			// Salinan basi (masih "queue") disimpan setelah user dipasangkan
+			stale := mustGetUser(t, users, 1)
+			if err := users.ClaimMatch(ctx, mustGetUser(t, users, 1), mustGetUser(t, users, 2), "queue"); err != nil {
+				t.Fatalf("claim: %v", err)
+			}
+			stale.City = "Surabaya"
+			stale.Status = "idle"
+			stale.PartnerID = 0
+			if err := users.Update(ctx, stale); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+
+			got := mustGetUser(t, users, 1)
+			if got.Status != "chatting" || got.PartnerID != 2 {
+				t.Fatalf("Update overwrote status/partner: %s/%d", got.Status, got.PartnerID)
+			}
+			if got.City != "Surabaya" {
+				t.Fatalf("Update lost other fields: city = %q", got.City)
+			}
+			if queued, _ := users.GetQueueByMood(ctx, "chat"); len(queued) != 0 {
+				t.Fatalf("paired users still listed in queue: %d", len(queued))
+			}
+		})
+	}
+}
+
+func TestUserStoreReleaseMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		partnerID  int64
+		to         string
+		wantOK     bool
+		wantStatus string
+	}{
+		{name: "current partner", partnerID: 2, to: "idle", wantOK: true, wantStatus: "idle"},
+		{name: "next re-queues", partnerID: 2, to: "queue", wantOK: true, wantStatus: "queue"},
+		{name: "partner changed", partnerID: 3, to: "idle", wantOK: false, wantStatus: "chatting"},
+	}
+
+	for _, b := range backends {
+		for _, tt := range tests {
+			t.Run(b.name+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				users := b.open(t).Users
+				a := createUser(t, users, core.User{TelegramID: 1, Status: "idle"})
+				bb := createUser(t, users, core.User{TelegramID: 2, Status: "idle"})
+				if err := users.ClaimMatch(ctx, a, bb, "idle"); err != nil {
+					t.Fatalf("claim: %v", err)
+				}
+
+				ok, err := users.ReleaseMatch(ctx, 1, tt.partnerID, tt.to)
+				if err != nil || ok != tt.wantOK {
+					t.Fatalf("ReleaseMatch = %v, %v; want %v", ok, err, tt.wantOK)
+				}
+				got := mustGetUser(t, users, 1)
+				if got.Status != tt.wantStatus {
+					t.Fatalf("status = %q, want %q", got.Status, tt.wantStatus)
+				}
+				if tt.wantOK && got.PartnerID != 0 {
+					t.Fatalf("partner not cleared: %d", got.PartnerID)
+				}
+
+				// Chat yang sudah dilepas tidak bisa dilepas dua kali
+				if tt.wantOK {
+					if ok, err := users.ReleaseMatch(ctx, 1, tt.partnerID, "idle"); ok || err != nil {
+						t.Fatalf("second ReleaseMatch = %v, %v", ok, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestUserStoreAddRating(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			users := b.open(t).Users
+			createUser(t, users, core.User{TelegramID: 1, Status: "idle", City: "Bandung"})
+
+			// Rating yang masuk bersamaan tidak boleh ada yang hilang
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					rating, tag := core.RatingUp, "friendly"
+					if i%2 == 1 {
+						rating, tag = core.RatingDown, ""
+					}
+					if err := users.AddRating(ctx, 1, rating, tag); err != nil {
+						t.Errorf("add rating: %v", err)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			got := mustGetUser(t, users, 1)
+			if got.RatingUp != 5 || got.RatingDown != 5 || got.RatingTags["friendly"] != 5 {
+				t.Fatalf("ratings = +%d -%d tags %v, want +5 -5 friendly:5", got.RatingUp, got.RatingDown, got.RatingTags)
+			}
+			if got.City != "Bandung" || got.Status != "idle" {
+				t.Fatalf("AddRating changed other fields: %+v", got)
+			}
+
+			// Salinan basi yang disimpan lewat Update tidak menghapus rating
+			got.RatingUp, got.RatingDown, got.RatingTags = 0, 0, nil
+			if err := users.Update(ctx, got); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			if got := mustGetUser(t, users, 1); got.RatingUp != 5 || got.RatingTags["friendly"] != 5 {
+				t.Fatalf("Update overwrote ratings: +%d tags %v", got.RatingUp, got.RatingTags)
+			}
+
+			// User yang tidak ada diabaikan
+			if err := users.AddRating(ctx, 99, core.RatingUp, ""); err != nil {
+				t.Fatalf("add rating to unknown user: %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionStoreLifecycle(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			sessions := b.open(t).Sessions
+
+			old := &core.ChatSession{UserA: 1, UserB: 2, Mood: "chat", StartedAt: time.Now().Add(-time.Hour)}
+			if err := sessions.CreateSession(ctx, old); err != nil || old.ID == 0 {
+				t.Fatalf("create: %v (id %d)", err, old.ID)
+			}
+			ended := time.Now().Add(-30 * time.Minute)
+			old.EndedAt, old.EndedBy, old.MessagesA = &ended, 1, 4
+			if ok, err := sessions.EndSession(ctx, old); !ok || err != nil {
+				t.Fatalf("end = %v, %v", ok, err)
+			}
+			// Sesi yang sudah ditutup tidak ditutup ulang (mis. dua /stop bersamaan)
+			again := *old
+			again.EndedBy = 2
+			if ok, err := sessions.EndSession(ctx, &again); ok || err != nil {
+				t.Fatalf("second end = %v, %v; want false", ok, err)
+			}
+
+			current := &core.ChatSession{UserA: 3, UserB: 1, Mood: "dating", StartedAt: time.Now()}
+			if err := sessions.CreateSession(ctx, current); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+
+			active, err := sessions.GetActiveSession(ctx, 1)
+			if err != nil || active == nil || active.ID != current.ID {
+				t.Fatalf("active session = %+v, %v; want %d", active, err, current.ID)
+			}
+
+			history, err := sessions.GetSessionsByUser(ctx, 1, 0)
+			if err != nil || len(history) != 2 || history[0].ID != current.ID {
+				t.Fatalf("history = %+v, %v", history, err)
+			}
+			if history[1].MessagesA != 4 || history[1].EndedBy != 1 || history[1].EndedAt == nil {
+				t.Fatalf("ended session not persisted: %+v", history[1])
+			}
+
+			limited, err := sessions.GetSessionsByUser(ctx, 1, 1)
+			if err != nil || len(limited) != 1 {
+				t.Fatalf("limit 1 = %d sessions, %v", len(limited), err)
+			}
+		})
+	}
+}
+
+func TestSessionStoreRateSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		rater  int64
+		rating int
+		tag    string
+		wantOK bool
+	}{
+		{name: "user a rates", rater: 1, rating: core.RatingUp, tag: "funny", wantOK: true},
+		{name: "user a rates twice", rater: 1, rating: core.RatingDown, wantOK: false},
+		{name: "user b rates", rater: 2, rating: core.RatingDown, tag: "rude", wantOK: true},
+		{name: "outsider", rater: 3, rating: core.RatingUp, wantOK: false},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			sessions := b.open(t).Sessions
+
+			session := &core.ChatSession{UserA: 1, UserB: 2, Mood: "chat", StartedAt: time.Now()}
+			if err := sessions.CreateSession(ctx, session); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+
+			// Berurutan: subtest kedua bergantung pada rating yang tersimpan di subtest pertama
+			for _, tt := range tests {
+				ok, err := sessions.RateSession(ctx, session.ID, tt.rater, tt.rating, tt.tag)
+				if err != nil || ok != tt.wantOK {
+					t.Fatalf("%s: RateSession = %v, %v; want %v", tt.name, ok, err, tt.wantOK)
+				}
+			}
+
+			got, err := sessions.GetSession(ctx, session.ID)
+			if err != nil || got == nil {
+				t.Fatalf("get: %v", err)
+			}
+			if got.RatingA != core.RatingUp || got.TagA != "funny" || got.RatingB != core.RatingDown || got.TagB != "rude" {
+				t.Fatalf("ratings = %+v", got)
+			}
+		})
+	}
+}
+
+func TestUpdateStore(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			updates := b.open(t).Updates
+
+			if offset, err := updates.GetOffset(ctx); err != nil || offset != 0 {
+				t.Fatalf("initial offset = %d, %v", offset, err)
+			}
+			if err := updates.SaveOffset(ctx, 42); err != nil {
+				t.Fatalf("save offset: %v", err)
+			}
+			if err := updates.SaveOffset(ctx, 43); err != nil {
+				t.Fatalf("save offset again: %v", err)
+			}
+			if offset, _ := updates.GetOffset(ctx); offset != 43 {
+				t.Fatalf("offset = %d, want 43", offset)
+			}
+
+			if err := updates.MarkProcessed(ctx, 7); err != nil {
+				t.Fatalf("mark: %v", err)
+			}
+			if err := updates.MarkProcessed(ctx, 7); err != nil {
+				t.Fatalf("mark twice: %v", err)
+			}
+			if done, _ := updates.IsProcessed(ctx, 7); !done {
+				t.Fatal("update 7 should be processed")
+			}
+			if done, _ := updates.IsProcessed(ctx, 8); done {
+				t.Fatal("update 8 should not be processed")
+			}
+
+			if err := updates.PruneProcessed(ctx, time.Now().Add(time.Minute)); err != nil {
+				t.Fatalf("prune: %v", err)
+			}
+			if done, _ := updates.IsProcessed(ctx, 7); done {
+				t.Fatal("update 7 should be pruned")
+			}
+		})
+	}
+}
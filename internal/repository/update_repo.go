@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"otterchatbot/pkg/database"
+	"time"
+)
+
+// offsetKey adalah key di tabel bot_state untuk menyimpan offset getUpdates
+const offsetKey = "updates_offset"
+
+type botStateRow struct {
+	Key   string `json:"key"`
+	Value int64  `json:"value"`
+}
+
+type processedUpdateRow struct {
+	UpdateID    int       `json:"update_id"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// UpdateRepository adalah implementasi UpdateStore di atas Supabase.
+// Butuh tabel bot_state dan processed_updates, dibuat oleh migrations/001_supabase_update_state.sql.
+type UpdateRepository struct {
+	DB *database.DB
+}
+
+func NewUpdateRepository(db *database.DB) *UpdateRepository {
+	return &UpdateRepository{DB: db}
+}
+
+func (r *UpdateRepository) GetOffset(ctx context.Context) (int, error) {
+	var rows []botStateRow
+	err := r.DB.Client.DB.From("bot_state").Select("*").Eq("key", offsetKey).ExecuteWithContext(ctx, &rows)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching offset: %v", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return int(rows[0].Value), nil
+}
+
+func (r *UpdateRepository) SaveOffset(ctx context.Context, offset int) error {
+	var results []botStateRow
+	row := botStateRow{Key: offsetKey, Value: int64(offset)}
+	return r.DB.Client.DB.From("bot_state").Upsert(row).ExecuteWithContext(ctx, &results)
+}
+
+func (r *UpdateRepository) IsProcessed(ctx context.Context, updateID int) (bool, error) {
+	var rows []processedUpdateRow
+	idStr := fmt.Sprintf("%d", updateID)
+
+	err := r.DB.Client.DB.From("processed_updates").Select("*").Eq("update_id", idStr).ExecuteWithContext(ctx, &rows)
+	if err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+func (r *UpdateRepository) MarkProcessed(ctx context.Context, updateID int) error {
+	var results []processedUpdateRow
+	row := processedUpdateRow{UpdateID: updateID, ProcessedAt: time.Now()}
+	// Upsert supaya update yang tercatat dua kali tidak bikin error duplicate key
+	return r.DB.Client.DB.From("processed_updates").Upsert(row).ExecuteWithContext(ctx, &results)
+}
+
+func (r *UpdateRepository) PruneProcessed(ctx context.Context, before time.Time) error {
+	var results []processedUpdateRow
+	return r.DB.Client.DB.From("processed_updates").
+		Delete().
+		Lt("processed_at", before.UTC().Format(time.RFC3339)).
+		ExecuteWithContext(ctx, &results)
+}
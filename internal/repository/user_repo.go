@@ -1,14 +1,18 @@
 package repository
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
-	"sort"
 	"otterchatbot/internal/core"
 	"otterchatbot/pkg/database"
-	"time"
 )
 
+// UserRepository adalah implementasi UserStore di atas Supabase.
+// Semua field core.User harus ada sebagai kolom di tabel users (lihat folder migrations),
+// karena PostgREST menolak Update yang berisi kolom tak dikenal.
 type UserRepository struct {
 	DB *database.DB
 }
@@ -17,12 +21,12 @@ func NewUserRepository(db *database.DB) *UserRepository {
 	return &UserRepository{DB: db}
 }
 
-func (r *UserRepository) GetByTelegramID(telegramID int64) (*core.User, error) {
+func (r *UserRepository) GetByTelegramID(ctx context.Context, telegramID int64) (*core.User, error) {
 	var users []core.User
 	
 	idStr := fmt.Sprintf("%d", telegramID)
 	
-	err := r.DB.Client.DB.From("users").Select("*").Eq("telegram_id", idStr).Execute(&users)
+	err := r.DB.Client.DB.From("users").Select("*").Eq("telegram_id", idStr).ExecuteWithContext(ctx, &users)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching user: %v", err)
 	}
@@ -34,40 +38,23 @@ func (r *UserRepository) GetByTelegramID(telegramID int64) (*core.User, error) {
 	user := &users[0]
 
 	// --- LOGIKA OTOMATIS: Cek Expired VIP ---
-	if r.checkVipExpiration(user) {
+	if expireVIP(user) {
 		// Jika expired, update database sekarang juga
-		_ = r.Update(user)
+		_ = r.Update(ctx, user)
 		log.Printf("User %d VIP expired and has been downgraded.", user.TelegramID)
 	}
 
-	return user, nil
-}
-
-// Fungsi internal untuk mengecek & downgrade VIP
-func (r *UserRepository) checkVipExpiration(user *core.User) bool {
-	// 1. Jika bukan VIP, abaikan
-	if !user.IsVIP {
-		return false
-	}
-
-	// 2. Jika tanggal expired kosong (VIP Seumur Hidup), abaikan
-	if user.VipExpiresAt == nil {
-		return false
+	// Format lokasi lama ("🇮🇩 Indonesia") disimpan ulang sebagai kode negara
+	if user.MigrateLocation() {
+		_ = r.Update(ctx, user)
 	}
 
-	// 3. Cek apakah Waktu Sekarang > Waktu Expired
-	if time.Now().After(*user.VipExpiresAt) {
-		user.IsVIP = false       // Cabut status VIP
-		user.VipExpiresAt = nil  // Hapus tanggalnya
-		return true              // Beri tahu bahwa ada perubahan data
-	}
-
-	return false
+	return user, nil
 }
 
-func (r *UserRepository) Create(user *core.User) error {
+func (r *UserRepository) Create(ctx context.Context, user *core.User) error {
 	var results []core.User
-	err := r.DB.Client.DB.From("users").Insert(user).Execute(&results)
+	err := r.DB.Client.DB.From("users").Insert(user).ExecuteWithContext(ctx, &results)
 	if err != nil {
 		log.Printf("Failed to insert user: %v", err)
 		return err
@@ -75,11 +62,16 @@ func (r *UserRepository) Create(user *core.User) error {
 	return nil
 }
 
-func (r *UserRepository) Update(user *core.User) error {
+func (r *UserRepository) Update(ctx context.Context, user *core.User) error {
+	fields, err := updatableFields(user)
+	if err != nil {
+		return err
+	}
+
 	var results []core.User
 	idStr := fmt.Sprintf("%d", user.TelegramID)
 	// Pastikan field baru ikut terupdate
-	err := r.DB.Client.DB.From("users").Update(user).Eq("telegram_id", idStr).Execute(&results)
+	err = r.DB.Client.DB.From("users").Update(fields).Eq("telegram_id", idStr).ExecuteWithContext(ctx, &results)
 	if err != nil {
 		log.Printf("Failed to update user: %v", err)
 		return err
@@ -87,7 +79,39 @@ func (r *UserRepository) Update(user *core.User) error {
 	return nil
 }
 
-func (r *UserRepository) GetQueueByMood(mood string) ([]core.User, error) {
+// updatableFields mengubah user jadi kolom-kolom untuk PATCH, tanpa status & partner_id
+// (hanya diubah lewat compare-and-swap) dan tanpa kolom rating (hanya lewat AddRating)
+func updatableFields(user *core.User) (map[string]interface{}, error) {
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+
+	// UseNumber supaya telegram_id dll. tidak berubah jadi float
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	for _, column := range []string{"status", "partner_id", "rating_up", "rating_down", "rating_tags"} {
+		delete(fields, column)
+	}
+	return fields, nil
+}
+
+// AddRating memanggil function add_user_rating (migrations/009_supabase_ratings.sql) yang menambah counter dalam satu UPDATE
+func (r *UserRepository) AddRating(ctx context.Context, telegramID int64, rating int, tag string) error {
+	var found bool
+	params := map[string]interface{}{"p_telegram_id": telegramID, "p_rating": rating, "p_tag": tag}
+	if err := r.DB.Client.DB.Rpc("add_user_rating", params).ExecuteWithContext(ctx, &found); err != nil {
+		log.Printf("Failed to add rating for user %d: %v", telegramID, err)
+		return err
+	}
+	return nil
+}
+
+func (r *UserRepository) GetQueueByMood(ctx context.Context, mood string) ([]core.User, error) {
 	var users []core.User
 
 	// 1. Ambil data dari database (Tanpa sorting database untuk menghindari error library)
@@ -95,38 +119,24 @@ func (r *UserRepository) GetQueueByMood(mood string) ([]core.User, error) {
 		Select("*").
 		Eq("status", "queue").
 		Eq("current_mood", mood).
-		Execute(&users)
+		ExecuteWithContext(ctx, &users)
 
 	if err != nil {
 		return nil, err
 	}
 
 	// 2. Lakukan Sorting Manual di Go (Priority Queue Logic)
-	// Aturan:
-	// - VIP selalu di atas (Prioritas Utama)
-	// - Jika sama-sama VIP (atau sama-sama Free), siapa yang antri duluan (Updated/Created At)
-	sort.SliceStable(users, func(i, j int) bool {
-		// Jika i VIP dan j bukan, i lebih dulu (True)
-		if users[i].IsVIP && !users[j].IsVIP {
-			return true
-		}
-		// Jika i bukan VIP dan j VIP, j lebih dulu (False)
-		if !users[i].IsVIP && users[j].IsVIP {
-			return false
-		}
-		
-		// Jika status VIP sama, urutkan berdasarkan waktu update (siapa yang nunggu lebih lama)
-		// Kita asumsikan ID lebih kecil = Mendaftar lebih dulu (Fallback sederhana jika UpdatedAt sama)
-		return users[i].ID < users[j].ID
-	})
+	// Aturan: VIP selalu di atas, lalu siapa yang antri duluan
+	migrateLocations(users)
+	sortQueue(users)
 
 	return users, nil
 }
 
-func (r *UserRepository) CountAll() (int64, error) {
+func (r *UserRepository) CountAll(ctx context.Context) (int64, error) {
 	// FIX: Hapus var count int64 yang tidak terpakai
 	var results []struct{ ID int64 }
-	err := r.DB.Client.DB.From("users").Select("id", "exact").Execute(&results)
+	err := r.DB.Client.DB.From("users").Select("id", "exact").ExecuteWithContext(ctx, &results)
 	if err != nil {
 		return 0, err
 	}
@@ -134,23 +144,23 @@ func (r *UserRepository) CountAll() (int64, error) {
 }
 
 // GetLiveStats mengambil data real-time
-func (r *UserRepository) GetLiveStats() (int, int, int) {
+func (r *UserRepository) GetLiveStats(ctx context.Context) (int, int, int) {
 	var chatting []core.User
 	var queue []core.User
 	var vip []core.User
 
-	_ = r.DB.Client.DB.From("users").Select("*").Eq("status", "chatting").Execute(&chatting)
-	_ = r.DB.Client.DB.From("users").Select("*").Eq("status", "queue").Execute(&queue)
-	_ = r.DB.Client.DB.From("users").Select("*").Eq("is_vip", "true").Execute(&vip)
+	_ = r.DB.Client.DB.From("users").Select("*").Eq("status", "chatting").ExecuteWithContext(ctx, &chatting)
+	_ = r.DB.Client.DB.From("users").Select("*").Eq("status", "queue").ExecuteWithContext(ctx, &queue)
+	_ = r.DB.Client.DB.From("users").Select("*").Eq("is_vip", "true").ExecuteWithContext(ctx, &vip)
 
 	return len(chatting), len(queue), len(vip)
 }
 
 // GetAllTelegramIDs mengambil semua ID user untuk broadcast (Hati-hati, query berat jika user jutaan)
-func (r *UserRepository) GetAllTelegramIDs() ([]int64, error) {
+func (r *UserRepository) GetAllTelegramIDs(ctx context.Context) ([]int64, error) {
 	var users []core.User
 	// Ambil telegram_id saja
-	err := r.DB.Client.DB.From("users").Select("telegram_id").Execute(&users)
+	err := r.DB.Client.DB.From("users").Select("telegram_id").ExecuteWithContext(ctx, &users)
 	if err != nil {
 		return nil, err
 	}
@@ -160,4 +170,89 @@ func (r *UserRepository) GetAllTelegramIDs() ([]int64, error) {
 		ids = append(ids, u.TelegramID)
 	}
 	return ids, nil
-}
\ No newline at end of file
+}
+
+// GetReachableTelegramIDs mengambil ID user yang tidak memblokir bot, untuk broadcast
+func (r *UserRepository) GetReachableTelegramIDs(ctx context.Context) ([]int64, error) {
+	var users []core.User
+	err := r.DB.Client.DB.From("users").Select("telegram_id").Eq("bot_blocked", "false").ExecuteWithContext(ctx, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for _, u := range users {
+		ids = append(ids, u.TelegramID)
+	}
+	return ids, nil
+}
+
+// setStatusIf adalah conditional update PostgREST: PATCH ... WHERE telegram_id = id AND status = from.
+// Baris yang berubah dikembalikan (return=representation), jadi kosong berarti status sudah berubah duluan.
+func (r *UserRepository) setStatusIf(ctx context.Context, telegramID int64, from string, fields map[string]interface{}) (bool, error) {
+	var results []core.User
+	idStr := fmt.Sprintf("%d", telegramID)
+
+	err := r.DB.Client.DB.From("users").
+		Update(fields).
+		Eq("telegram_id", idStr).
+		Eq("status", from).
+		ExecuteWithContext(ctx, &results)
+	if err != nil {
+		return false, err
+	}
+	return len(results) > 0, nil
+}
+
+func (r *UserRepository) ClaimMatch(ctx context.Context, a, b *core.User, from string) error {
+	okA, err := r.setStatusIf(ctx, a.TelegramID, from, map[string]interface{}{"status": "chatting", "partner_id": b.TelegramID})
+	if err != nil {
+		return err
+	}
+	if !okA {
+		return ErrMatchConflict
+	}
+
+	okB, err := r.setStatusIf(ctx, b.TelegramID, from, map[string]interface{}{"status": "chatting", "partner_id": a.TelegramID})
+	if err != nil || !okB {
+		// Rollback A: kembalikan ke status semula, tapi hanya jika A masih tercatat chatting dengan B
+		var results []core.User
+		rollbackErr := r.DB.Client.DB.From("users").
+			Update(map[string]interface{}{"status": from, "partner_id": 0}).
+			Eq("telegram_id", fmt.Sprintf("%d", a.TelegramID)).
+			Eq("status", "chatting").
+			Eq("partner_id", fmt.Sprintf("%d", b.TelegramID)).
+			ExecuteWithContext(ctx, &results)
+		if rollbackErr != nil {
+			log.Printf("Failed to roll back match claim for user %d: %v", a.TelegramID, rollbackErr)
+		}
+
+		if err != nil {
+			return err
+		}
+		return ErrMatchConflict
+	}
+
+	pairUsers(a, b)
+	return nil
+}
+
+func (r *UserRepository) SetStatusIf(ctx context.Context, telegramID int64, from string, to string) (bool, error) {
+	return r.setStatusIf(ctx, telegramID, from, map[string]interface{}{"status": to, "partner_id": 0})
+}
+
+func (r *UserRepository) ReleaseMatch(ctx context.Context, telegramID int64, partnerID int64, to string) (bool, error) {
+	var results []core.User
+	query := r.DB.Client.DB.From("users").
+		Update(map[string]interface{}{"status": to, "partner_id": 0}).
+		Eq("telegram_id", fmt.Sprintf("%d", telegramID)).
+		Eq("status", "chatting")
+	// partner_id 0 bisa tersimpan sebagai NULL (omitempty saat insert), jadi hanya dicek jika ada partner
+	if partnerID != 0 {
+		query = query.Eq("partner_id", fmt.Sprintf("%d", partnerID))
+	}
+	if err := query.ExecuteWithContext(ctx, &results); err != nil {
+		return false, err
+	}
+	return len(results) > 0, nil
+}
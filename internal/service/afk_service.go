@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"log"
 	"otterchatbot/internal/repository"
 	"otterchatbot/pkg/i18n"
@@ -10,14 +11,14 @@ import (
 )
 
 type AFKService struct {
-	UserRepo     *repository.UserRepository
+	UserRepo     repository.UserStore
 	Bot          *telegram.Client
 	I18n         *i18n.I18nService
 	lastActivity map[int64]time.Time
 	mu           sync.RWMutex
 }
 
-func NewAFKService(repo *repository.UserRepository, bot *telegram.Client, i18n *i18n.I18nService) *AFKService {
+func NewAFKService(repo repository.UserStore, bot *telegram.Client, i18n *i18n.I18nService) *AFKService {
 	return &AFKService{
 		UserRepo:     repo,
 		Bot:          bot,
@@ -26,13 +27,20 @@ func NewAFKService(repo *repository.UserRepository, bot *telegram.Client, i18n *
 	}
 }
 
-// StartWorker menjalankan pengecekan setiap 1 menit
-func (s *AFKService) Start() {
+// StartWorker menjalankan pengecekan setiap 1 menit sampai ctx dibatalkan
+func (s *AFKService) Start(ctx context.Context) {
 	log.Println("AFK Monitor service started...")
 	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
 
-	for range ticker.C {
-		s.checkAFK()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("AFK Monitor service stopped.")
+			return
+		case <-ticker.C:
+			s.checkAFK(ctx)
+		}
 	}
 }
 
@@ -50,7 +58,7 @@ func (s *AFKService) Stop(userID int64) {
 	delete(s.lastActivity, userID)
 }
 
-func (s *AFKService) checkAFK() {
+func (s *AFKService) checkAFK(ctx context.Context) {
 	s.mu.RLock()
 	activeUsers := make(map[int64]time.Time)
 	for k, v := range s.lastActivity {
@@ -68,27 +76,29 @@ func (s *AFKService) checkAFK() {
 		
 		// 1. Peringatan Pertama (Menit ke-5)
 		if minutes == 5 {
-			s.sendAlert(userID, "afk_alert_1")
+			s.sendAlert(ctx, userID, "afk_alert_1")
 		}
 
 		// 2. Peringatan Kedua & Terakhir (Menit ke-10)
 		if minutes == 20 {
-			s.sendAlert(userID, "afk_alert_2")
+			s.sendAlert(ctx, userID, "afk_alert_2")
 		}
 
 		// Jika sudah menit ke-11 ke atas, bot akan diam saja.
 	}
 }
 
-func (s *AFKService) sendAlert(userID int64, key string) {
+func (s *AFKService) sendAlert(ctx context.Context, userID int64, key string) {
 	// Cek DB dulu, pastikan user MASIH status chatting
-	user, err := s.UserRepo.GetByTelegramID(userID)
-	if err != nil || user == nil || user.Status != "chatting" {
-		// Jika ternyata sudah tidak chat, hapus dari memori
+	user, err := s.UserRepo.GetByTelegramID(ctx, userID)
+	if err != nil || user == nil || user.Status != "chatting" || user.BotBlocked {
+		// Jika ternyata sudah tidak chat (atau memblokir bot), hapus dari memori
 		s.Stop(userID)
 		return
 	}
 
 	msg := s.I18n.Get(user.LanguageCode, key)
-	_, _ = s.Bot.SendMessage(userID, msg)
+	if _, err := s.Bot.SendMessage(ctx, userID, msg); MarkUnreachable(ctx, s.UserRepo, userID, err) {
+		s.Stop(userID)
+	}
 }
\ No newline at end of file
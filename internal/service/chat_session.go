@@ -0,0 +1,385 @@
+package service
+
+import (
+	"context"
+	"log"
+	"otterchatbot/internal/core"
+	"otterchatbot/internal/repository"
+	"otterchatbot/pkg/telegram"
+	"sync"
+	"time"
+)
+
+// ChatSessionService mencatat setiap sesi chat ke SessionStore.
+// Sesi yang sedang berlangsung disimpan juga di memori supaya jumlah pesan bisa dihitung
+// tanpa menulis ke database untuk setiap pesan; jumlahnya disimpan saat sesi diakhiri.
+// Pasangan pesan asli -> salinan di chat partner, dan persetujuan menerima media,
+// juga hanya disimpan di memori selama sesi berlangsung.
+type ChatSessionService struct {
+	Store repository.SessionStore
+
+	mu       sync.Mutex
+	active   map[int64]*core.ChatSession // Key: TelegramID kedua peserta
+	relays   map[int64]*relayLog         // Key: ID sesi
+	consents map[int64]*mediaConsent     // Key: ID sesi
+}
+
+// maxRelayedMessages: jumlah pasangan pesan terakhir per sesi yang diingat (untuk relay edit & reply),
+// yang lebih lama dilupakan
+const maxRelayedMessages = 500
+
+// relayKey adalah satu pesan di chat salah satu peserta
+type relayKey struct {
+	ChatID    int64
+	MessageID int
+}
+
+// relayLog memetakan pesan di chat satu peserta ke pasangannya di chat peserta lain (dua arah):
+// pesan asli <-> salinannya, dan prompt bot yang dikirim ke keduanya (mis. game)
+type relayLog struct {
+	links map[relayKey]relayKey
+	sent  map[relayKey]time.Time // Pesan asli user -> waktu diteruskan (untuk batas waktu /unsend)
+	order []relayKey             // Urutan masuk (satu key per pasangan), untuk membuang yang paling lama
+}
+
+// maxHeldMedia: jumlah media per penerima yang ditahan sambil menunggu persetujuan, sisanya ditolak
+const maxHeldMedia = 10
+
+// mediaConsent mencatat pilihan masing-masing peserta untuk menerima media dari partnernya di satu sesi
+type mediaConsent struct {
+	decided map[int64]bool               // Key: penerima; true = terima, false = tolak
+	held    map[int64][]telegram.Message // Key: penerima; media yang ditahan sampai penerima memilih
+}
+
+func NewChatSessionService(store repository.SessionStore) *ChatSessionService {
+	return &ChatSessionService{
+		Store:    store,
+		active:   make(map[int64]*core.ChatSession),
+		relays:   make(map[int64]*relayLog),
+		consents: make(map[int64]*mediaConsent),
+	}
+}
+
+// Start mencatat sesi baru antara a dan b. Sesi lama yang belum ditutup (mis. partner diban admin) ditutup oleh sistem.
+func (s *ChatSessionService) Start(ctx context.Context, a, b int64, mood string) *core.ChatSession {
+	s.endAll(ctx, a)
+	s.endAll(ctx, b)
+
+	session := &core.ChatSession{
+		UserA:     a,
+		UserB:     b,
+		Mood:      mood,
+		StartedAt: time.Now(),
+	}
+	if err := s.Store.CreateSession(ctx, session); err != nil {
+		log.Printf("Sessions: failed to record session %d <-> %d: %v", a, b, err)
+		return nil
+	}
+
+	s.mu.Lock()
+	s.active[a] = session
+	s.active[b] = session
+	s.mu.Unlock()
+	return session
+}
+
+// Active mengembalikan sesi user yang sedang berlangsung (nil jika tidak ada).
+// Setelah bot restart sesi diambil dari database; jumlah pesan sebelum restart tidak ikut terhitung.
+func (s *ChatSessionService) Active(ctx context.Context, telegramID int64) *core.ChatSession {
+	s.mu.Lock()
+	session, ok := s.active[telegramID]
+	s.mu.Unlock()
+	if ok {
+		return session
+	}
+
+	session, err := s.Store.GetActiveSession(ctx, telegramID)
+	if err != nil || session == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Bisa saja goroutine lain sudah memuatnya duluan
+	if cached, ok := s.active[telegramID]; ok {
+		return cached
+	}
+	s.active[session.UserA] = session
+	s.active[session.UserB] = session
+	return session
+}
+
+// CountMessage menambah jumlah pesan yang diteruskan dari sender di sesinya
+func (s *ChatSessionService) CountMessage(ctx context.Context, senderID int64) {
+	session := s.Active(ctx, senderID)
+	if session == nil {
+		return
+	}
+
+	s.mu.Lock()
+	session.CountMessage(senderID)
+	s.mu.Unlock()
+}
+
+// Exchanged adalah jumlah pesan yang sudah saling dikirim di sesi user yang sedang berlangsung
+func (s *ChatSessionService) Exchanged(ctx context.Context, telegramID int64) int {
+	session := s.Active(ctx, telegramID)
+	if session == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return session.MessagesA + session.MessagesB
+}
+
+// LinkMessages mencatat bahwa pesan messageID di chat chatID dan partnerMessageID di chat partnernya
+// adalah pesan yang sama (mis. prompt bot yang dikirim ke keduanya)
+func (s *ChatSessionService) LinkMessages(ctx context.Context, chatID int64, messageID int, partnerMessageID int) {
+	s.link(ctx, chatID, messageID, partnerMessageID, time.Time{})
+}
+
+// LinkRelay mencatat pesan messageID yang dikirim chatID dan salinannya di chat partner.
+// Berbeda dengan LinkMessages, pesan ini milik user sehingga bisa ditarik kembali lewat /unsend.
+func (s *ChatSessionService) LinkRelay(ctx context.Context, chatID int64, messageID int, copyID int) {
+	s.link(ctx, chatID, messageID, copyID, time.Now())
+}
+
+func (s *ChatSessionService) link(ctx context.Context, chatID int64, messageID int, partnerMessageID int, sentAt time.Time) {
+	session := s.Active(ctx, chatID)
+	if session == nil || messageID == 0 || partnerMessageID == 0 {
+		return
+	}
+	own := relayKey{ChatID: chatID, MessageID: messageID}
+	other := relayKey{ChatID: session.PartnerOf(chatID), MessageID: partnerMessageID}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	relays, ok := s.relays[session.ID]
+	if !ok {
+		relays = &relayLog{links: make(map[relayKey]relayKey), sent: make(map[relayKey]time.Time)}
+		s.relays[session.ID] = relays
+	}
+
+	if _, exists := relays.links[own]; !exists {
+		relays.order = append(relays.order, own)
+	}
+	relays.links[own] = other
+	relays.links[other] = own
+	if !sentAt.IsZero() {
+		relays.sent[own] = sentAt
+	}
+
+	if len(relays.order) > maxRelayedMessages {
+		oldest := relays.order[0]
+		delete(relays.links, relays.links[oldest])
+		delete(relays.links, oldest)
+		delete(relays.sent, oldest)
+		relays.order = relays.order[1:]
+	}
+}
+
+// Counterpart mencari pasangan pesan messageID (di chat chatID) di chat partner
+func (s *ChatSessionService) Counterpart(ctx context.Context, chatID int64, messageID int) (int, bool) {
+	session := s.Active(ctx, chatID)
+	if session == nil {
+		return 0, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	relays, ok := s.relays[session.ID]
+	if !ok {
+		return 0, false
+	}
+	other, ok := relays.links[relayKey{ChatID: chatID, MessageID: messageID}]
+	return other.MessageID, ok
+}
+
+// RelayedCopy mencari salinan pesan milik chatID sendiri (bukan pesan dari partner / prompt bot)
+// beserta waktu pesan itu diteruskan
+func (s *ChatSessionService) RelayedCopy(ctx context.Context, chatID int64, messageID int) (int, time.Time, bool) {
+	session := s.Active(ctx, chatID)
+	if session == nil {
+		return 0, time.Time{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	relays, ok := s.relays[session.ID]
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	own := relayKey{ChatID: chatID, MessageID: messageID}
+	sentAt, ok := relays.sent[own]
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	return relays.links[own].MessageID, sentAt, true
+}
+
+// Unlink melupakan pesan messageID di chat chatID beserta pasangannya (mis. setelah ditarik),
+// supaya edit & reply berikutnya tidak diarahkan ke pesan yang sudah dihapus
+func (s *ChatSessionService) Unlink(ctx context.Context, chatID int64, messageID int) {
+	session := s.Active(ctx, chatID)
+	if session == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	relays, ok := s.relays[session.ID]
+	if !ok {
+		return
+	}
+	own := relayKey{ChatID: chatID, MessageID: messageID}
+	if other, ok := relays.links[own]; ok {
+		delete(relays.links, other)
+		delete(relays.sent, other)
+	}
+	delete(relays.links, own)
+	delete(relays.sent, own)
+}
+
+// MediaConsent mengembalikan pilihan receiverID untuk menerima media di sesinya.
+// decided false berarti receiverID belum memilih di sesi ini (pakai default dari profil).
+func (s *ChatSessionService) MediaConsent(ctx context.Context, receiverID int64) (allowed bool, decided bool) {
+	session := s.Active(ctx, receiverID)
+	if session == nil {
+		return false, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	consent, ok := s.consents[session.ID]
+	if !ok {
+		return false, false
+	}
+	allowed, decided = consent.decided[receiverID]
+	return allowed, decided
+}
+
+// SetMediaConsent menyimpan pilihan receiverID di sesinya dan mengembalikan media yang selama ini ditahan
+// (diteruskan jika diterima, dibuang jika ditolak)
+func (s *ChatSessionService) SetMediaConsent(ctx context.Context, receiverID int64, allowed bool) []telegram.Message {
+	session := s.Active(ctx, receiverID)
+	if session == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	consent := s.mediaConsentLocked(session.ID)
+	consent.decided[receiverID] = allowed
+	held := consent.held[receiverID]
+	delete(consent.held, receiverID)
+	return held
+}
+
+// HoldMedia menahan media untuk receiverID sampai dia memilih. Return jumlah media yang sedang ditahan
+// (1 = media pertama, saatnya minta persetujuan), atau 0 jika tidak ditahan (tidak ada sesi / sudah penuh).
+func (s *ChatSessionService) HoldMedia(ctx context.Context, receiverID int64, msg telegram.Message) int {
+	session := s.Active(ctx, receiverID)
+	if session == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	consent := s.mediaConsentLocked(session.ID)
+	if len(consent.held[receiverID]) >= maxHeldMedia {
+		return 0
+	}
+	consent.held[receiverID] = append(consent.held[receiverID], msg)
+	return len(consent.held[receiverID])
+}
+
+// mediaConsentLocked mengambil (atau membuat) catatan persetujuan sesi. Dipanggil dengan mu terkunci.
+func (s *ChatSessionService) mediaConsentLocked(sessionID int64) *mediaConsent {
+	consent, ok := s.consents[sessionID]
+	if !ok {
+		consent = &mediaConsent{decided: make(map[int64]bool), held: make(map[int64][]telegram.Message)}
+		s.consents[sessionID] = consent
+	}
+	return consent
+}
+
+// maxStaleSessions membatasi endAll jika database terus mengembalikan sesi aktif yang gagal ditutup
+const maxStaleSessions = 10
+
+// endAll menutup semua sesi user yang masih tercatat aktif. Setelah bot crash / restart di tengah chat
+// satu user bisa punya beberapa baris aktif sekaligus, sedangkan End hanya menutup yang terbaru.
+func (s *ChatSessionService) endAll(ctx context.Context, telegramID int64) {
+	for i := 0; i < maxStaleSessions; i++ {
+		if s.End(ctx, telegramID, 0) == nil {
+			return
+		}
+	}
+}
+
+// End menutup sesi user. endedBy adalah user yang mengakhiri chat (0 = sistem).
+// Mengembalikan sesi yang ditutup, atau nil jika user tidak punya sesi aktif atau sesinya
+// sudah ditutup oleh pemanggil lain (mis. kedua peserta /stop bersamaan).
+func (s *ChatSessionService) End(ctx context.Context, telegramID int64, endedBy int64) *core.ChatSession {
+	session := s.Active(ctx, telegramID)
+	if session == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	if !session.IsActive() {
+		// Pointer yang sama sudah ditutup goroutine lain
+		s.mu.Unlock()
+		return nil
+	}
+	if s.active[session.UserA] == session {
+		delete(s.active, session.UserA)
+	}
+	if s.active[session.UserB] == session {
+		delete(s.active, session.UserB)
+	}
+	delete(s.relays, session.ID)
+	delete(s.consents, session.ID)
+	now := time.Now()
+	session.EndedAt = &now
+	session.EndedBy = endedBy
+	ended := *session
+	s.mu.Unlock()
+
+	closed, err := s.Store.EndSession(ctx, &ended)
+	if err != nil {
+		log.Printf("Sessions: failed to close session %d: %v", ended.ID, err)
+		return nil
+	}
+	if !closed {
+		// Sudah ditutup lewat salinan lain dari database (mis. dimuat ulang oleh Active saat End lain berjalan)
+		return nil
+	}
+	log.Printf("Sessions: %d <-> %d ended after %s (%d/%d messages)", ended.UserA, ended.UserB, ended.Duration().Round(time.Second), ended.MessagesA, ended.MessagesB)
+	return &ended
+}
+
+// Rate menyimpan rating raterID untuk partnernya di sesi yang sudah selesai.
+// Return sesi yang dinilai, atau nil jika sesi tidak valid / raterID sudah pernah menilai.
+func (s *ChatSessionService) Rate(ctx context.Context, sessionID int64, raterID int64, rating int, tag string) (*core.ChatSession, error) {
+	session, err := s.Store.GetSession(ctx, sessionID)
+	if err != nil || session == nil {
+		return nil, err
+	}
+	if !session.Has(raterID) || session.IsActive() {
+		return nil, nil
+	}
+
+	ok, err := s.Store.RateSession(ctx, sessionID, raterID, rating, tag)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return session, nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"otterchatbot/internal/repository"
+)
+
+func TestChatSessionEndOnce(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemorySessionRepository()
+	sessions := NewChatSessionService(store)
+	if sessions.Start(ctx, 1, 2, "fun") == nil {
+		t.Fatal("session not started")
+	}
+	// Instance kedua memuat sesi yang sama dari database (salinan lain, bukan pointer yang di-cache)
+	reloaded := NewChatSessionService(store)
+	if reloaded.Active(ctx, 2) == nil {
+		t.Fatal("session not loaded from store")
+	}
+
+	// Kedua peserta /stop bersamaan: hanya satu yang boleh menutup sesi (satu prompt rating, satu EndedBy)
+	var mu sync.Mutex
+	var winners []int64
+	var wg sync.WaitGroup
+	for _, call := range []struct {
+		svc *ChatSessionService
+		id  int64
+	}{{sessions, 1}, {sessions, 2}, {reloaded, 2}} {
+		wg.Add(1)
+		go func(svc *ChatSessionService, id int64) {
+			defer wg.Done()
+			if ended := svc.End(ctx, id, id); ended != nil {
+				mu.Lock()
+				winners = append(winners, ended.EndedBy)
+				mu.Unlock()
+			}
+		}(call.svc, call.id)
+	}
+	wg.Wait()
+
+	if len(winners) != 1 {
+		t.Fatalf("session ended %d times, want exactly once", len(winners))
+	}
+	history, err := store.GetSessionsByUser(ctx, 1, 0)
+	if err != nil || len(history) != 1 || history[0].EndedBy != winners[0] {
+		t.Fatalf("stored session = %+v, %v; want ended by %d", history, err, winners[0])
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"otterchatbot/pkg/telegram"
+	"sync"
+	"sync/atomic"
+)
+
+// UpdateDispatcher membagi update ke beberapa worker berdasarkan ID user.
+// Update dari user yang sama selalu masuk ke worker yang sama sehingga diproses berurutan,
+// sedangkan user yang berbeda tetap diproses paralel.
+type UpdateDispatcher struct {
+	handle func(context.Context, telegram.Update)
+	shards []chan telegram.Update
+	wg     sync.WaitGroup
+
+	// mu menjaga agar tidak ada Dispatch yang mengirim ke channel yang sudah ditutup oleh Stop
+	mu     sync.RWMutex
+	closed bool
+
+	dispatched atomic.Int64
+	processed  atomic.Int64
+	throttled  atomic.Int64 // Berapa kali Dispatch harus menunggu karena antrian worker penuh
+}
+
+// ErrDispatcherStopped dikembalikan Dispatch setelah Stop dipanggil
+var ErrDispatcherStopped = errors.New("dispatcher stopped")
+
+// DispatcherStats adalah snapshot metrik dispatcher
+type DispatcherStats struct {
+	Workers     int
+	QueueSize   int
+	QueueDepths []int
+	TotalQueued int
+	MaxDepth    int
+	Dispatched  int64
+	Processed   int64
+	Throttled   int64
+}
+
+func NewUpdateDispatcher(workers int, queueSize int, handle func(context.Context, telegram.Update)) *UpdateDispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	d := &UpdateDispatcher{
+		handle: handle,
+		shards: make([]chan telegram.Update, workers),
+	}
+	for i := range d.shards {
+		d.shards[i] = make(chan telegram.Update, queueSize)
+	}
+	return d
+}
+
+// Start menjalankan semua worker di background.
+// ctx diteruskan ke handler; sebaiknya hanya dibatalkan jika proses drain saat shutdown terlalu lama.
+func (d *UpdateDispatcher) Start(ctx context.Context) {
+	log.Printf("Update dispatcher started with %d workers...", len(d.shards))
+	for _, queue := range d.shards {
+		d.wg.Add(1)
+		go d.work(ctx, queue)
+	}
+}
+
+// Stop berhenti menerima update baru lalu menunggu semua update yang sudah antri selesai diproses
+func (d *UpdateDispatcher) Stop() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, queue := range d.shards {
+			close(queue)
+		}
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+	log.Println("Update dispatcher drained.")
+}
+
+// Dispatch memasukkan update ke antrian worker milik user pengirim.
+// Jika antrian penuh, Dispatch akan menunggu (backpressure) sampai ada slot kosong atau ctx selesai.
+func (d *UpdateDispatcher) Dispatch(ctx context.Context, update telegram.Update) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return ErrDispatcherStopped
+	}
+
+	queue := d.shards[d.shardFor(update.SenderID())]
+
+	select {
+	case queue <- update:
+	default:
+		d.throttled.Add(1)
+		select {
+		case queue <- update:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	d.dispatched.Add(1)
+	return nil
+}
+
+func (d *UpdateDispatcher) shardFor(userID int64) int {
+	if userID < 0 {
+		userID = -userID
+	}
+	return int(userID % int64(len(d.shards)))
+}
+
+func (d *UpdateDispatcher) work(ctx context.Context, queue chan telegram.Update) {
+	defer d.wg.Done()
+	for update := range queue {
+		d.process(ctx, update)
+	}
+}
+
+func (d *UpdateDispatcher) process(ctx context.Context, update telegram.Update) {
+	defer d.processed.Add(1)
+
+	// Satu update yang panic tidak boleh mematikan worker (dan semua user di shard tersebut)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic while handling update %d: %v", update.UpdateID, r)
+		}
+	}()
+
+	d.handle(ctx, update)
+}
+
+// Stats mengembalikan kedalaman antrian tiap worker dan counter total
+func (d *UpdateDispatcher) Stats() DispatcherStats {
+	stats := DispatcherStats{
+		Workers:     len(d.shards),
+		QueueSize:   cap(d.shards[0]),
+		QueueDepths: make([]int, len(d.shards)),
+		Dispatched:  d.dispatched.Load(),
+		Processed:   d.processed.Load(),
+		Throttled:   d.throttled.Load(),
+	}
+
+	for i, queue := range d.shards {
+		depth := len(queue)
+		stats.QueueDepths[i] = depth
+		stats.TotalQueued += depth
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+	}
+	return stats
+}
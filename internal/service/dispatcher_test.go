@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"otterchatbot/pkg/telegram"
+)
+
+// messageFrom membuat update pesan dari user tertentu; updateID dipakai sebagai nomor urut
+func messageFrom(userID int64, updateID int) telegram.Update {
+	return telegram.Update{
+		UpdateID: updateID,
+		Message: &telegram.Message{
+			From: &telegram.User{ID: userID},
+			Chat: &telegram.Chat{ID: userID},
+		},
+	}
+}
+
+func TestDispatcherKeepsPerUserOrder(t *testing.T) {
+	ctx := context.Background()
+	const users, perUser = 6, 50
+
+	var mu sync.Mutex
+	seen := make(map[int64][]int)
+	d := NewUpdateDispatcher(4, 8, func(ctx context.Context, u telegram.Update) {
+		// Jeda berbeda per update supaya worker saling menyalip jika urutan tidak dijaga
+		time.Sleep(time.Duration(u.UpdateID%3) * 100 * time.Microsecond)
+		mu.Lock()
+		seen[u.SenderID()] = append(seen[u.SenderID()], u.UpdateID)
+		mu.Unlock()
+	})
+	d.Start(ctx)
+
+	id := 0
+	for i := 0; i < perUser; i++ {
+		for user := int64(1); user <= users; user++ {
+			id++
+			if err := d.Dispatch(ctx, messageFrom(user, id)); err != nil {
+				t.Fatalf("dispatch: %v", err)
+			}
+		}
+	}
+	d.Stop()
+
+	for user := int64(1); user <= users; user++ {
+		ids := seen[user]
+		if len(ids) != perUser {
+			t.Fatalf("user %d: processed %d updates, want %d", user, len(ids), perUser)
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Fatalf("user %d: update %d handled before %d", user, ids[i-1], ids[i])
+			}
+		}
+	}
+	if stats := d.Stats(); stats.Dispatched != users*perUser || stats.Processed != users*perUser {
+		t.Fatalf("stats = %+v, want %d dispatched and processed", stats, users*perUser)
+	}
+}
+
+func TestDispatcherRunsUsersInParallel(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	done := make(chan int64, 2)
+	d := NewUpdateDispatcher(2, 4, func(ctx context.Context, u telegram.Update) {
+		// User 2 memblokir shard-nya; user 1 di shard lain harus tetap jalan
+		if u.SenderID() == 2 {
+			<-release
+		}
+		done <- u.SenderID()
+	})
+	d.Start(ctx)
+	defer d.Stop()
+
+	if err := d.Dispatch(ctx, messageFrom(2, 1)); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if err := d.Dispatch(ctx, messageFrom(1, 2)); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+
+	select {
+	case user := <-done:
+		if user != 1 {
+			t.Fatalf("first handled user = %d, want 1", user)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("user 1 was blocked behind user 2")
+	}
+	close(release)
+	<-done
+}
+
+func TestDispatcherSurvivesPanicAndRejectsAfterStop(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	var handled []int
+	d := NewUpdateDispatcher(1, 4, func(ctx context.Context, u telegram.Update) {
+		if u.UpdateID == 1 {
+			panic("boom")
+		}
+		mu.Lock()
+		handled = append(handled, u.UpdateID)
+		mu.Unlock()
+	})
+	d.Start(ctx)
+
+	for id := 1; id <= 2; id++ {
+		if err := d.Dispatch(ctx, messageFrom(1, id)); err != nil {
+			t.Fatalf("dispatch: %v", err)
+		}
+	}
+	d.Stop()
+
+	if len(handled) != 1 || handled[0] != 2 {
+		t.Fatalf("handled = %v, want [2] after panic in update 1", handled)
+	}
+	if err := d.Dispatch(ctx, messageFrom(1, 3)); !errors.Is(err, ErrDispatcherStopped) {
+		t.Fatalf("dispatch after stop = %v, want ErrDispatcherStopped", err)
+	}
+}
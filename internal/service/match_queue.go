@@ -0,0 +1,268 @@
+package service
+
+import (
+	"container/list"
+	"otterchatbot/internal/core"
+	"sync"
+	"time"
+)
+
+// queueEntry adalah satu user yang sedang menunggu pasangan
+type queueEntry struct {
+	user     core.User
+	joinedAt time.Time
+	elem     *list.Element
+	vip      bool
+	widened  WidenLevel // Pelonggaran terakhir yang sudah diberitahukan ke user
+	statusAt time.Time  // Terakhir kali pesan "Searching..." diperbarui
+}
+
+// MatchQueue adalah antrian matchmaking di memori.
+// Urutan prioritas: VIP dulu, lalu siapa yang masuk antrian lebih dulu (FIFO).
+// Semua operasi dijaga satu mutex sehingga "cari pasangan lalu keluarkan keduanya" terjadi atomik.
+type MatchQueue struct {
+	mu      sync.Mutex
+	vip     *list.List
+	regular *list.List
+	entries map[int64]*queueEntry
+}
+
+func NewMatchQueue() *MatchQueue {
+	return &MatchQueue{
+		vip:     list.New(),
+		regular: list.New(),
+		entries: make(map[int64]*queueEntry),
+	}
+}
+
+// ScoreFunc menilai kecocokan user dengan kandidat di antrian. ok=false berarti tidak boleh dipasangkan.
+// userWaited & candidateWaited adalah lama masing-masing sudah menunggu di antrian.
+type ScoreFunc func(user, candidate *core.User, userWaited, candidateWaited time.Duration) (score float64, ok bool)
+
+// WaitingUser adalah salinan satu entri antrian
+type WaitingUser struct {
+	User   core.User
+	Waited time.Duration
+}
+
+// MatchOrAdd mencari pasangan dengan skor tertinggi untuk user di antrian.
+// Jika ketemu, keduanya dikeluarkan dari antrian dan entrinya dikembalikan (self milik user, partner milik pasangan)
+// supaya bisa dikembalikan apa adanya lewat Restore jika klaim gagal. Jika tidak, user dimasukkan ke antrian (nil, nil).
+// prev adalah entri user dari percobaan sebelumnya yang gagal (nil untuk percobaan pertama).
+// Skor sama dimenangkan urutan antrian (VIP dulu, lalu yang paling lama menunggu).
+// score dipanggil dengan lock terkunci, jadi tidak boleh melakukan I/O.
+func (q *MatchQueue) MatchOrAdd(user core.User, prev *queueEntry, score ScoreFunc) (self, partner *queueEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// User yang masuk ulang (mis. /next berkali-kali) diperbarui datanya, bukan diduplikasi.
+	// Waktu masuk antrian tetap dipertahankan supaya syarat skor & pencarian tetap melonggar.
+	if cur := q.entries[user.TelegramID]; cur != nil {
+		prev = cur
+	}
+	q.remove(user.TelegramID)
+
+	self = newQueueEntry(user, prev)
+	if best := q.best(&user, self.joinedAt, score); best != nil {
+		q.remove(best.user.TelegramID)
+		return self, best
+	}
+
+	q.insert(self)
+	return nil, nil
+}
+
+// Rematch mencari ulang pasangan untuk user yang masih menunggu (syarat skor bisa sudah melonggar).
+// Jika ketemu, keduanya dikeluarkan dari antrian dan entrinya dikembalikan seperti MatchOrAdd;
+// jika tidak atau user sudah tidak di antrian, return nil.
+func (q *MatchQueue) Rematch(telegramID int64, score ScoreFunc) (self, partner *queueEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.entries[telegramID]
+	if !ok {
+		return nil, nil
+	}
+
+	best := q.best(&entry.user, entry.joinedAt, score)
+	if best == nil {
+		return nil, nil
+	}
+
+	q.remove(telegramID)
+	q.remove(best.user.TelegramID)
+	return entry, best
+}
+
+// Restore mengembalikan entri yang dikeluarkan MatchOrAdd / Rematch / Take ke antrian dengan data user terbaru.
+// Waktu masuk, pelonggaran, dan jadwal pesan status tetap seperti sebelum dikeluarkan, jadi posisinya tidak hilang.
+func (q *MatchQueue) Restore(entry *queueEntry, user core.User) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.remove(user.TelegramID)
+	q.insert(newQueueEntry(user, entry))
+}
+
+// Add memasukkan user ke antrian tanpa mencari pasangan
+func (q *MatchQueue) Add(user core.User) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	prev := q.entries[user.TelegramID]
+	q.remove(user.TelegramID)
+	q.add(user, prev)
+}
+
+// Remove mengeluarkan user dari antrian. Return false jika user tidak ada di antrian.
+func (q *MatchQueue) Remove(telegramID int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.remove(telegramID)
+}
+
+// Take mengeluarkan user dari antrian dan mengembalikan entrinya (nil jika tidak ada) untuk dikembalikan lewat Restore
+func (q *MatchQueue) Take(telegramID int64) *queueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry := q.entries[telegramID]
+	q.remove(telegramID)
+	return entry
+}
+
+// MarkWidened mencatat tingkat pelonggaran yang sudah diberitahukan ke user.
+// Return true jika level lebih tinggi dari sebelumnya (user perlu diberi tahu).
+func (q *MatchQueue) MarkWidened(telegramID int64, level WidenLevel) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.entries[telegramID]
+	if !ok || level <= entry.widened {
+		return false
+	}
+	entry.widened = level
+	return true
+}
+
+// MarkStatus mengecek apakah pesan status user sudah perlu diperbarui (terakhir diperbarui >= interval lalu).
+// Jika ya, waktunya dicatat dan return true.
+func (q *MatchQueue) MarkStatus(telegramID int64, interval time.Duration) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.entries[telegramID]
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(entry.statusAt) < interval {
+		return false
+	}
+	entry.statusAt = now
+	return true
+}
+
+// Contains mengecek apakah user sedang menunggu di antrian
+func (q *MatchQueue) Contains(telegramID int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.entries[telegramID]
+	return ok
+}
+
+// Len mengembalikan jumlah user yang sedang menunggu
+func (q *MatchQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Snapshot mengembalikan salinan semua user yang menunggu, sesuai urutan prioritas antrian
+func (q *MatchQueue) Snapshot() []WaitingUser {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	waiting := make([]WaitingUser, 0, len(q.entries))
+	for _, l := range []*list.List{q.vip, q.regular} {
+		for e := l.Front(); e != nil; e = e.Next() {
+			entry := e.Value.(*queueEntry)
+			waiting = append(waiting, WaitingUser{User: entry.user, Waited: now.Sub(entry.joinedAt)})
+		}
+	}
+	return waiting
+}
+
+// best mengembalikan kandidat dengan skor tertinggi untuk user. Harus dipanggil dengan mu terkunci.
+func (q *MatchQueue) best(user *core.User, joinedAt time.Time, score ScoreFunc) *queueEntry {
+	now := time.Now()
+
+	var best *queueEntry
+	var bestScore float64
+	for _, l := range []*list.List{q.vip, q.regular} {
+		for e := l.Front(); e != nil; e = e.Next() {
+			candidate := e.Value.(*queueEntry)
+			if candidate.user.TelegramID == user.TelegramID {
+				continue
+			}
+			sc, ok := score(user, &candidate.user, now.Sub(joinedAt), now.Sub(candidate.joinedAt))
+			if ok && (best == nil || sc > bestScore) {
+				best, bestScore = candidate, sc
+			}
+		}
+	}
+	return best
+}
+
+// add memasukkan user ke antrian. prev adalah entri lama user ini (jika ada) agar waktu masuk tetap sama.
+func (q *MatchQueue) add(user core.User, prev *queueEntry) {
+	q.insert(newQueueEntry(user, prev))
+}
+
+// newQueueEntry membuat entri baru untuk user, mewarisi waktu masuk & status dari prev (jika ada)
+func newQueueEntry(user core.User, prev *queueEntry) *queueEntry {
+	now := time.Now()
+	entry := &queueEntry{user: user, joinedAt: now, statusAt: now, vip: user.IsVIP}
+	if prev != nil {
+		entry.joinedAt = prev.joinedAt
+		entry.widened = prev.widened
+		entry.statusAt = prev.statusAt
+	}
+	return entry
+}
+
+// insert menyisipkan entri sesuai urutan prioritas. Harus dipanggil dengan mu terkunci.
+func (q *MatchQueue) insert(entry *queueEntry) {
+	joinedAt := entry.joinedAt
+	l := q.regular
+	if entry.vip {
+		l = q.vip
+	}
+
+	// Jaga urutan FIFO: user yang masuk ulang dengan waktu lama disisipkan di posisinya semula
+	e := l.Back()
+	for e != nil && e.Value.(*queueEntry).joinedAt.After(joinedAt) {
+		e = e.Prev()
+	}
+	if e == nil {
+		entry.elem = l.PushFront(entry)
+	} else {
+		entry.elem = l.InsertAfter(entry, e)
+	}
+	q.entries[entry.user.TelegramID] = entry
+}
+
+func (q *MatchQueue) remove(telegramID int64) bool {
+	entry, ok := q.entries[telegramID]
+	if !ok {
+		return false
+	}
+	if entry.vip {
+		q.vip.Remove(entry.elem)
+	} else {
+		q.regular.Remove(entry.elem)
+	}
+	delete(q.entries, telegramID)
+	return true
+}
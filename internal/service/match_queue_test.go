@@ -0,0 +1,62 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"otterchatbot/internal/core"
+)
+
+func acceptAll(user, candidate *core.User, userWaited, candidateWaited time.Duration) (float64, bool) {
+	return 1, true
+}
+
+func rejectAll(user, candidate *core.User, userWaited, candidateWaited time.Duration) (float64, bool) {
+	return 0, false
+}
+
+func queueOrder(q *MatchQueue) []int64 {
+	var ids []int64
+	for _, w := range q.Snapshot() {
+		ids = append(ids, w.User.TelegramID)
+	}
+	return ids
+}
+
+func TestMatchQueueRestoreKeepsPosition(t *testing.T) {
+	q := NewMatchQueue()
+	q.Add(core.User{TelegramID: 1})
+	q.Add(core.User{TelegramID: 2})
+	q.MarkWidened(1, WidenRegion)
+	waitedBefore := q.Snapshot()[0].Waited
+
+	// User 3 mendapat user 1, tapi klaim gagal: keduanya dikembalikan
+	time.Sleep(5 * time.Millisecond)
+	self, partner := q.MatchOrAdd(core.User{TelegramID: 3}, nil, acceptAll)
+	if partner == nil || partner.user.TelegramID != 1 {
+		t.Fatalf("expected user 1 as partner, got %+v", partner)
+	}
+	q.Restore(partner, core.User{TelegramID: 1, FirstName: "fresh"})
+	if got := queueOrder(q); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("queue order after restore = %v, want [1 2]", got)
+	}
+	restored := q.Snapshot()[0]
+	if restored.User.FirstName != "fresh" || restored.Waited < waitedBefore+5*time.Millisecond {
+		t.Fatalf("restored entry lost data or wait time: %+v", restored)
+	}
+	if q.MarkWidened(1, WidenRegion) {
+		t.Fatal("widening level reset by restore")
+	}
+
+	// Percobaan berikutnya untuk user 3 tetap memakai waktu masuk dari percobaan pertama
+	if _, partner := q.MatchOrAdd(core.User{TelegramID: 3}, self, rejectAll); partner != nil {
+		t.Fatal("rejectAll must not match")
+	}
+	taken := q.Take(3)
+	if taken == nil || !taken.joinedAt.Equal(self.joinedAt) {
+		t.Fatalf("retry reset the join time of user 3: %+v", taken)
+	}
+	if q.Contains(3) {
+		t.Fatal("Take must remove the entry")
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"otterchatbot/internal/core"
+	"strings"
+	"time"
+)
+
+// MatchScoring adalah bobot penilaian kecocokan dua user yang lolos filter wajib (mood, blokir, lokasi, gender).
+// Matchmaker selalu memilih kandidat dengan skor tertinggi.
+type MatchScoring struct {
+	SharedInterest float64 // Per tag minat yang sama
+	SameLanguage   float64 // Bahasa bot sama
+	SameLocation   float64 // Negara sama persis (bukan Global)
+	SameCity       float64 // Kota sama (tambahan di atas SameLocation)
+	WaitPerMinute  float64 // Bonus per menit kandidat menunggu, supaya yang lama menunggu tidak tersalip terus
+	GoodReputation float64 // Keduanya bereputasi baik, supaya user yang sopan dipasangkan sesamanya
+
+	// MinScore adalah skor minimum untuk dipasangkan. Syarat ini turun linear sampai 0
+	// setelah salah satu user menunggu selama RelaxAfter, jadi tidak ada yang menunggu selamanya
+	// (RelaxAfter 0 = syarat tidak pernah melonggar). Default 0: siapa pun yang lolos filter wajib
+	// langsung dipasangkan, skor hanya memilih kandidat terbaik.
+	MinScore   float64
+	RelaxAfter time.Duration
+}
+
+func DefaultMatchScoring() MatchScoring {
+	return MatchScoring{
+		SharedInterest: 10,
+		SameLanguage:   5,
+		SameLocation:   5,
+		SameCity:       3,
+		WaitPerMinute:  1,
+		GoodReputation: 5,
+		MinScore:       0,
+		RelaxAfter:     30 * time.Second,
+	}
+}
+
+// Score menghitung skor kecocokan a dan b. candidateWaited adalah lama b menunggu di antrian.
+func (m MatchScoring) Score(a, b *core.User, candidateWaited time.Duration) float64 {
+	score := float64(a.SharedInterests(b)) * m.SharedInterest
+
+	if a.LanguageCode != "" && a.LanguageCode == b.LanguageCode {
+		score += m.SameLanguage
+	}
+	if core.IsSpecificLocation(a.Location) && a.Location == b.Location {
+		score += m.SameLocation
+		if a.City != "" && strings.EqualFold(a.City, b.City) {
+			score += m.SameCity
+		}
+	}
+
+	if a.ReputationTier() == core.ReputationGood && b.ReputationTier() == core.ReputationGood {
+		score += m.GoodReputation
+	}
+
+	score += candidateWaited.Minutes() * m.WaitPerMinute
+	return score
+}
+
+// Threshold adalah skor minimum yang berlaku setelah menunggu selama waited
+func (m MatchScoring) Threshold(waited time.Duration) float64 {
+	if m.MinScore <= 0 {
+		return 0
+	}
+	if m.RelaxAfter <= 0 {
+		// Tidak pernah melonggar
+		return m.MinScore
+	}
+	if waited >= m.RelaxAfter {
+		return 0
+	}
+	return m.MinScore * (1 - float64(waited)/float64(m.RelaxAfter))
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"log"
 	"otterchatbot/internal/core"
 	"otterchatbot/internal/repository"
@@ -12,160 +14,334 @@ import (
 )
 
 type MatchmakerService struct {
-	UserRepo *repository.UserRepository
+	UserRepo repository.UserStore
+	Sessions *ChatSessionService
 	Bot      *telegram.Client
 	I18n     *i18n.I18nService
+	// Queue adalah sumber kebenaran untuk siapa yang sedang menunggu; database hanya cermin (durable mirror)
+	Queue *MatchQueue
+	// PartnerCooldown: user yang baru selesai chat tidak dipasangkan lagi selama ini
+	PartnerCooldown time.Duration
+	// Scoring menentukan kandidat terbaik dan skor minimum untuk dipasangkan
+	Scoring MatchScoring
+	// Widening melonggarkan lokasi & mood untuk user yang sudah lama menunggu
+	Widening SearchWidening
+	// StatusInterval: seberapa sering pesan "Searching..." diperbarui dengan posisi & estimasi waktu
+	StatusInterval time.Duration
+	// QueueTimeout: user yang menunggu lebih lama dari ini dikembalikan ke idle (0 = tanpa batas)
+	QueueTimeout time.Duration
+
+	stats matchStats
 }
 
-func NewMatchmakerService(repo *repository.UserRepository, bot *telegram.Client, i18n *i18n.I18nService) *MatchmakerService {
+// DefaultPartnerCooldown dipakai jika PartnerCooldown tidak diatur
+const DefaultPartnerCooldown = 30 * time.Minute
+
+const (
+	DefaultStatusInterval = 20 * time.Second
+	DefaultQueueTimeout   = 5 * time.Minute
+)
+
+// rescanInterval: seberapa sering antrian dicek ulang, karena syarat skor melonggar seiring waktu menunggu
+const rescanInterval = 5 * time.Second
+
+func NewMatchmakerService(repo repository.UserStore, sessions *ChatSessionService, bot *telegram.Client, i18n *i18n.I18nService) *MatchmakerService {
 	return &MatchmakerService{
 		UserRepo: repo,
+		Sessions: sessions,
 		Bot:      bot,
 		I18n:     i18n,
+		Queue:    NewMatchQueue(),
+		PartnerCooldown: DefaultPartnerCooldown,
+		Scoring:  DefaultMatchScoring(),
+		Widening: DefaultSearchWidening(),
+		StatusInterval: DefaultStatusInterval,
+		QueueTimeout:   DefaultQueueTimeout,
 	}
 }
 
-func (s *MatchmakerService) Start() {
+// Start memuat ulang antrian dari database (user yang masih "queue" saat bot restart),
+// lalu secara berkala mencoba lagi user yang belum dapat pasangan (syarat skor & kriteria pencarian
+// melonggar seiring lama menunggu) sampai ctx dibatalkan.
+// Matching utama terjadi langsung di Enqueue.
+func (s *MatchmakerService) Start(ctx context.Context) {
 	log.Println("Matchmaker service started...")
-	
+	s.restore(ctx)
+
+	ticker := time.NewTicker(rescanInterval)
+	defer ticker.Stop()
+
 	for {
-		s.processMood("dating", true)
-		s.processMood("deeptalk", false)
-		s.processMood("fun", false)
-		s.processMood("debate", false)
-		s.processMood("mabar", false)
-		s.processMood("all", false)
-		
-		time.Sleep(3 * time.Second)
-	}
-}
-
-func mergeUsers(specific []core.User, general []core.User) []core.User {
-	// Gunakan map untuk mencegah duplikat (jika ada logic error di db)
-	seen := make(map[int64]bool)
-	var result []core.User
-
-	// Masukkan user spesifik (misal: dating)
-	for _, u := range specific {
-		if !seen[u.TelegramID] {
-			seen[u.TelegramID] = true
-			result = append(result, u)
+		select {
+		case <-ctx.Done():
+			log.Println("Matchmaker service stopped.")
+			return
+		case <-ticker.C:
+			s.rescan(ctx)
 		}
 	}
+}
+
+// rescan mencoba ulang semua user yang masih menunggu, memperbarui pesan "Searching..."
+// dan mengeluarkan user yang sudah terlalu lama menunggu. Semua user dicoba ulang selama masih di antrian,
+// bukan hanya yang kriterianya masih melonggar: pasangan bisa jadi cocok belakangan tanpa ada user baru
+// masuk (mis. cooldown partner habis, atau kriteria user yang baru masuk ikut melonggar).
+func (s *MatchmakerService) rescan(ctx context.Context) {
+	waiting := s.Queue.Snapshot()
+	positions := queuePositions(waiting)
+
+	for _, w := range waiting {
+		if s.QueueTimeout > 0 && w.Waited >= s.QueueTimeout {
+			s.expire(ctx, &w.User)
+			continue
+		}
+
+		// Rematch gagal jika belum ada yang cocok, atau user sudah keluar antrian (dapat pasangan di iterasi sebelumnya, /stop, dll)
+		self, candidate := s.Queue.Rematch(w.User.TelegramID, s.score)
+		if candidate != nil {
+			user := self.user
+			s.pair(ctx, &user, self, candidate)
+			continue
+		}
 
-	// Masukkan user general (all)
-	for _, u := range general {
-		if !seen[u.TelegramID] {
-			seen[u.TelegramID] = true
-			result = append(result, u)
+		// Masih menunggu: pesan diperbarui saat kriteria dilonggarkan atau setiap StatusInterval
+		level := s.Widening.Level(w.Waited)
+		widened := level > WidenNone && s.Queue.MarkWidened(w.User.TelegramID, level)
+		statusDue := s.StatusInterval > 0 && s.Queue.MarkStatus(w.User.TelegramID, s.StatusInterval)
+		if widened || statusDue {
+			s.updateSearchMessage(ctx, &w.User, level, positions[w.User.TelegramID])
 		}
 	}
-	return result
 }
 
-func (s *MatchmakerService) processMood(mood string, isStrictDefault bool) {
-	// 1. Ambil user yang MEMANG milih mood ini
-	specificUsers, err := s.UserRepo.GetQueueByMood(mood)
-	if err != nil { return }
+func (s *MatchmakerService) restore(ctx context.Context) {
+	restored := 0
+	for _, mood := range core.AvailableMoods {
+		users, err := s.UserRepo.GetQueueByMood(ctx, mood.Code)
+		if err != nil {
+			log.Printf("Matchmaker: failed to restore %s queue: %v", mood.Code, err)
+			continue
+		}
+		for i := range users {
+			s.Enqueue(ctx, &users[i])
+			restored++
+		}
+	}
+	if restored > 0 {
+		log.Printf("Matchmaker: restored %d waiting users from database.", restored)
+	}
+}
 
-	// 2. Ambil user yang milih "ALL" (Fast Match)
-	// Kecuali jika kita memang sedang memproses mood "all", tidak perlu fetch ulang
-	var poolUsers []core.User
-	
-	if mood == "all" {
-		poolUsers = specificUsers
-	} else {
-		allUsers, err := s.UserRepo.GetQueueByMood("all")
+// Enqueue dipanggil setelah user disimpan dengan status "queue".
+// Pasangan langsung dicari saat itu juga; jika belum ada, user menunggu di antrian sampai ada yang cocok masuk.
+// Jika match terjadi, user (pointer yang sama) sudah berstatus "chatting" saat fungsi ini selesai.
+func (s *MatchmakerService) Enqueue(ctx context.Context, user *core.User) {
+	if user.Status != "queue" || user.IsBanned || user.BotBlocked {
+		return
+	}
+	// Antrian dating hanya untuk dewasa, termasuk user yang dipulihkan dari database saat startup
+	if user.CurrentMood == "dating" && !user.IsAdult() {
+		s.refuseDating(ctx, user)
+		return
+	}
+	self, candidate := s.Queue.MatchOrAdd(*user, nil, s.score)
+	s.pair(ctx, user, self, candidate)
+}
+
+// refuseDating mengeluarkan user di bawah umur dari status "queue" dan memberi tahu alasannya
+func (s *MatchmakerService) refuseDating(ctx context.Context, user *core.User) {
+	left, err := s.UserRepo.SetStatusIf(ctx, user.TelegramID, "queue", "idle")
+	if err != nil {
+		log.Printf("Matchmaker: failed to remove minor %d from dating queue: %v", user.TelegramID, err)
+		return
+	}
+	if !left {
+		return
+	}
+	user.Status = "idle"
+	_, _ = s.Bot.SendMessage(ctx, user.TelegramID, s.I18n.Get(user.LanguageCode, "dating_adults_only"))
+}
+
+// pair memvalidasi kandidat yang sudah dikeluarkan dari antrian lalu mengklaim match.
+// self & candidate adalah entri antrian keduanya; jika klaim gagal, entri dikembalikan lewat Restore
+// supaya waktu menunggu (dan pelonggaran pencarian) tidak mulai dari nol.
+// Jika kandidat ternyata tidak valid, dicarikan kandidat berikutnya.
+func (s *MatchmakerService) pair(ctx context.Context, user *core.User, self, candidate *queueEntry) {
+	for candidate != nil {
+		// Data di antrian bisa sudah basi (mis. beli VIP / ganti bahasa saat menunggu), jadi ambil versi terbaru
+		partner, err := s.UserRepo.GetByTelegramID(ctx, candidate.user.TelegramID)
+		if err != nil {
+			// Database bermasalah: kembalikan kandidat ke antrian, user tetap menunggu
+			s.Queue.Restore(candidate, candidate.user)
+			s.Queue.Restore(self, *user)
+			return
+		}
+		// Cek ulang dengan data terbaru. Lokasi & mood sudah dinilai antrian (termasuk pelonggarannya),
+		// yang dicek di sini hal yang bisa berubah saat menunggu: blokir, preferensi gender, dll.
+		if partner == nil || partner.Status != "queue" || partner.IsBanned || !s.isCompatible(user, partner, WidenMood) {
+			// Kandidat sudah tidak valid (keluar antrian lewat jalur lain), coba kandidat berikutnya
+			if partner != nil && partner.Status == "queue" && !partner.IsBanned && !partner.BotBlocked {
+				s.Queue.Restore(candidate, *partner)
+			}
+			self, candidate = s.Queue.MatchOrAdd(*user, self, s.score)
+			continue
+		}
+
+		err = s.executeMatch(ctx, user, partner, matchTopic(user, partner))
 		if err == nil {
-			// Gabungkan: User Mood Ini + User Mood 'All'
-			poolUsers = mergeUsers(specificUsers, allUsers)
-		} else {
-			poolUsers = specificUsers
+			return
+		}
+
+		if errors.Is(err, repository.ErrMatchConflict) {
+			// Salah satu pihak keluar antrian tepat sebelum klaim (mis. /stop). Tidak ada yang berubah di database.
+			// Partner yang masih menunggu dikembalikan ke antrian memori.
+			if p, _ := s.UserRepo.GetByTelegramID(ctx, partner.TelegramID); p != nil && p.Status == "queue" && !p.IsBanned {
+				s.Queue.Restore(candidate, *p)
+			}
+
+			fresh, getErr := s.UserRepo.GetByTelegramID(ctx, user.TelegramID)
+			if getErr != nil || fresh == nil || fresh.Status != "queue" {
+				// User sendiri yang keluar, jangan dimasukkan lagi
+				return
+			}
+			*user = *fresh
+			self, candidate = s.Queue.MatchOrAdd(*user, self, s.score)
+			continue
 		}
+
+		log.Printf("Matchmaker: failed to save match %d <-> %d: %v", user.TelegramID, partner.TelegramID, err)
+		s.Queue.Restore(candidate, *partner)
+		s.Queue.Restore(self, *user)
+		return
 	}
+}
 
-	if len(poolUsers) < 2 { return }
+// Remove mengeluarkan user dari antrian (/stop, cancel, dll). Return false jika user tidak sedang menunggu.
+func (s *MatchmakerService) Remove(telegramID int64) bool {
+	return s.Queue.Remove(telegramID)
+}
 
-	matchedIndices := make(map[int64]bool) // Ubah key jadi TelegramID biar unik
+// moodMatches: mood "all" (Fast Match) cocok dengan mood apa pun
+func moodMatches(a, b *core.User) bool {
+	return a.CurrentMood == b.CurrentMood || a.CurrentMood == "all" || b.CurrentMood == "all"
+}
 
-	for i := 0; i < len(poolUsers); i++ {
-		userA := &poolUsers[i]
-		if matchedIndices[userA.TelegramID] { continue }
+// matchTopic adalah mood tempat kedua user bertemu (mood spesifik menang atas "all").
+// Dua mood spesifik yang berbeda (hasil pelonggaran pencarian) bertemu di "all".
+func matchTopic(a, b *core.User) string {
+	if a.CurrentMood == "all" {
+		return b.CurrentMood
+	}
+	if b.CurrentMood != "all" && b.CurrentMood != a.CurrentMood {
+		return "all"
+	}
+	return a.CurrentMood
+}
 
-		for j := i + 1; j < len(poolUsers); j++ {
-			userB := &poolUsers[j]
-			if matchedIndices[userB.TelegramID] { continue }
+// score adalah ScoreFunc untuk MatchQueue: filter wajib dulu, lalu skor harus melewati syarat minimum.
+// Kriteria pencarian (lokasi, mood) dilonggarkan menurut lama menunggu masing-masing user, dan hanya
+// jika keduanya sudah sampai tahap itu: user yang baru masuk tidak ikut dilonggarkan karena partnernya lama menunggu.
+// Syarat skor mengikuti user yang paling lama menunggu di antara keduanya.
+func (s *MatchmakerService) score(user, candidate *core.User, userWaited, candidateWaited time.Duration) (float64, bool) {
+	level := s.Widening.Level(userWaited)
+	if other := s.Widening.Level(candidateWaited); other < level {
+		level = other
+	}
+	if !s.isCompatible(user, candidate, level) {
+		return 0, false
+	}
 
-			if userA.TelegramID == userB.TelegramID { continue }
+	waited := userWaited
+	if candidateWaited > waited {
+		waited = candidateWaited
+	}
 
-			// 1. Cek Lokasi
-			if !s.checkLocationMatch(userA, userB) { continue }
+	sc := s.Scoring.Score(user, candidate, candidateWaited)
+	return sc, sc >= s.Scoring.Threshold(waited)
+}
 
-			// 2. Logic Match
-			isMatch := true
-			
-			// Cek apakah filter harus aktif
-			shouldCheckStrictA := isStrictDefault || userA.IsVIP
-			shouldCheckStrictB := isStrictDefault || userB.IsVIP
+// isCompatible tidak boleh melakukan I/O karena dipanggil di dalam lock antrian.
+// level adalah pelonggaran pencarian yang berlaku untuk pasangan ini.
+func (s *MatchmakerService) isCompatible(a, b *core.User, level WidenLevel) bool {
+	if a.TelegramID == b.TelegramID || a.BotBlocked || b.BotBlocked {
+		return false
+	}
+	if level < WidenMood && !moodMatches(a, b) {
+		return false
+	}
 
-			// LOGIKA VIP & PREFERENSI:
-			// Preferensi user tersimpan di Profil Global.
-			// Jadi meskipun user "All" masuk ke pool "Dating", filter gendernya tetap aktif.
-			
-			matchAtoB := true
-			if shouldCheckStrictA {
-				matchAtoB = (userA.Preference == "both" || userA.Preference == userB.Gender)
-			}
+	// Jangan pasangkan dengan user yang diblokir atau yang baru saja di-skip
+	if a.HasBlocked(b.TelegramID) || b.HasBlocked(a.TelegramID) {
+		return false
+	}
+	if a.RecentlyChattedWith(b.TelegramID, s.PartnerCooldown) || b.RecentlyChattedWith(a.TelegramID, s.PartnerCooldown) {
+		return false
+	}
 
-			matchBtoA := true
-			if shouldCheckStrictB {
-				matchBtoA = (userB.Preference == "both" || userB.Preference == userA.Gender)
-			}
+	// Preferensi "satu bahasa saja" tidak ikut dilonggarkan karena dipilih sendiri oleh user
+	if (a.SameLanguageOnly || b.SameLanguageOnly) && a.LanguageCode != b.LanguageCode {
+		return false
+	}
 
-			isMatch = matchAtoB && matchBtoA
+	// Dating khusus dewasa: berlaku juga jika hanya salah satu yang memilih dating (hasil pelonggaran mood)
+	if (a.CurrentMood == "dating" || b.CurrentMood == "dating" || matchTopic(a, b) == "dating") && (!a.IsAdult() || !b.IsAdult()) {
+		return false
+	}
 
-			if isMatch {
-				// [Validasi Akhir] Pastikan status DB masih queue (Anti Race Condition sederhana)
-				freshA, errA := s.UserRepo.GetByTelegramID(userA.TelegramID)
-				freshB, errB := s.UserRepo.GetByTelegramID(userB.TelegramID)
+	// User bereputasi rendah hanya dipasangkan dengan sesamanya, tidak ikut dilonggarkan
+	if (a.ReputationTier() == core.ReputationLow) != (b.ReputationTier() == core.ReputationLow) {
+		return false
+	}
 
-				if errA != nil || freshA == nil || freshA.Status != "queue" || freshA.IsBanned {
-					matchedIndices[userA.TelegramID] = true 
-					break 
-				}
-				if errB != nil || freshB == nil || freshB.Status != "queue" || freshB.IsBanned {
-					matchedIndices[userB.TelegramID] = true 
-					continue 
-				}
+	// Filter umur partner (VIP) tidak ikut dilonggarkan
+	if (a.IsVIP && !a.AcceptsAge(b)) || (b.IsVIP && !b.AcceptsAge(a)) {
+		return false
+	}
 
-				// Eksekusi Match
-				s.executeMatch(freshA, freshB, mood) // Kirim mood biar user tau ketemu di topik apa
+	// 1. Cek Lokasi
+	if !s.checkLocationMatch(a, b, level) {
+		return false
+	}
 
-				matchedIndices[userA.TelegramID] = true
-				matchedIndices[userB.TelegramID] = true
-				break
-			}
-		}
+	// 2. Cek apakah filter gender harus aktif
+	// Mood dating selalu strict, mood lain hanya untuk VIP.
+	// Preferensi user tersimpan di Profil Global, jadi meskipun user "All" bertemu di "Dating", filter gendernya tetap aktif.
+	// User yang memilih Dating tetap strict walau mood-nya sudah dilonggarkan.
+	isStrictDefault := matchTopic(a, b) == "dating"
+	shouldCheckStrictA := isStrictDefault || a.IsVIP || a.CurrentMood == "dating"
+	shouldCheckStrictB := isStrictDefault || b.IsVIP || b.CurrentMood == "dating"
+
+	matchAtoB := true
+	if shouldCheckStrictA {
+		matchAtoB = (a.Preference == "both" || a.Preference == b.Gender)
+	}
+
+	matchBtoA := true
+	if shouldCheckStrictB {
+		matchBtoA = (b.Preference == "both" || b.Preference == a.Gender)
 	}
+
+	return matchAtoB && matchBtoA
 }
 
-func (s *MatchmakerService) checkLocationMatch(a, b *core.User) bool {
+func (s *MatchmakerService) checkLocationMatch(a, b *core.User, level WidenLevel) bool {
 	locA := a.Location
 	locB := b.Location
 
-	// Jika lokasi kosong atau "-", anggap Global (bisa match dengan siapa saja)
-	if locA == "" || locA == "-" || locB == "" || locB == "-" {
+	// Jika lokasi kosong atau "International" (Global), bisa match dengan siapa saja
+	if !core.IsSpecificLocation(locA) || !core.IsSpecificLocation(locB) {
 		return true
 	}
 
-	// Jika salah satu memilih "International" (Global), maka match diperbolehkan
-	if strings.Contains(locA, "International") || strings.Contains(locB, "International") {
+	// Pencarian diperlebar: lokasi diabaikan, atau cukup satu region (mis. ID & MY sama-sama SEA)
+	if level >= WidenGlobal {
+		return true
+	}
+	if level >= WidenRegion && core.RegionOf(locA) != "" && core.RegionOf(locA) == core.RegionOf(locB) {
 		return true
 	}
 
-	// Jika tidak Global, lokasi HARUS SAMA PERSIS
-	// Contoh: "🇮🇩 Indonesia" == "🇮🇩 Indonesia" -> True
-	// Contoh: "🇮🇩 Indonesia" == "🇲🇾 Malaysia" -> False
+	// Jika tidak Global, kode negara HARUS SAMA
 	return locA == locB
 }
 
@@ -174,8 +350,8 @@ func (s *MatchmakerService) buildMatchCard(receiver *core.User, partner *core.Us
 	lblTopic := s.I18n.Get(receiver.LanguageCode, "match_topic")
 	lblTip := s.I18n.Get(receiver.LanguageCode, "match_tip")
 
-	locText := partner.Location
-	if locText == "" || locText == "-" {
+	locText := core.LocationLabel(partner.Location, partner.City)
+	if locText == "" {
 		locText = "Global 🌍"
 	}
 
@@ -187,27 +363,24 @@ func (s *MatchmakerService) buildMatchCard(receiver *core.User, partner *core.Us
 	return msg
 }
 
-func (s *MatchmakerService) executeMatch(a, b *core.User, topic string) {
+func (s *MatchmakerService) executeMatch(ctx context.Context, a, b *core.User, topic string) error {
+	// Klaim atomik: kedua user dipasangkan hanya jika keduanya masih "queue" di database
+	if err := s.UserRepo.ClaimMatch(ctx, a, b, "queue"); err != nil {
+		return err
+	}
 	log.Printf("MATCH FOUND (%s): %s <-> %s", topic, a.FirstName, b.FirstName)
+	s.stats.record(a.CurrentMood, b.CurrentMood)
+	s.Sessions.Start(ctx, a.TelegramID, b.TelegramID, topic)
 
-	a.Status = "chatting"
-	a.PartnerID = b.TelegramID
-	
-	b.Status = "chatting"
-	b.PartnerID = a.TelegramID
-
-	if err := s.UserRepo.Update(a); err != nil { return }
-	if err := s.UserRepo.Update(b); err != nil { return }
-
-	if a.LastMessageID != 0 { _ = s.Bot.DeleteMessage(a.TelegramID, a.LastMessageID) }
-	if b.LastMessageID != 0 { _ = s.Bot.DeleteMessage(b.TelegramID, b.LastMessageID) }
+	if a.LastMessageID != 0 { _ = s.Bot.DeleteMessage(ctx, a.TelegramID, a.LastMessageID) }
+	if b.LastMessageID != 0 { _ = s.Bot.DeleteMessage(ctx, b.TelegramID, b.LastMessageID) }
 
 	// Format pesan notifikasi
 	// Kita bisa modifikasi text locale nanti, misal: "Partner Found! (Topic: Dating)"
 	// Untuk sekarang pakai default dulu
 	
 	msgA := s.buildMatchCard(a, b, topic)
-	s.Bot.SendMessageComplex(telegram.SendMessageRequest{
+	s.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 		ChatID: a.TelegramID,
 		Text: msgA,
 		ParseMode: "HTML",
@@ -216,10 +389,10 @@ func (s *MatchmakerService) executeMatch(a, b *core.User, topic string) {
 	// --- KIRIM MATCH CARD KE USER B ---
 	// User B melihat Data User A
 	msgB := s.buildMatchCard(b, a, topic)
-	s.Bot.SendMessageComplex(telegram.SendMessageRequest{
+	s.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
 		ChatID: b.TelegramID,
 		Text: msgB,
 		ParseMode: "HTML",
 	})
+	return nil
 }
-
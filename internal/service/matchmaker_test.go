@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"otterchatbot/internal/core"
+	"otterchatbot/internal/repository"
+	"otterchatbot/pkg/i18n"
+	"otterchatbot/pkg/telegram/telegramtest"
+)
+
+func newTestMatchmaker(t *testing.T) (*MatchmakerService, *repository.Stores) {
+	t.Helper()
+	tr := i18n.NewI18n("en")
+	if err := tr.LoadLanguages("../../locales"); err != nil {
+		t.Fatalf("load locales: %v", err)
+	}
+	srv := telegramtest.NewServer(t)
+	stores := repository.NewMemoryStores()
+	s := NewMatchmakerService(stores.Users, NewChatSessionService(stores.Sessions), srv.Client(), tr)
+	s.QueueTimeout = 0
+	return s, stores
+}
+
+// backdate memundurkan waktu masuk antrian user seolah sudah menunggu selama waited
+func backdate(q *MatchQueue, telegramID int64, waited time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.entries[telegramID].joinedAt = time.Now().Add(-waited)
+}
+
+func testUser(id int64, gender, mood, location string) core.User {
+	return core.User{
+		TelegramID: id, FirstName: "user", LanguageCode: "en", Gender: gender, Preference: "both",
+		BirthYear: time.Now().Year() - 25, Status: "queue", CurrentMood: mood, Location: location,
+	}
+}
+
+func TestMatchmakerWideningNeedsBothUsers(t *testing.T) {
+	s, _ := newTestMatchmaker(t)
+	s.Scoring.MinScore = 0
+	w := s.Widening
+
+	tests := []struct {
+		name                   string
+		moodB, locationB       string
+		userWaited, candWaited time.Duration
+		want                   bool
+	}{
+		{name: "same criteria", moodB: "fun", locationB: "ID", want: true},
+		{name: "region: newcomer not widened", moodB: "fun", locationB: "MY", userWaited: 0, candWaited: w.RegionAfter, want: false},
+		{name: "region: both widened", moodB: "fun", locationB: "MY", userWaited: w.RegionAfter, candWaited: w.RegionAfter, want: true},
+		{name: "mood: newcomer not widened", moodB: "debate", locationB: "ID", userWaited: 0, candWaited: w.MoodAfter, want: false},
+		{name: "mood: only newcomer long", moodB: "debate", locationB: "ID", userWaited: w.MoodAfter, candWaited: 0, want: false},
+		{name: "mood: both widened", moodB: "debate", locationB: "ID", userWaited: w.MoodAfter, candWaited: w.MoodAfter, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testUser(1, "female", "fun", "ID")
+			b := testUser(2, "male", tt.moodB, tt.locationB)
+			if _, ok := s.score(&a, &b, tt.userWaited, tt.candWaited); ok != tt.want {
+				t.Fatalf("score ok = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchmakerRescansLongWaiters(t *testing.T) {
+	ctx := context.Background()
+	s, stores := newTestMatchmaker(t)
+	s.PartnerCooldown = 30 * time.Minute
+
+	// Keduanya baru saja chat 20 menit lalu, jadi masih dalam cooldown
+	ended := time.Now().Add(-20 * time.Minute)
+	a := testUser(1, "female", "fun", "ID")
+	b := testUser(2, "male", "fun", "ID")
+	a.RecentPartners = []core.RecentPartner{{TelegramID: 2, EndedAt: ended}}
+	b.RecentPartners = []core.RecentPartner{{TelegramID: 1, EndedAt: ended}}
+	for _, u := range []*core.User{&a, &b} {
+		if err := stores.Users.Create(ctx, u); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		s.Enqueue(ctx, u)
+	}
+	if a.Status != "queue" || b.Status != "queue" {
+		t.Fatalf("paired during cooldown: %s/%s", a.Status, b.Status)
+	}
+
+	// Sudah lama melewati semua tahap pelonggaran, lalu cooldown habis: rescan tetap harus memasangkan
+	backdate(s.Queue, 1, 10*time.Minute)
+	backdate(s.Queue, 2, 10*time.Minute)
+	s.PartnerCooldown = 10 * time.Minute
+	s.rescan(ctx)
+
+	got, err := stores.Users.GetByTelegramID(ctx, 1)
+	if err != nil || got.Status != "chatting" || got.PartnerID != 2 {
+		t.Fatalf("long waiters not paired after cooldown: %+v, %v", got, err)
+	}
+}
+
+func TestMatchmakerPairsTwoUsersWithoutOverlapImmediately(t *testing.T) {
+	ctx := context.Background()
+	s, stores := newTestMatchmaker(t)
+
+	// Tidak ada minat, bahasa, maupun lokasi yang sama: tetap harus langsung dipasangkan dengan pengaturan default
+	a := testUser(1, "female", "fun", "")
+	b := testUser(2, "male", "fun", "")
+	a.LanguageCode, a.Interests = "id", []string{"music"}
+	b.LanguageCode, b.Interests = "en", []string{"sports"}
+	for _, u := range []*core.User{&a, &b} {
+		if err := stores.Users.Create(ctx, u); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		s.Enqueue(ctx, u)
+	}
+
+	if b.Status != "chatting" || b.PartnerID != 1 {
+		t.Fatalf("only two users in queue not paired on join: %s/%d", b.Status, b.PartnerID)
+	}
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"log"
+	"otterchatbot/internal/repository"
+	"otterchatbot/pkg/telegram"
+)
+
+// MarkUnreachable menandai user sebagai tidak aktif (core.User.BotBlocked) jika pengiriman ke dia gagal
+// karena dia memblokir bot / akunnya dihapus. User ini dilewati matchmaker, AFK monitor, dan broadcast
+// sampai dia menghubungi bot lagi. Return false jika err bukan error semacam itu.
+func MarkUnreachable(ctx context.Context, users repository.UserStore, telegramID int64, err error) bool {
+	if !telegram.IsUnreachable(err) {
+		return false
+	}
+
+	user, getErr := users.GetByTelegramID(ctx, telegramID)
+	if getErr != nil || user == nil || user.BotBlocked {
+		return true
+	}
+	user.BotBlocked = true
+	_ = users.Update(ctx, user)
+
+	reason := "is unreachable"
+	switch {
+	case telegram.IsBotBlocked(err):
+		reason = "blocked the bot"
+	case telegram.IsUserDeactivated(err):
+		reason = "deleted their account"
+	}
+	log.Printf("User %d %s, marked inactive.", telegramID, reason)
+	return true
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"otterchatbot/internal/core"
+	"otterchatbot/pkg/telegram"
+	"sync"
+	"time"
+)
+
+// matchStats mencatat rata-rata jarak antar match per mood, dipakai untuk estimasi waktu tunggu
+type matchStats struct {
+	mu       sync.Mutex
+	last     map[string]time.Time
+	interval map[string]time.Duration
+}
+
+// Jarak antar match yang lebih lama dari ini dianggap data basi (mis. bot baru restart / tengah malam)
+const maxMatchInterval = 30 * time.Minute
+
+func (m *matchStats) record(moods ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.last == nil {
+		m.last = make(map[string]time.Time)
+		m.interval = make(map[string]time.Duration)
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	for _, mood := range moods {
+		if seen[mood] {
+			continue
+		}
+		seen[mood] = true
+
+		if last, ok := m.last[mood]; ok {
+			gap := now.Sub(last)
+			if prev, ok := m.interval[mood]; ok && gap <= maxMatchInterval {
+				// Moving average supaya estimasi mengikuti ramai/sepinya jam saat ini
+				m.interval[mood] = time.Duration(0.7*float64(prev) + 0.3*float64(gap))
+			} else {
+				m.interval[mood] = gap
+			}
+		}
+		m.last[mood] = now
+	}
+}
+
+// eta memperkirakan waktu tunggu untuk user di posisi tertentu. Return false jika belum ada data.
+func (m *matchStats) eta(mood string, position int) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	interval, ok := m.interval[mood]
+	if !ok || time.Since(m.last[mood]) > maxMatchInterval {
+		return 0, false
+	}
+	return interval * time.Duration(position), true
+}
+
+// queuePosition adalah posisi user di antara yang menunggu dengan mood yang sama
+type queuePosition struct {
+	Position  int // Mulai dari 1
+	Searching int // Jumlah user yang sedang mencari di mood ini (termasuk Fast Match)
+}
+
+// queuePositions menghitung posisi semua user dari snapshot antrian (sudah urut sesuai prioritas)
+func queuePositions(waiting []WaitingUser) map[int64]queuePosition {
+	perMood := make(map[string]int)
+	positions := make(map[int64]queuePosition, len(waiting))
+	for _, w := range waiting {
+		perMood[w.User.CurrentMood]++
+		positions[w.User.TelegramID] = queuePosition{Position: perMood[w.User.CurrentMood]}
+	}
+
+	for _, w := range waiting {
+		pos := positions[w.User.TelegramID]
+		if w.User.CurrentMood == "all" {
+			pos.Searching = len(waiting)
+		} else {
+			pos.Searching = perMood[w.User.CurrentMood] + perMood["all"]
+		}
+		positions[w.User.TelegramID] = pos
+	}
+	return positions
+}
+
+// updateSearchMessage mengedit pesan "Searching..." dengan posisi antrian, estimasi waktu,
+// dan kriteria yang sudah dilonggarkan
+func (s *MatchmakerService) updateSearchMessage(ctx context.Context, user *core.User, level WidenLevel, pos queuePosition) {
+	if user.LastMessageID == 0 {
+		return
+	}
+	lang := user.LanguageCode
+
+	text := fmt.Sprintf(s.I18n.Get(lang, "joined_queue"), user.CurrentMood)
+
+	if relaxed := s.widenedCriteria(user, level); len(relaxed) > 0 {
+		text += "\n\n" + s.I18n.Get(lang, "widen_title")
+		for _, r := range relaxed {
+			text += "\n• " + r
+		}
+	}
+
+	eta := s.I18n.Get(lang, "eta_unknown")
+	if d, ok := s.stats.eta(user.CurrentMood, pos.Position); ok {
+		if d < time.Minute {
+			eta = s.I18n.Get(lang, "eta_soon")
+		} else {
+			eta = fmt.Sprintf(s.I18n.Get(lang, "eta_minutes"), int(math.Ceil(d.Minutes())))
+		}
+	}
+	text += "\n\n" + fmt.Sprintf(s.I18n.Get(lang, "search_status"), pos.Searching, pos.Position, eta)
+
+	cancelMarkup := telegram.InlineKeyboardMarkup{
+		InlineKeyboard: [][]telegram.InlineKeyboardButton{
+			{{Text: "❌ Cancel / Stop", CallbackData: "cmd:stop"}},
+		},
+	}
+	if err := s.Bot.EditMessageText(ctx, user.TelegramID, user.LastMessageID, text, cancelMarkup); err != nil && !telegram.IsMessageNotModified(err) {
+		log.Printf("Matchmaker: failed to update search message for %d: %v", user.TelegramID, err)
+	}
+}
+
+// widenedCriteria menjelaskan kriteria apa saja yang sudah dilonggarkan untuk user ini
+func (s *MatchmakerService) widenedCriteria(user *core.User, level WidenLevel) []string {
+	lang := user.LanguageCode
+
+	var relaxed []string
+	hasLocation := core.IsSpecificLocation(user.Location)
+	if hasLocation && level >= WidenGlobal {
+		relaxed = append(relaxed, s.I18n.Get(lang, "widen_global"))
+	} else if hasLocation && level >= WidenRegion && core.RegionOf(user.Location) != "" {
+		relaxed = append(relaxed, s.I18n.Get(lang, "widen_region"))
+	}
+	if level >= WidenMood && user.CurrentMood != "all" {
+		relaxed = append(relaxed, s.I18n.Get(lang, "widen_mood"))
+	}
+	return relaxed
+}
+
+// expire mengeluarkan user yang sudah menunggu lebih dari QueueTimeout dan menawarkan mood lain
+func (s *MatchmakerService) expire(ctx context.Context, user *core.User) {
+	entry := s.Queue.Take(user.TelegramID)
+	if entry == nil {
+		return
+	}
+
+	// Compare-and-swap: user bisa saja baru dapat partner atau /stop sepersekian detik sebelumnya
+	left, err := s.UserRepo.SetStatusIf(ctx, user.TelegramID, "queue", "idle")
+	if err != nil {
+		log.Printf("Matchmaker: failed to expire %d from queue: %v", user.TelegramID, err)
+		s.Queue.Restore(entry, *user)
+		return
+	}
+	if !left {
+		return
+	}
+	log.Printf("Matchmaker: %d left the %s queue after timeout.", user.TelegramID, user.CurrentMood)
+
+	lang := user.LanguageCode
+	text := fmt.Sprintf(s.I18n.Get(lang, "search_timeout"), user.CurrentMood, int(s.QueueTimeout.Minutes()))
+
+	var rows [][]telegram.InlineKeyboardButton
+	var currentRow []telegram.InlineKeyboardButton
+	for _, m := range core.AvailableMoods {
+		currentRow = append(currentRow, telegram.InlineKeyboardButton{Text: s.I18n.Get(lang, m.Label), CallbackData: "mood:" + m.Code})
+		if len(currentRow) == 2 {
+			rows = append(rows, currentRow)
+			currentRow = []telegram.InlineKeyboardButton{}
+		}
+	}
+	if len(currentRow) > 0 {
+		rows = append(rows, currentRow)
+	}
+	rows = append(rows, []telegram.InlineKeyboardButton{{Text: "🏠 Main Menu", CallbackData: "back:menu"}})
+	markup := telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
+
+	// Pesan "Searching..." diubah jadi pilihan mood; tombol mood: akan mengedit pesan ini lagi
+	if user.LastMessageID != 0 {
+		if err := s.Bot.EditMessageText(ctx, user.TelegramID, user.LastMessageID, text, markup); err == nil {
+			return
+		}
+	}
+	_, _ = s.Bot.SendMessageComplex(ctx, telegram.SendMessageRequest{
+		ChatID: user.TelegramID, Text: text, ReplyMarkup: markup, ParseMode: "HTML",
+	})
+}
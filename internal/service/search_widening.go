@@ -0,0 +1,44 @@
+package service
+
+import "time"
+
+// WidenLevel adalah seberapa jauh kriteria pencarian sudah dilonggarkan
+type WidenLevel int
+
+const (
+	WidenNone   WidenLevel = iota
+	WidenRegion            // Lokasi: negara lain di region yang sama boleh
+	WidenGlobal            // Lokasi: diabaikan
+	WidenMood              // Mood: dianggap "all" (Fast Match)
+)
+
+// SearchWidening menentukan kapan kriteria pencarian dilonggarkan berdasarkan lama menunggu.
+// Nilai 0 berarti langkah tersebut tidak pernah dijalankan.
+type SearchWidening struct {
+	RegionAfter time.Duration
+	GlobalAfter time.Duration
+	MoodAfter   time.Duration
+}
+
+func DefaultSearchWidening() SearchWidening {
+	return SearchWidening{
+		RegionAfter: 30 * time.Second,
+		GlobalAfter: 60 * time.Second,
+		MoodAfter:   2 * time.Minute,
+	}
+}
+
+// Level mengembalikan tingkat pelonggaran setelah menunggu selama waited
+func (w SearchWidening) Level(waited time.Duration) WidenLevel {
+	level := WidenNone
+	if w.RegionAfter > 0 && waited >= w.RegionAfter {
+		level = WidenRegion
+	}
+	if w.GlobalAfter > 0 && waited >= w.GlobalAfter {
+		level = WidenGlobal
+	}
+	if w.MoodAfter > 0 && waited >= w.MoodAfter {
+		level = WidenMood
+	}
+	return level
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"log"
+	"otterchatbot/internal/repository"
+	"otterchatbot/pkg/telegram"
+	"sync"
+	"time"
+)
+
+// processedRetention adalah lama catatan UpdateID disimpan. Telegram tidak menyimpan update lebih dari 24 jam,
+// jadi update yang lebih tua dari ini tidak mungkin terkirim ulang.
+const processedRetention = 24 * time.Hour
+
+// UpdateTracker mencatat progres update untuk mode polling.
+// getUpdates selalu mengambil update setelah yang terbaru (FetchOffset), jadi satu handler yang lambat tidak
+// menahan update lain. Offset yang disimpan ke repository (Offset) hanya maju sampai update terlama yang
+// handler-nya belum selesai. Update yang terkirim ulang (setelah crash / fetch ulang) dilewati berdasarkan UpdateID.
+type UpdateTracker struct {
+	Store repository.UpdateStore
+
+	mu        sync.Mutex
+	committed int          // Semua update dengan ID < committed sudah selesai diproses
+	highest   int          // UpdateID terbesar yang pernah masuk antrian
+	inFlight  map[int]bool // Sudah masuk antrian, handler belum selesai
+	finished  map[int]bool // Sudah selesai tapi masih di atas committed (worker selesai tidak berurutan)
+
+	saveMu sync.Mutex
+	saved  int // Offset terakhir yang berhasil disimpan ke repository
+}
+
+func NewUpdateTracker(store repository.UpdateStore) *UpdateTracker {
+	return &UpdateTracker{
+		Store:    store,
+		inFlight: make(map[int]bool),
+		finished: make(map[int]bool),
+	}
+}
+
+// Load membaca offset terakhir dari repository. Dipanggil sekali sebelum polling dimulai.
+func (t *UpdateTracker) Load(ctx context.Context) (int, error) {
+	offset, err := t.Store.GetOffset(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	t.mu.Lock()
+	t.committed = offset
+	t.highest = offset - 1
+	t.mu.Unlock()
+
+	t.saveMu.Lock()
+	t.saved = offset
+	t.saveMu.Unlock()
+
+	return offset, nil
+}
+
+// FetchOffset adalah offset untuk getUpdates berikutnya: update setelah yang terbaru masuk antrian.
+// Tidak menunggu update yang masih diproses, karena update itu sudah dipegang dispatcher.
+func (t *UpdateTracker) FetchOffset() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.highest + 1
+}
+
+// Offset mengembalikan offset yang sudah selesai diproses seluruhnya (yang disimpan ke repository)
+func (t *UpdateTracker) Offset() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.committed
+}
+
+// Begin mencatat update yang akan masuk antrian.
+// Return false jika update tersebut sedang / sudah diproses (hasil fetch ulang), jadi tidak perlu di-dispatch lagi.
+func (t *UpdateTracker) Begin(updateID int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if updateID < t.committed || t.inFlight[updateID] || t.finished[updateID] {
+		return false
+	}
+
+	t.inFlight[updateID] = true
+	if updateID > t.highest {
+		t.highest = updateID
+	}
+	return true
+}
+
+// Wrap membungkus handler dengan idempotency guard: update yang sudah tercatat diproses akan dilewati,
+// dan offset baru dianggap aman setelah handler selesai.
+func (t *UpdateTracker) Wrap(handle func(context.Context, telegram.Update)) func(context.Context, telegram.Update) {
+	return func(ctx context.Context, update telegram.Update) {
+		// Tetap dijalankan walau handler panic, supaya satu update rusak tidak menahan offset selamanya
+		defer t.finish(update.UpdateID)
+
+		processed, err := t.Store.IsProcessed(ctx, update.UpdateID)
+		if err != nil {
+			// Lebih baik diproses dua kali daripada hilang
+			log.Printf("Warning: idempotency check failed for update %d: %v", update.UpdateID, err)
+		} else if processed {
+			log.Printf("Skipping duplicate update %d", update.UpdateID)
+			return
+		}
+
+		handle(ctx, update)
+
+		if err := t.Store.MarkProcessed(ctx, update.UpdateID); err != nil {
+			log.Printf("Warning: failed to mark update %d as processed: %v", update.UpdateID, err)
+		}
+	}
+}
+
+func (t *UpdateTracker) finish(updateID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Mode webhook tidak memanggil Begin, offset diurus oleh Telegram sendiri
+	if !t.inFlight[updateID] {
+		return
+	}
+	delete(t.inFlight, updateID)
+	t.finished[updateID] = true
+
+	// Offset maju sampai update terlama yang masih diproses
+	next := t.highest + 1
+	for id := range t.inFlight {
+		if id < next {
+			next = id
+		}
+	}
+
+	if next > t.committed {
+		t.committed = next
+		for id := range t.finished {
+			if id < next {
+				delete(t.finished, id)
+			}
+		}
+	}
+}
+
+// Flush menyimpan offset terbaru ke repository jika sudah berubah
+func (t *UpdateTracker) Flush(ctx context.Context) error {
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
+	offset := t.Offset()
+	if offset <= t.saved {
+		return nil
+	}
+
+	if err := t.Store.SaveOffset(ctx, offset); err != nil {
+		return err
+	}
+	t.saved = offset
+	return nil
+}
+
+// Start menyimpan offset secara berkala dan membersihkan catatan UpdateID lama sampai ctx dibatalkan
+func (t *UpdateTracker) Start(ctx context.Context) {
+	flushTicker := time.NewTicker(1 * time.Second)
+	defer flushTicker.Stop()
+	pruneTicker := time.NewTicker(1 * time.Hour)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flushTicker.C:
+			if err := t.Flush(ctx); err != nil {
+				log.Printf("Warning: failed to save update offset: %v", err)
+			}
+		case <-pruneTicker.C:
+			if err := t.Store.PruneProcessed(ctx, time.Now().Add(-processedRetention)); err != nil {
+				log.Printf("Warning: failed to prune processed updates: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"otterchatbot/internal/repository"
+	"otterchatbot/pkg/telegram"
+)
+
+func TestUpdateTrackerFetchAheadOfCommitted(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryUpdateRepository()
+	tracker := NewUpdateTracker(store)
+	if _, err := tracker.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	release := make(chan struct{})
+	slow := tracker.Wrap(func(ctx context.Context, update telegram.Update) { <-release })
+	fast := tracker.Wrap(func(ctx context.Context, update telegram.Update) {})
+
+	for _, id := range []int{10, 11, 12} {
+		if !tracker.Begin(id) {
+			t.Fatalf("update %d rejected", id)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		slow(ctx, telegram.Update{UpdateID: 10})
+		close(done)
+	}()
+	fast(ctx, telegram.Update{UpdateID: 11})
+	fast(ctx, telegram.Update{UpdateID: 12})
+
+	// Update 10 masih diproses: fetch tetap maju, yang disimpan tertahan di 10
+	if got := tracker.FetchOffset(); got != 13 {
+		t.Fatalf("fetch offset = %d, want 13", got)
+	}
+	if got := tracker.Offset(); got != 10 {
+		t.Fatalf("committed offset = %d, want 10", got)
+	}
+	if err := tracker.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if saved, _ := store.GetOffset(ctx); saved != 10 {
+		t.Fatalf("saved offset = %d while update 10 is in flight, want 10", saved)
+	}
+	if tracker.Begin(11) {
+		t.Fatal("finished update 11 dispatched again")
+	}
+
+	close(release)
+	<-done
+	if err := tracker.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if saved, _ := store.GetOffset(ctx); saved != 13 {
+		t.Fatalf("saved offset = %d, want 13", saved)
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
+	"net/url"
 	"otterchatbot/config"
 	"otterchatbot/internal/handler"
 	"otterchatbot/internal/repository"
@@ -9,6 +12,11 @@ import (
 	"otterchatbot/pkg/database"
 	"otterchatbot/pkg/i18n"
 	"otterchatbot/pkg/telegram"
+	"otterchatbot/pkg/translate"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -22,51 +30,257 @@ func main() {
 		log.Fatalf("Fatal: Failed to load locales: %v", err)
 	}
 
-	supabaseClient, err := database.Connect(cfg.SupabaseURL, cfg.SupabaseKey)
-	if err != nil {
-		log.Fatalf("Fatal: Could not initialize Supabase client: %v", err)
-	}
+	stores := openStores(cfg)
 
 	gameService := service.NewGameService()
 
-	userRepo := repository.NewUserRepository(supabaseClient)
 	botClient := telegram.NewClient(cfg.BotToken)
-	afkService := service.NewAFKService(userRepo, botClient, translator)
-	botHandler := handler.NewBotHandler(botClient, userRepo, translator, cfg, gameService, afkService)
-	matchmakerService := service.NewMatchmakerService(userRepo, botClient, translator)
+	if cfg.TelegramAPIURL != "" {
+		botClient.BaseURL = cfg.TelegramAPIURL
+	}
+	afkService := service.NewAFKService(stores.Users, botClient, translator)
+	sessionService := service.NewChatSessionService(stores.Sessions)
+	matchmakerService := service.NewMatchmakerService(stores.Users, sessionService, botClient, translator)
+	matchmakerService.PartnerCooldown = cfg.PartnerCooldown
+	matchmakerService.Scoring.MinScore = float64(cfg.MatchMinScore)
+	matchmakerService.Scoring.RelaxAfter = cfg.MatchRelaxAfter
+	matchmakerService.Widening = service.SearchWidening{
+		RegionAfter: cfg.WidenRegionAfter,
+		GlobalAfter: cfg.WidenGlobalAfter,
+		MoodAfter:   cfg.WidenMoodAfter,
+	}
+	matchmakerService.StatusInterval = cfg.SearchStatusInterval
+	matchmakerService.QueueTimeout = cfg.QueueTimeout
+	botHandler := handler.NewBotHandler(botClient, stores.Users, stores.Inbox, translator, cfg, gameService, afkService, matchmakerService, sessionService)
+	botHandler.Translator = openTranslator(cfg)
+
+	// ctx dibatalkan saat SIGINT/SIGTERM: berhenti menerima update & menghentikan semua ticker
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Handler memakai context terpisah agar update yang sedang diproses tetap bisa selesai saat shutdown
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
 
 	log.Println("Registering bot commands to Telegram...")
-	registerCommands(botClient)
+	registerCommands(ctx, botClient)
+
+	// Offset & idempotency guard: update baru dianggap selesai setelah handler-nya selesai
+	tracker := service.NewUpdateTracker(stores.Updates)
+
+	var background sync.WaitGroup
+	background.Add(3)
 
 	// Jalankan Matchmaker di background (Goroutine)
-	go matchmakerService.Start()
+	go func() {
+		defer background.Done()
+		matchmakerService.Start(ctx)
+	}()
+
+	go func() {
+		defer background.Done()
+		afkService.Start(ctx)
+	}()
+
+	go func() {
+		defer background.Done()
+		tracker.Start(ctx)
+	}()
+
+	// Update dari user yang sama diproses berurutan, user berbeda tetap paralel
+	dispatcher := service.NewUpdateDispatcher(cfg.DispatchWorkers, cfg.DispatchQueueSize, tracker.Wrap(botHandler.HandleUpdate))
+	dispatcher.Start(workCtx)
+	botHandler.Admin.Dispatcher = dispatcher
+
+	polling := cfg.UpdateMode != "webhook"
+	if polling {
+		runPolling(ctx, botClient, dispatcher, tracker)
+	} else {
+		runWebhook(ctx, cfg, botClient, dispatcher)
+	}
+
+	// --- GRACEFUL SHUTDOWN ---
+	log.Println("Shutdown signal received, draining in-flight updates...")
+
+	drained := make(chan struct{})
+	go func() {
+		dispatcher.Stop()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(cfg.ShutdownTimeout):
+		log.Println("Drain timeout reached, cancelling remaining handlers...")
+		cancelWork()
+		<-drained
+	}
 
-	go afkService.Start()
+	background.Wait()
 
-	log.Println("Bot is running. Polling for updates...")
+	// Simpan offset terakhir, lalu konfirmasi ke Telegram agar update yang sudah diproses tidak dikirim ulang
+	if polling {
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := tracker.Flush(flushCtx); err != nil {
+			log.Printf("Warning: failed to save update offset: %v", err)
+		}
+
+		if offset := tracker.Offset(); offset > 0 {
+			if err := botClient.ConfirmUpdates(flushCtx, offset); err != nil {
+				log.Printf("Warning: failed to confirm update offset %d: %v", offset, err)
+			} else {
+				log.Printf("Confirmed update offset %d.", offset)
+			}
+		}
+		cancelFlush()
+	}
+
+	log.Println("OtterChatbot stopped.")
+}
+
+// runPolling mengambil update dengan long-polling getUpdates sampai ctx dibatalkan.
+// getUpdates mengambil update setelah yang terbaru masuk antrian, jadi handler yang lambat tidak menahan user lain.
+// Yang disimpan (dan dikonfirmasi saat shutdown) hanya offset yang handler-nya sudah selesai semua;
+// update yang terambil ulang setelah restart dilewati oleh idempotency guard.
+func runPolling(ctx context.Context, botClient *telegram.Client, dispatcher *service.UpdateDispatcher, tracker *service.UpdateTracker) {
+	// Webhook yang masih aktif membuat getUpdates ditolak Telegram
+	if err := botClient.DeleteWebhook(ctx, false); err != nil {
+		log.Printf("Warning: failed to delete webhook: %v", err)
+	}
+
+	offset, err := tracker.Load(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to load saved update offset, starting from Telegram's pending updates: %v", err)
+	}
+
+	log.Printf("Bot is running. Polling for updates from offset %d...", offset)
 	
-	offset := 0
 	for {
-		updates, err := botClient.GetUpdates(offset)
+		// Ambil update setelah yang terbaru; offset yang disimpan tetap menunggu handler yang belum selesai
+		updates, err := botClient.GetUpdates(ctx, tracker.FetchOffset(), 10)
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
 			log.Printf("Error fetching updates: %v", err)
-			time.Sleep(5 * time.Second)
+			if !sleepCtx(ctx, 5*time.Second) {
+				return
+			}
 			continue
 		}
 
 		for _, update := range updates {
-			if update.UpdateID >= offset {
-				offset = update.UpdateID + 1
+			if !tracker.Begin(update.UpdateID) {
+				continue
 			}
 
-			go botHandler.HandleUpdate(update)
+			// Dispatch akan menahan loop jika antrian worker penuh (backpressure).
+			// Jika gagal masuk antrian, update tetap tercatat belum selesai sehingga offset tidak melewatinya.
+			if err := dispatcher.Dispatch(ctx, update); err != nil {
+				return
+			}
 		}
 		
-		time.Sleep(500 * time.Millisecond)
+		if !sleepCtx(ctx, 500*time.Millisecond) {
+			return
+		}
+	}
+}
+
+// sleepCtx menunggu selama d, return false jika ctx dibatalkan lebih dulu
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// runWebhook menjalankan HTTP server yang menerima update dari Telegram sampai ctx dibatalkan
+func runWebhook(ctx context.Context, cfg *config.Config, botClient *telegram.Client, dispatcher *service.UpdateDispatcher) {
+	hookURL, err := url.Parse(cfg.WebhookURL)
+	if err != nil {
+		log.Fatalf("Fatal: invalid WEBHOOK_URL: %v", err)
+	}
+	path := hookURL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	if err := botClient.SetWebhook(ctx, cfg.WebhookURL, cfg.WebhookSecret); err != nil {
+		log.Fatalf("Fatal: setWebhook failed: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, telegram.NewWebhookHandler(cfg.WebhookSecret, dispatcher.Dispatch))
+	// Health check untuk load balancer
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{
+		Addr:              cfg.WebhookListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Printf("Bot is running. Listening for webhook updates on %s%s", cfg.WebhookListenAddr, path)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Fatal: webhook server stopped: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	// Stop menerima koneksi baru & tunggu request yang sedang berjalan
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: webhook server shutdown: %v", err)
+	}
+}
+
+// openStores memilih backend penyimpanan sesuai STORAGE_DRIVER
+func openStores(cfg *config.Config) *repository.Stores {
+	switch cfg.StorageDriver {
+	case "memory":
+		log.Println("Storage: in-memory (data will be lost on restart)")
+		return repository.NewMemoryStores()
+
+	case "sqlite", "postgres":
+		db, err := database.OpenSQL(cfg.StorageDriver, cfg.DatabaseDSN)
+		if err != nil {
+			log.Fatalf("Fatal: Could not open %s database: %v", cfg.StorageDriver, err)
+		}
+		log.Printf("Storage: %s", cfg.StorageDriver)
+		return repository.NewSQLStores(db)
+
+	default:
+		supabaseClient, err := database.Connect(cfg.SupabaseURL, cfg.SupabaseKey)
+		if err != nil {
+			log.Fatalf("Fatal: Could not initialize Supabase client: %v", err)
+		}
+		return repository.NewSupabaseStores(supabaseClient)
+	}
+}
+
+// openTranslator memilih penerjemah untuk VIP auto-translate. nil berarti fitur dimatikan.
+func openTranslator(cfg *config.Config) translate.Translator {
+	if cfg.Translator != "dictionary" {
+		return nil
+	}
+	dict, err := translate.LoadDictionary(cfg.DictionaryPath)
+	if err != nil {
+		log.Printf("Warning: could not load translation dictionary %s: %v. Auto-translate disabled.", cfg.DictionaryPath, err)
+		return nil
 	}
+	log.Println("Translator: local dictionary")
+	return dict
 }
 
-func registerCommands(bot *telegram.Client) {
+func registerCommands(ctx context.Context, bot *telegram.Client) {
 	// 1. DEFAULT (Inggris)
 	cmdsEn := []telegram.BotCommand{
 		{Command: "start", Description: "👋 Main Menu / Restart"},
@@ -75,12 +289,15 @@ func registerCommands(bot *telegram.Client) {
 		{Command: "stop", Description: "⛔ End chat"},
 		{Command: "profile", Description: "👤 My Profile"},
 		{Command: "report", Description: "🚨 Report User"},
+		{Command: "block", Description: "🚫 Block last partner"},
+		{Command: "media", Description: "🖼 Allow / hide partner media"},
+		{Command: "unsend", Description: "🗑 Unsend (reply to your message)"},
 		{Command: "vip", Description: "🌟 VIP Upgrade"},
 		{Command: "help", Description: "❓ Help Center"},
 		{Command: "lang", Description: "🌐 Change Language"}, // <--- SUDAH DITAMBAHKAN
 	}
-	_ = bot.SetMyCommands(cmdsEn, "")   // Global
-	_ = bot.SetMyCommands(cmdsEn, "en") // English users
+	_ = bot.SetMyCommands(ctx, cmdsEn, "")   // Global
+	_ = bot.SetMyCommands(ctx, cmdsEn, "en") // English users
 
 	// 2. INDONESIA
 	cmdsId := []telegram.BotCommand{
@@ -90,11 +307,14 @@ func registerCommands(bot *telegram.Client) {
 		{Command: "stop", Description: "⛔ Akhiri chat"},
 		{Command: "profile", Description: "👤 Profil Saya"},
 		{Command: "report", Description: "🚨 Lapor Toxic"},
+		{Command: "block", Description: "🚫 Blokir partner"},
+		{Command: "media", Description: "🖼 Izinkan / sembunyikan media"},
+		{Command: "unsend", Description: "🗑 Tarik pesan (reply pesanmu)"},
 		{Command: "vip", Description: "🌟 Beli VIP"},
 		{Command: "help", Description: "❓ Bantuan"},
 		{Command: "lang", Description: "🌐 Ganti Bahasa"}, // <--- SUDAH DITAMBAHKAN
 	}
-	_ = bot.SetMyCommands(cmdsId, "id")
+	_ = bot.SetMyCommands(ctx, cmdsId, "id")
 
 	// 3. RUSSIA
 	cmdsRu := []telegram.BotCommand{
@@ -104,9 +324,12 @@ func registerCommands(bot *telegram.Client) {
 		{Command: "stop", Description: "⛔ Стоп"},
 		{Command: "profile", Description: "👤 Профиль"},
 		{Command: "report", Description: "🚨 Жалоба"},
+		{Command: "block", Description: "🚫 Заблокировать"},
+		{Command: "media", Description: "🖼 Разрешить / скрыть медиа"},
+		{Command: "unsend", Description: "🗑 Отозвать (ответом на сообщение)"},
 		{Command: "vip", Description: "🌟 VIP"},
 		{Command: "help", Description: "❓ Помощь"},
 		{Command: "lang", Description: "🌐 Сменить язык"}, // <--- SUDAH DITAMBAHKAN
 	}
-	_ = bot.SetMyCommands(cmdsRu, "ru")
+	_ = bot.SetMyCommands(ctx, cmdsRu, "ru")
 }
\ No newline at end of file
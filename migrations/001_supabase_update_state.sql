@@ -0,0 +1,12 @@
+-- Offset getUpdates & update yang sudah diproses (UpdateRepository).
+-- Jalankan sekali di SQL Editor Supabase; idempotent, aman dijalankan ulang.
+CREATE TABLE IF NOT EXISTS bot_state (
+	key   TEXT PRIMARY KEY,
+	value BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS processed_updates (
+	update_id    BIGINT PRIMARY KEY,
+	processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_processed_updates_at ON processed_updates (processed_at);
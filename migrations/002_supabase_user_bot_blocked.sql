@@ -0,0 +1,3 @@
+-- Penanda user yang memblokir bot / akunnya dihapus (core.User.BotBlocked).
+-- PostgREST menolak PATCH/INSERT berisi kolom tak dikenal, jadi jalankan sebelum versi bot ini. Idempotent.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bot_blocked BOOLEAN NOT NULL DEFAULT FALSE;
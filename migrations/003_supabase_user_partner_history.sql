@@ -0,0 +1,4 @@
+-- Riwayat partner untuk cooldown matchmaker & daftar /block (core.User.RecentPartners, BlockedUsers).
+-- PostgREST menolak PATCH/INSERT berisi kolom tak dikenal, jadi jalankan sebelum versi bot ini. Idempotent.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS recent_partners JSONB;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_users   JSONB;
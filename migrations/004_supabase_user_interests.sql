@@ -0,0 +1,3 @@
+-- Tag minat untuk skor kecocokan matchmaker (core.User.Interests).
+-- PostgREST menolak PATCH/INSERT berisi kolom tak dikenal, jadi jalankan sebelum versi bot ini. Idempotent.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS interests JSONB;
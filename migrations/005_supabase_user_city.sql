@@ -0,0 +1,3 @@
+-- Kota / provinsi opsional di samping kode negara (core.User.City).
+-- PostgREST menolak PATCH/INSERT berisi kolom tak dikenal, jadi jalankan sebelum versi bot ini. Idempotent.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS city TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- Preferensi bahasa sama & auto-translate VIP (core.User.SameLanguageOnly, AutoTranslate).
+-- PostgREST menolak PATCH/INSERT berisi kolom tak dikenal, jadi jalankan sebelum versi bot ini. Idempotent.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS same_language_only BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS auto_translate     BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+-- Tahun lahir & filter umur partner VIP (core.User.BirthYear, AgeMin, AgeMax).
+-- PostgREST menolak PATCH/INSERT berisi kolom tak dikenal, jadi jalankan sebelum versi bot ini. Idempotent.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS birth_year INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS age_min    INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS age_max    INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,14 @@
+-- Riwayat sesi chat (SessionRepository). Jalankan sekali di SQL Editor Supabase; idempotent.
+CREATE TABLE IF NOT EXISTS chat_sessions (
+	id         BIGSERIAL PRIMARY KEY,
+	user_a     BIGINT NOT NULL,
+	user_b     BIGINT NOT NULL,
+	mood       TEXT NOT NULL DEFAULT '',
+	started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	ended_at   TIMESTAMPTZ,
+	ended_by   BIGINT NOT NULL DEFAULT 0,
+	messages_a INTEGER NOT NULL DEFAULT 0,
+	messages_b INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_a ON chat_sessions (user_a);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_b ON chat_sessions (user_b);
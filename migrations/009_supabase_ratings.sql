@@ -0,0 +1,32 @@
+-- Rating setelah chat & reputasi (core.ChatSession.RatingA/B, core.User.RatingUp/Down/Tags).
+-- PostgREST menolak PATCH/INSERT berisi kolom tak dikenal, jadi jalankan sebelum versi bot ini. Idempotent.
+ALTER TABLE chat_sessions ADD COLUMN IF NOT EXISTS rating_a INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chat_sessions ADD COLUMN IF NOT EXISTS tag_a    TEXT NOT NULL DEFAULT '';
+ALTER TABLE chat_sessions ADD COLUMN IF NOT EXISTS rating_b INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chat_sessions ADD COLUMN IF NOT EXISTS tag_b    TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS rating_up   INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS rating_down INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS rating_tags JSONB;
+
+-- Function untuk UserRepository.AddRating: menambah rating yang diterima user dalam satu UPDATE,
+-- jadi dua rating yang masuk bersamaan tidak saling menimpa. Aman dijalankan ulang (CREATE OR REPLACE).
+-- p_rating: 1 = 👍, -1 = 👎. p_tag kosong = tanpa tag. Return FALSE jika user tidak ditemukan.
+CREATE OR REPLACE FUNCTION add_user_rating(p_telegram_id BIGINT, p_rating INTEGER, p_tag TEXT)
+RETURNS BOOLEAN
+LANGUAGE sql
+AS $$
+	WITH updated AS (
+		UPDATE users SET
+			rating_up   = rating_up   + CASE WHEN p_rating = 1  THEN 1 ELSE 0 END,
+			rating_down = rating_down + CASE WHEN p_rating = -1 THEN 1 ELSE 0 END,
+			rating_tags = CASE
+				WHEN COALESCE(p_tag, '') = '' THEN rating_tags
+				ELSE (CASE WHEN jsonb_typeof(rating_tags) = 'object' THEN rating_tags ELSE '{}'::jsonb END)
+					|| jsonb_build_object(p_tag, COALESCE((rating_tags ->> p_tag)::INTEGER, 0) + 1)
+			END
+		WHERE telegram_id = p_telegram_id
+		RETURNING 1
+	)
+	SELECT EXISTS (SELECT 1 FROM updated);
+$$;
@@ -0,0 +1,3 @@
+-- Default profil untuk menerima media partner tanpa minta persetujuan (core.User.AllowMedia).
+-- PostgREST menolak PATCH/INSERT berisi kolom tak dikenal, jadi jalankan sebelum versi bot ini. Idempotent.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS allow_media BOOLEAN NOT NULL DEFAULT FALSE;
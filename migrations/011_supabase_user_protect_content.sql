@@ -0,0 +1,3 @@
+-- Pengaturan pesan terlindungi (core.User.ProtectContent). NULL = default (aktif untuk VIP), lihat ProtectsContent.
+-- PostgREST menolak PATCH/INSERT berisi kolom tak dikenal, jadi jalankan sebelum versi bot ini. Idempotent.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS protect_content BOOLEAN;
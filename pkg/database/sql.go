@@ -0,0 +1,125 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// SQLDB membungkus koneksi database/sql untuk mode lokal (SQLite) atau Postgres biasa
+type SQLDB struct {
+	Conn   *sql.DB
+	Driver string
+}
+
+// schema dijalankan setiap kali koneksi dibuka. Semua statement harus idempotent.
+// Token {{auto_id}} diganti dengan tipe kolom auto-increment sesuai driver.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id {{auto_id}},
+		telegram_id BIGINT NOT NULL UNIQUE,
+		status TEXT NOT NULL DEFAULT '',
+		current_mood TEXT NOT NULL DEFAULT '',
+		is_vip BOOLEAN NOT NULL DEFAULT FALSE,
+		data TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_users_queue ON users (status, current_mood)`,
+	`CREATE TABLE IF NOT EXISTS inbox_messages (
+		id {{auto_id}},
+		receiver_id BIGINT NOT NULL,
+		sender_id BIGINT NOT NULL,
+		message TEXT NOT NULL,
+		is_read BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_inbox_receiver ON inbox_messages (receiver_id)`,
+	`CREATE TABLE IF NOT EXISTS chat_sessions (
+		id {{auto_id}},
+		user_a BIGINT NOT NULL,
+		user_b BIGINT NOT NULL,
+		mood TEXT NOT NULL DEFAULT '',
+		started_at BIGINT NOT NULL,
+		ended_at BIGINT,
+		ended_by BIGINT NOT NULL DEFAULT 0,
+		messages_a INTEGER NOT NULL DEFAULT 0,
+		messages_b INTEGER NOT NULL DEFAULT 0,
+		rating_a INTEGER NOT NULL DEFAULT 0,
+		tag_a TEXT NOT NULL DEFAULT '',
+		rating_b INTEGER NOT NULL DEFAULT 0,
+		tag_b TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_sessions_user_a ON chat_sessions (user_a)`,
+	`CREATE INDEX IF NOT EXISTS idx_sessions_user_b ON chat_sessions (user_b)`,
+	`CREATE TABLE IF NOT EXISTS bot_state (
+		key TEXT PRIMARY KEY,
+		value BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS processed_updates (
+		update_id BIGINT PRIMARY KEY,
+		processed_at BIGINT NOT NULL
+	)`,
+}
+
+// OpenSQL membuka koneksi SQL ("sqlite" atau "postgres") dan memastikan tabel sudah ada
+func OpenSQL(driver string, dsn string) (*SQLDB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("database DSN is empty")
+	}
+
+	var autoIncrement string
+	switch driver {
+	case "sqlite":
+		autoIncrement = "INTEGER PRIMARY KEY AUTOINCREMENT"
+	case "postgres":
+		autoIncrement = "BIGSERIAL PRIMARY KEY"
+	default:
+		return nil, fmt.Errorf("unsupported sql driver: %s", driver)
+	}
+
+	conn, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", driver, err)
+	}
+
+	// SQLite hanya mengizinkan satu writer, jadi batasi koneksi agar tidak kena "database is locked"
+	if driver == "sqlite" {
+		conn.SetMaxOpenConns(1)
+	}
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %v", driver, err)
+	}
+
+	for _, stmt := range schema {
+		if _, err := conn.Exec(strings.ReplaceAll(stmt, "{{auto_id}}", autoIncrement)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to apply schema: %v", err)
+		}
+	}
+
+	return &SQLDB{Conn: conn, Driver: driver}, nil
+}
+
+// Rebind mengubah placeholder "?" menjadi "$1, $2, ..." untuk Postgres
+func (db *SQLDB) Rebind(query string) string {
+	if db.Driver != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -2,18 +2,29 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
-const telegramAPIBase = "https://api.telegram.org/bot"
+// DefaultAPIBase adalah alamat Bot API resmi. Bisa diganti ke Local Bot API Server atau server palsu untuk test.
+const DefaultAPIBase = "https://api.telegram.org"
 
 type Client struct {
 	Token      string
 	HttpClient *http.Client
+	// BaseURL tanpa "/bot<token>", mis. "https://api.telegram.org"
+	BaseURL string
+
+	// Limiter membatasi method kirim pesan (global & per chat). nil = tanpa batas.
+	Limiter *RateLimiter
+	// MaxRetries adalah jumlah percobaan ulang untuk error 429 & 5xx
+	MaxRetries int
 }
 
 func NewClient(token string) *Client {
@@ -22,192 +33,233 @@ func NewClient(token string) *Client {
 		HttpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		BaseURL:    DefaultAPIBase,
+		Limiter:    NewRateLimiter(DefaultGlobalRate, DefaultChatRate),
+		MaxRetries: 3,
 	}
 }
 
-func (c *Client) GetUpdates(offset int) ([]Update, error) {
-	url := fmt.Sprintf("%s%s/getUpdates?offset=%d&timeout=10", telegramAPIBase, c.Token, offset)
-	resp, err := c.HttpClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch updates: %v", err)
-	}
-	defer resp.Body.Close()
+// Backoff untuk error 5xx: 500ms, 1s, 2s, ... maksimal 10s
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+)
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
-	}
+// apiResult adalah bentuk umum response Bot API
+type apiResult struct {
+	Ok          bool                `json:"ok"`
+	Result      json.RawMessage     `json:"result"`
+	Description string              `json:"description"`
+	ErrorCode   int                 `json:"error_code"`
+	Parameters  *ResponseParameters `json:"parameters,omitempty"`
+}
 
-	var apiResp APIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse json response: %v", err)
-	}
+// ResponseParameters berisi info tambahan saat request gagal (mis. retry_after untuk 429)
+type ResponseParameters struct {
+	MigrateToChatID int64 `json:"migrate_to_chat_id,omitempty"`
+	RetryAfter      int   `json:"retry_after,omitempty"`
+}
 
-	if !apiResp.Ok {
-		return nil, fmt.Errorf("telegram api error: %d %s", apiResp.ErrorCode, apiResp.Description)
+// call mengirim request JSON ke method Bot API dan men-decode field "result" ke out (boleh nil).
+// Semua method Client lewat sini supaya context, parsing, retry, dan error handling seragam.
+func (c *Client) call(ctx context.Context, method string, payload interface{}, out interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal error: %v", err)
 	}
 
-	return apiResp.Result, nil
-}
-
-func (c *Client) SendChatAction(chatID int64, action string) error {
-	req := SendChatActionRequest{
-		ChatID: chatID,
-		Action: action,
+	for attempt := 0; ; attempt++ {
+		apiResp, status, err := c.do(ctx, method, jsonData)
+		if err != nil {
+			return err
+		}
+
+		if apiResp.Ok {
+			if out != nil && len(apiResp.Result) > 0 {
+				if err := json.Unmarshal(apiResp.Result, out); err != nil {
+					return fmt.Errorf("failed to parse result: %v", err)
+				}
+			}
+			return nil
+		}
+
+		apiErr := newAPIError(method, apiResp)
+
+		delay, retryable := retryDelay(apiResp, status, attempt)
+		if !retryable || attempt >= c.MaxRetries {
+			return apiErr
+		}
+
+		log.Printf("Telegram %s failed (%v), retrying in %v...", method, apiErr, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return apiErr
+		}
 	}
-	jsonData, _ := json.Marshal(req)
-	url := fmt.Sprintf("%s%s/sendChatAction", telegramAPIBase, c.Token)
-	_, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	return err
 }
 
-func (c *Client) SendMessage(chatID int64, text string) (int, error) {
-	req := SendMessageRequest{
-		ChatID:    chatID,
-		Text:      text,
-		ParseMode: "HTML",
+// callChat sama dengan call, tapi menunggu rate limiter untuk chatID dulu.
+// Dipakai semua method yang mengirim / mengubah pesan di sebuah chat.
+func (c *Client) callChat(ctx context.Context, chatID int64, method string, payload interface{}, out interface{}) error {
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(ctx, chatID); err != nil {
+			return fmt.Errorf("rate limit wait: %w", err)
+		}
 	}
-	return c.SendMessageComplex(req)
+	return c.call(ctx, method, payload, out)
 }
 
-func (c *Client) SendMessageComplex(req SendMessageRequest) (int, error) {
-	if req.ParseMode == "" {
-		req.ParseMode = "HTML"
+// do menjalankan satu HTTP request ke Bot API
+func (c *Client) do(ctx context.Context, method string, jsonData []byte) (*apiResult, int, error) {
+	base := strings.TrimRight(c.BaseURL, "/")
+	if base == "" {
+		base = DefaultAPIBase
 	}
-	
-	jsonData, err := json.Marshal(req)
+	url := fmt.Sprintf("%s/bot%s/%s", base, c.Token, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
 	if err != nil {
-		return 0, fmt.Errorf("marshal error: %v", err)
+		return nil, 0, fmt.Errorf("request error: %v", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	url := fmt.Sprintf("%s%s/sendMessage", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := c.HttpClient.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("request error: %v", err)
+		return nil, 0, fmt.Errorf("request error: %w", err)
 	}
 	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	
-	var apiResp struct {
-		Ok          bool   `json:"ok"`
-		Result      Message `json:"result"`
-		Description string `json:"description"`
-	}
-	
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return 0, nil 
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to read response body: %v", err)
 	}
 
-	if !apiResp.Ok {
-		return 0, fmt.Errorf("api error: %s", apiResp.Description)
+	var apiResp apiResult
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		// Gateway error (502/503/504) kadang mengembalikan HTML, bukan JSON
+		if resp.StatusCode >= 500 {
+			return &apiResult{ErrorCode: resp.StatusCode, Description: resp.Status}, resp.StatusCode, nil
+		}
+		return nil, resp.StatusCode, fmt.Errorf("failed to parse json response: %v", err)
 	}
+	return &apiResp, resp.StatusCode, nil
+}
 
-	return apiResp.Result.MessageID, nil
+// retryDelay menentukan apakah request boleh diulang dan berapa lama menunggu.
+// 429 memakai retry_after dari Telegram, 5xx memakai exponential backoff.
+func retryDelay(apiResp *apiResult, status int, attempt int) (time.Duration, bool) {
+	if apiResp.ErrorCode == http.StatusTooManyRequests || status == http.StatusTooManyRequests {
+		if apiResp.Parameters != nil && apiResp.Parameters.RetryAfter > 0 {
+			return time.Duration(apiResp.Parameters.RetryAfter) * time.Second, true
+		}
+		return time.Second, true
+	}
+
+	if apiResp.ErrorCode >= 500 || status >= 500 {
+		// Digandakan satu per satu (bukan shift) supaya attempt besar tidak overflow jadi negatif
+		delay := retryBaseDelay
+		for i := 0; i < attempt && delay < retryMaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+		return delay, true
+	}
+
+	return 0, false
 }
 
-// BARU: Fungsi untuk mengirim foto via URL
-func (c *Client) SendPhoto(req SendPhotoRequest) (int, error) {
-	if req.ParseMode == "" {
-		req.ParseMode = "HTML"
+// callMessage dipakai method yang mengembalikan Message, hasilnya ID pesan yang terkirim
+func (c *Client) callMessage(ctx context.Context, chatID int64, method string, payload interface{}) (int, error) {
+	var msg Message
+	if err := c.callChat(ctx, chatID, method, payload, &msg); err != nil {
+		return 0, err
 	}
+	return msg.MessageID, nil
+}
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return 0, fmt.Errorf("marshal error: %v", err)
+// GetUpdates mengambil update baru (long-polling). timeout dalam detik, 0 = langsung kembali.
+func (c *Client) GetUpdates(ctx context.Context, offset int, timeout int) ([]Update, error) {
+	req := GetUpdatesRequest{
+		Offset:  offset,
+		Timeout: timeout,
 	}
 
-	url := fmt.Sprintf("%s%s/sendPhoto", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return 0, fmt.Errorf("request error: %v", err)
+	var updates []Update
+	if err := c.call(ctx, "getUpdates", req, &updates); err != nil {
+		return nil, fmt.Errorf("failed to fetch updates: %w", err)
 	}
-	defer resp.Body.Close()
+	return updates, nil
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	var apiResp struct {
-		Ok          bool   `json:"ok"`
-		Result      Message `json:"result"`
-		Description string `json:"description"`
-	}
-	
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return 0, nil
+func (c *Client) SendChatAction(ctx context.Context, chatID int64, action string) error {
+	req := SendChatActionRequest{
+		ChatID: chatID,
+		Action: action,
 	}
+	return c.call(ctx, "sendChatAction", req, nil)
+}
 
-	if !apiResp.Ok {
-		return 0, fmt.Errorf("api error: %s", apiResp.Description)
+func (c *Client) SendMessage(ctx context.Context, chatID int64, text string) (int, error) {
+	req := SendMessageRequest{
+		ChatID:    chatID,
+		Text:      text,
+		ParseMode: "HTML",
 	}
-
-	return apiResp.Result.MessageID, nil
+	return c.SendMessageComplex(ctx, req)
 }
 
-func (c *Client) SendVideo(req SendVideoRequest) (int, error) {
-	if req.ParseMode == "" {
+func (c *Client) SendMessageComplex(ctx context.Context, req SendMessageRequest) (int, error) {
+	// Default HTML, kecuali format sudah diberikan lewat Entities (keduanya tidak boleh dipakai bersamaan)
+	if req.ParseMode == "" && len(req.Entities) == 0 {
 		req.ParseMode = "HTML"
 	}
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return 0, fmt.Errorf("marshal error: %v", err)
-	}
-
-	url := fmt.Sprintf("%s%s/sendVideo", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return 0, fmt.Errorf("request error: %v", err)
-	}
-	defer resp.Body.Close()
+	return c.callMessage(ctx, req.ChatID, "sendMessage", req)
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	var apiResp struct {
-		Ok          bool    `json:"ok"`
-		Result      Message `json:"result"`
-		Description string  `json:"description"`
-	}
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return 0, nil
-	}
-	if !apiResp.Ok {
-		return 0, fmt.Errorf("api error: %s", apiResp.Description)
+// BARU: Fungsi untuk mengirim foto via URL
+func (c *Client) SendPhoto(ctx context.Context, req SendPhotoRequest) (int, error) {
+	if req.ParseMode == "" {
+		req.ParseMode = "HTML"
 	}
-	return apiResp.Result.MessageID, nil
+	return c.callMessage(ctx, req.ChatID, "sendPhoto", req)
 }
 
-func (c *Client) SendInvoice(req SendInvoiceRequest) error {
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("failed to marshal invoice: %v", err)
+func (c *Client) SendVideo(ctx context.Context, req SendVideoRequest) (int, error) {
+	if req.ParseMode == "" {
+		req.ParseMode = "HTML"
 	}
+	return c.callMessage(ctx, req.ChatID, "sendVideo", req)
+}
 
-	url := fmt.Sprintf("%s%s/sendInvoice", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to send invoice: %v", err)
+func (c *Client) SendAnimation(ctx context.Context, req SendAnimationRequest) (int, error) {
+	if req.ParseMode == "" {
+		req.ParseMode = "HTML"
 	}
-	defer resp.Body.Close()
+	return c.callMessage(ctx, req.ChatID, "sendAnimation", req)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("telegram api error: %s", string(body))
+func (c *Client) SendInvoice(ctx context.Context, req SendInvoiceRequest) error {
+	if err := c.callChat(ctx, req.ChatID, "sendInvoice", req, nil); err != nil {
+		return fmt.Errorf("failed to send invoice: %w", err)
 	}
 	return nil
 }
 
 // [BARU] Fungsi Jawab PreCheckout (Wajib untuk Payments)
-func (c *Client) AnswerPreCheckoutQuery(queryID string, ok bool, errorMessage string) error {
+func (c *Client) AnswerPreCheckoutQuery(ctx context.Context, queryID string, ok bool, errorMessage string) error {
 	req := AnswerPreCheckoutQueryRequest{
 		PreCheckoutQueryID: queryID,
 		Ok:                 ok,
 		ErrorMessage:       errorMessage,
 	}
-	jsonData, _ := json.Marshal(req)
-
-	url := fmt.Sprintf("%s%s/answerPreCheckoutQuery", telegramAPIBase, c.Token)
-	_, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	return err
+	return c.call(ctx, "answerPreCheckoutQuery", req, nil)
 }
 
-func (c *Client) EditMessageText(chatID int64, messageID int, text string, replyMarkup interface{}) error {
+func (c *Client) EditMessageText(ctx context.Context, chatID int64, messageID int, text string, replyMarkup interface{}) error {
 	req := struct {
 		ChatID      int64       `json:"chat_id"`
 		MessageID   int         `json:"message_id"`
@@ -221,22 +273,19 @@ func (c *Client) EditMessageText(chatID int64, messageID int, text string, reply
 		ParseMode:   "HTML",
 		ReplyMarkup: replyMarkup,
 	}
+	return c.callChat(ctx, chatID, "editMessageText", req, nil)
+}
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return err
-	}
+// EditMessageTextComplex sama seperti EditMessageText tapi dengan request lengkap (entities, tanpa parse mode)
+func (c *Client) EditMessageTextComplex(ctx context.Context, req EditMessageTextRequest) error {
+	return c.callChat(ctx, req.ChatID, "editMessageText", req, nil)
+}
 
-	url := fmt.Sprintf("%s%s/editMessageText", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+func (c *Client) EditMessageCaption(ctx context.Context, req EditMessageCaptionRequest) error {
+	return c.callChat(ctx, req.ChatID, "editMessageCaption", req, nil)
 }
 
-func (c *Client) DeleteMessage(chatID int64, messageID int) error {
+func (c *Client) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
 	req := struct {
 		ChatID    int64 `json:"chat_id"`
 		MessageID int   `json:"message_id"`
@@ -244,18 +293,10 @@ func (c *Client) DeleteMessage(chatID int64, messageID int) error {
 		ChatID:    chatID,
 		MessageID: messageID,
 	}
-
-	jsonData, _ := json.Marshal(req)
-	url := fmt.Sprintf("%s%s/deleteMessage", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+	return c.call(ctx, "deleteMessage", req, nil)
 }
 
-func (c *Client) AnswerCallbackQuery(callbackQueryID string, text string, showAlert bool) {
+func (c *Client) AnswerCallbackQuery(ctx context.Context, callbackQueryID string, text string, showAlert bool) {
 	req := struct {
 		CallbackQueryID string `json:"callback_query_id"`
 		Text            string `json:"text,omitempty"`
@@ -265,55 +306,30 @@ func (c *Client) AnswerCallbackQuery(callbackQueryID string, text string, showAl
 		Text:            text,
 		ShowAlert:       showAlert,
 	}
-	jsonData, _ := json.Marshal(req)
-	url := fmt.Sprintf("%s%s/answerCallbackQuery", telegramAPIBase, c.Token)
-	_, _ = c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	_ = c.call(ctx, "answerCallbackQuery", req, nil)
 }
 
-func (c *Client) CopyMessage(toChatID int64, fromChatID int64, messageID int) (int, error) {
-	req := CopyMessageRequest{
+func (c *Client) CopyMessage(ctx context.Context, toChatID int64, fromChatID int64, messageID int) (int, error) {
+	return c.CopyMessageComplex(ctx, CopyMessageRequest{
 		ChatID:     toChatID,
 		FromChatID: fromChatID,
 		MessageID:  messageID,
-	}
-
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return 0, fmt.Errorf("marshal error: %v", err)
-	}
-
-	url := fmt.Sprintf("%s%s/copyMessage", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return 0, fmt.Errorf("request error: %v", err)
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var apiResp struct {
-		Ok          bool    `json:"ok"`
-		Result      struct{ MessageID int `json:"message_id"` } `json:"result"`
-		Description string  `json:"description"`
-	}
-	
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return 0, nil
-	}
-
-	if !apiResp.Ok {
-		return 0, fmt.Errorf("api error: %s", apiResp.Description)
-	}
+	})
+}
 
-	return apiResp.Result.MessageID, nil
+// CopyMessageComplex sama seperti CopyMessage tapi dengan request lengkap (mis. reply_parameters)
+func (c *Client) CopyMessageComplex(ctx context.Context, req CopyMessageRequest) (int, error) {
+	// copyMessage mengembalikan MessageId, bukan Message, tapi field-nya sama (message_id)
+	return c.callMessage(ctx, req.ChatID, "copyMessage", req)
 }
 
 // [BARU] Kirim Dadu Acak (1-6)
-func (c *Client) SendDice(chatID int64) (int, error) {
-	return c.SendDiceCustom(chatID, "🎲")
+func (c *Client) SendDice(ctx context.Context, chatID int64) (int, error) {
+	return c.SendDiceCustom(ctx, chatID, "🎲")
 }
 
 // [BARU] Kirim Dadu Custom (🏀, ⚽, 🎰)
-func (c *Client) SendDiceCustom(chatID int64, emoji string) (int, error) {
+func (c *Client) SendDiceCustom(ctx context.Context, chatID int64, emoji string) (int, error) {
 	req := struct {
 		ChatID int64  `json:"chat_id"`
 		Emoji  string `json:"emoji"`
@@ -321,114 +337,72 @@ func (c *Client) SendDiceCustom(chatID int64, emoji string) (int, error) {
 		ChatID: chatID,
 		Emoji:  emoji,
 	}
-
-	jsonData, _ := json.Marshal(req)
-	url := fmt.Sprintf("%s%s/sendDice", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-	return 0, nil
+	return c.callMessage(ctx, chatID, "sendDice", req)
 }
 
 // [PEMBARUAN 7] Fungsi Otomatis Set Command ke Telegram
-func (c *Client) SetMyCommands(commands []BotCommand, langCode string) error {
+func (c *Client) SetMyCommands(ctx context.Context, commands []BotCommand, langCode string) error {
 	req := SetMyCommandsRequest{
 		Commands: commands,
 		// Scope: all_private_chats (Command hanya muncul di chat pribadi, bukan grup)
 		Scope:        &BotCommandScope{Type: "all_private_chats"},
 		LanguageCode: langCode,
 	}
-
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("marshal error: %v", err)
-	}
-
-	url := fmt.Sprintf("%s%s/setMyCommands", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("request error: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Cek respon sukses
-	body, _ := io.ReadAll(resp.Body)
-	var apiResp struct {
-		Ok          bool   `json:"ok"`
-		Description string `json:"description"`
-	}
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return nil
-	}
-	if !apiResp.Ok {
-		return fmt.Errorf("api error: %s", apiResp.Description)
-	}
-	
-	return nil
+	return c.call(ctx, "setMyCommands", req, nil)
 }
 
-func (c *Client) AnswerInlineQuery(queryID string, results []interface{}) error {
+func (c *Client) AnswerInlineQuery(ctx context.Context, queryID string, results []interface{}) error {
 	req := AnswerInlineQueryRequest{
 		InlineQueryID: queryID,
 		Results:       results,
-		CacheTime:     0, 
+		CacheTime:     0,
 	}
-
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("marshal error: %v", err)
-	}
-
-	url := fmt.Sprintf("%s%s/answerInlineQuery", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+	return c.call(ctx, "answerInlineQuery", req, nil)
 }
 
-func (c *Client) GetBotUsername() string {
+func (c *Client) GetBotUsername(ctx context.Context) string {
 	// Cache sederhana bisa diterapkan di sini, tapi kita fetch sekali saja via getMe
-	url := fmt.Sprintf("%s%s/getMe", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Get(url)
-	if err != nil { return "bot" }
-	defer resp.Body.Close()
-	
-	body, _ := io.ReadAll(resp.Body)
-	var apiResp struct {
-		Result User `json:"result"`
+	var me User
+	if err := c.call(ctx, "getMe", struct{}{}, &me); err != nil {
+		return "bot"
 	}
-	json.Unmarshal(body, &apiResp)
-	return apiResp.Result.Username
+	return me.Username
 }
 
 // SendMessageWithMarkup mengirim pesan teks disertai tombol (Inline Keyboard)
-func (c *Client) SendMessageWithMarkup(chatID int64, text string, replyMarkup interface{}) error {
-	req := struct {
-		ChatID      int64       `json:"chat_id"`
-		Text        string      `json:"text"`
-		ParseMode   string      `json:"parse_mode"`
-		ReplyMarkup interface{} `json:"reply_markup"`
-	}{
+func (c *Client) SendMessageWithMarkup(ctx context.Context, chatID int64, text string, replyMarkup interface{}) error {
+	req := SendMessageRequest{
 		ChatID:      chatID,
 		Text:        text,
 		ParseMode:   "HTML",
 		ReplyMarkup: replyMarkup,
 	}
+	_, err := c.SendMessageComplex(ctx, req)
+	return err
+}
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("marshal error: %v", err)
+// SetWebhook mendaftarkan URL webhook ke Telegram.
+// secretToken akan dikirim balik oleh Telegram di header X-Telegram-Bot-Api-Secret-Token.
+func (c *Client) SetWebhook(ctx context.Context, webhookURL string, secretToken string) error {
+	req := SetWebhookRequest{
+		URL:         webhookURL,
+		SecretToken: secretToken,
 	}
+	return c.call(ctx, "setWebhook", req, nil)
+}
 
-	url := fmt.Sprintf("%s%s/sendMessage", telegramAPIBase, c.Token)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
+// DeleteWebhook menghapus webhook agar getUpdates (polling) bisa dipakai lagi
+func (c *Client) DeleteWebhook(ctx context.Context, dropPendingUpdates bool) error {
+	req := DeleteWebhookRequest{DropPendingUpdates: dropPendingUpdates}
+	return c.call(ctx, "deleteWebhook", req, nil)
+}
+
+// ConfirmUpdates memberi tahu Telegram bahwa semua update dengan ID < offset sudah diproses
+func (c *Client) ConfirmUpdates(ctx context.Context, offset int) error {
+	req := GetUpdatesRequest{
+		Offset:  offset,
+		Limit:   1,
+		Timeout: 0,
 	}
-	defer resp.Body.Close()
-	return nil
-}
\ No newline at end of file
+	return c.call(ctx, "getUpdates", req, nil)
+}
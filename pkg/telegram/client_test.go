@@ -0,0 +1,108 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient membuat Client tanpa rate limiter yang memanggil handler sebagai Bot API
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c := NewClient("TOKEN")
+	c.BaseURL = srv.URL
+	c.Limiter = nil
+	return c
+}
+
+func TestClientRetriesAfter429(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"result":{"message_id":7}}`)
+	})
+
+	start := time.Now()
+	id, err := c.SendMessage(context.Background(), 1, "hi")
+	if err != nil || id != 7 {
+		t.Fatalf("SendMessage = %d, %v; want 7 after retry", id, err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("calls = %d, want 2", calls.Load())
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Fatalf("retried after %v, want retry_after (1s)", waited)
+	}
+}
+
+func TestClientGivesUpWhenContextEndsDuringRetry(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 30","parameters":{"retry_after":30}}`)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.SendMessage(ctx, 1, "hi")
+	if time.Since(start) > time.Second {
+		t.Fatalf("retry wait ignored ctx: returned after %v", time.Since(start))
+	}
+	apiErr, ok := AsAPIError(err)
+	if !ok || apiErr.Code != http.StatusTooManyRequests || apiErr.RetryAfter != 30 {
+		t.Fatalf("err = %v, want APIError 429 with retry_after 30", err)
+	}
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`)
+	})
+
+	_, err := c.SendMessage(context.Background(), 1, "hi")
+	if !IsBotBlocked(err) || calls.Load() != 1 {
+		t.Fatalf("err = %v after %d calls, want one blocked error", err, calls.Load())
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	serverError := &apiResult{ErrorCode: http.StatusBadGateway}
+	tests := []struct {
+		name      string
+		resp      *apiResult
+		status    int
+		attempt   int
+		want      time.Duration
+		retryable bool
+	}{
+		{name: "429 retry_after", resp: &apiResult{ErrorCode: 429, Parameters: &ResponseParameters{RetryAfter: 5}}, status: 429, want: 5 * time.Second, retryable: true},
+		{name: "429 without retry_after", resp: &apiResult{ErrorCode: 429}, status: 429, want: time.Second, retryable: true},
+		{name: "5xx first", resp: serverError, status: 502, attempt: 0, want: retryBaseDelay, retryable: true},
+		{name: "5xx doubles", resp: serverError, status: 502, attempt: 2, want: 4 * retryBaseDelay, retryable: true},
+		{name: "5xx capped", resp: serverError, status: 502, attempt: 6, want: retryMaxDelay, retryable: true},
+		{name: "5xx huge attempt stays capped", resp: serverError, status: 502, attempt: 64, want: retryMaxDelay, retryable: true},
+		{name: "4xx not retried", resp: &apiResult{ErrorCode: 400}, status: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, retryable := retryDelay(tt.resp, tt.status, tt.attempt)
+			if got != tt.want || retryable != tt.retryable {
+				t.Fatalf("retryDelay = %v, %v; want %v, %v", got, retryable, tt.want, tt.retryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError adalah error terstruktur dari Bot API (response dengan "ok": false)
+type APIError struct {
+	Method          string
+	Code            int
+	Description     string
+	RetryAfter      int   // Detik, hanya terisi untuk 429 Too Many Requests
+	MigrateToChatID int64 // Terisi jika grup sudah di-upgrade menjadi supergroup
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("api error: %s %d %s", e.Method, e.Code, e.Description)
+}
+
+func newAPIError(method string, resp *apiResult) *APIError {
+	apiErr := &APIError{
+		Method:      method,
+		Code:        resp.ErrorCode,
+		Description: resp.Description,
+	}
+	if resp.Parameters != nil {
+		apiErr.RetryAfter = resp.Parameters.RetryAfter
+		apiErr.MigrateToChatID = resp.Parameters.MigrateToChatID
+	}
+	return apiErr
+}
+
+// AsAPIError mengambil *APIError dari err (termasuk yang sudah di-wrap)
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+func matchAPIError(err error, code int, text string) bool {
+	apiErr, ok := AsAPIError(err)
+	if !ok || apiErr.Code != code {
+		return false
+	}
+	return strings.Contains(strings.ToLower(apiErr.Description), text)
+}
+
+// IsBotBlocked: user memblokir bot ("Forbidden: bot was blocked by the user")
+func IsBotBlocked(err error) bool {
+	return matchAPIError(err, http.StatusForbidden, "blocked")
+}
+
+// IsUserDeactivated: akun Telegram user sudah dihapus
+func IsUserDeactivated(err error) bool {
+	return matchAPIError(err, http.StatusForbidden, "deactivated")
+}
+
+// IsChatNotFound: chat tidak ada atau bot belum pernah di-/start oleh user tersebut
+func IsChatNotFound(err error) bool {
+	return matchAPIError(err, http.StatusBadRequest, "chat not found")
+}
+
+// IsUnreachable: pesan ke user ini tidak akan pernah berhasil sampai user menghubungi bot lagi
+func IsUnreachable(err error) bool {
+	if IsChatNotFound(err) {
+		return true
+	}
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.Code == http.StatusForbidden
+}
+
+// IsMessageNotModified: editMessageText dengan isi yang sama persis
+func IsMessageNotModified(err error) bool {
+	return matchAPIError(err, http.StatusBadRequest, "message is not modified")
+}
@@ -0,0 +1,136 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Batas resmi Telegram: sekitar 30 pesan/detik untuk semua chat, dan 1 pesan/detik per chat
+// (burst pendek masih diizinkan).
+const (
+	DefaultGlobalRate = 30
+	DefaultChatRate   = 1
+	defaultChatBurst  = 3
+
+	// Bucket chat yang tidak dipakai selama ini akan dibuang agar map tidak terus membesar
+	chatBucketIdleTTL = 10 * time.Minute
+)
+
+// tokenBucket adalah token bucket sederhana: token bertambah `rate` per detik sampai maksimal `burst`
+type tokenBucket struct {
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	lastUsed time.Time
+}
+
+func newTokenBucket(rate float64, burst float64) *tokenBucket {
+	now := time.Now()
+	return &tokenBucket{
+		rate:     rate,
+		burst:    burst,
+		tokens:   burst,
+		last:     now,
+		lastUsed: now,
+	}
+}
+
+// reserve mengambil satu token dan mengembalikan berapa lama harus menunggu sampai token itu tersedia.
+// Token boleh "berhutang" (negatif) supaya pemanggil yang antri dilayani berurutan.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.lastUsed = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel mengembalikan token yang sudah di-reserve tapi tidak jadi dipakai
+func (b *tokenBucket) cancel() {
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// RateLimiter membatasi request kirim pesan secara global dan per chat
+type RateLimiter struct {
+	mu        sync.Mutex
+	global    *tokenBucket
+	chats     map[int64]*tokenBucket
+	chatRate  float64
+	chatBurst float64
+	lastSweep time.Time
+}
+
+// NewRateLimiter membuat limiter dengan batas global & per chat (pesan per detik)
+func NewRateLimiter(globalRate float64, chatRate float64) *RateLimiter {
+	return &RateLimiter{
+		global:    newTokenBucket(globalRate, globalRate),
+		chats:     make(map[int64]*tokenBucket),
+		chatRate:  chatRate,
+		chatBurst: defaultChatBurst,
+		lastSweep: time.Now(),
+	}
+}
+
+// Wait memblokir sampai request ke chatID boleh dikirim, atau ctx selesai
+func (l *RateLimiter) Wait(ctx context.Context, chatID int64) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.sweep(now)
+
+	chat, ok := l.chats[chatID]
+	if !ok {
+		chat = newTokenBucket(l.chatRate, l.chatBurst)
+		l.chats[chatID] = chat
+	}
+
+	delay := chat.reserve(now)
+	if globalDelay := l.global.reserve(now); globalDelay > delay {
+		delay = globalDelay
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Request batal: kembalikan token supaya antrian lain tidak ikut tertunda
+		l.mu.Lock()
+		chat.cancel()
+		l.global.cancel()
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// sweep membuang bucket chat yang sudah lama tidak dipakai. Harus dipanggil dengan mu terkunci.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < chatBucketIdleTTL {
+		return
+	}
+	l.lastSweep = now
+
+	for id, b := range l.chats {
+		if now.Sub(b.lastUsed) > chatBucketIdleTTL {
+			delete(l.chats, id)
+		}
+	}
+}
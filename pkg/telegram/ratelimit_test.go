@@ -0,0 +1,89 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	b := newTokenBucket(2, 3) // 2 token/detik, burst 3
+	b.last = start
+
+	// Burst habis tanpa menunggu
+	for i := 0; i < 3; i++ {
+		if d := b.reserve(start); d != 0 {
+			t.Fatalf("reserve %d within burst waited %v", i, d)
+		}
+	}
+	// Berikutnya berhutang: token ke-4 tersedia 0.5 detik lagi, ke-5 1 detik lagi
+	if d := b.reserve(start); d != 500*time.Millisecond {
+		t.Fatalf("4th reserve = %v, want 500ms", d)
+	}
+	if d := b.reserve(start); d != time.Second {
+		t.Fatalf("5th reserve = %v, want 1s", d)
+	}
+
+	// Dua reservasi dibatalkan: antrian berikutnya tidak ikut tertunda
+	b.cancel()
+	b.cancel()
+	if d := b.reserve(start); d != 500*time.Millisecond {
+		t.Fatalf("reserve after cancel = %v, want 500ms", d)
+	}
+
+	// Token terisi lagi seiring waktu, tapi tidak melebihi burst
+	later := start.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if d := b.reserve(later); d != 0 {
+			t.Fatalf("reserve %d after refill waited %v", i, d)
+		}
+	}
+	if d := b.reserve(later); d == 0 {
+		t.Fatal("refill exceeded burst")
+	}
+}
+
+func TestTokenBucketCancelCapsAtBurst(t *testing.T) {
+	b := newTokenBucket(1, 2)
+	b.cancel()
+	if b.tokens != 2 {
+		t.Fatalf("tokens after cancel on full bucket = %v, want 2", b.tokens)
+	}
+}
+
+func TestRateLimiterPerChat(t *testing.T) {
+	l := NewRateLimiter(1000, 1)
+	ctx := context.Background()
+
+	// Burst per chat habis dipakai chat 1
+	for i := 0; i < defaultChatBurst; i++ {
+		if err := l.Wait(ctx, 1); err != nil {
+			t.Fatalf("wait %d: %v", i, err)
+		}
+	}
+
+	// Chat lain tidak ikut tertunda
+	start := time.Now()
+	if err := l.Wait(ctx, 2); err != nil || time.Since(start) > 50*time.Millisecond {
+		t.Fatalf("other chat waited %v (err %v)", time.Since(start), err)
+	}
+
+	// Chat 1 harus menunggu sekitar 1 detik; ctx yang selesai duluan membatalkan tunggu dan mengembalikan token
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(waitCtx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait past burst = %v, want deadline exceeded", err)
+	}
+
+	l.mu.Lock()
+	tokens, global := l.chats[1].tokens, l.global.tokens
+	l.mu.Unlock()
+	if tokens < -0.1 {
+		t.Fatalf("cancelled wait kept its chat token: tokens = %v", tokens)
+	}
+	if global < 1000-defaultChatBurst-1-0.1 {
+		t.Fatalf("cancelled wait kept its global token: tokens = %v", global)
+	}
+}
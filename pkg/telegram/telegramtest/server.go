@@ -0,0 +1,650 @@
+// Package telegramtest menyediakan Bot API palsu (in-process) untuk test end-to-end.
+// Server mencatat semua pesan yang dikirim bot, bisa mensimulasikan user mengirim update
+// (pesan, tombol, inline query, pembayaran), dan bisa disuruh mengembalikan error tertentu.
+package telegramtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"otterchatbot/pkg/telegram"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Call adalah satu request yang diterima server, apa adanya
+type Call struct {
+	Method string
+	Params map[string]interface{}
+}
+
+// SentMessage adalah pesan yang dikirim bot ke sebuah chat
+type SentMessage struct {
+	Method    string // sendMessage, copyMessage, sendPhoto, sendVideo, sendDice, sendInvoice
+	ChatID    int64
+	MessageID int
+	Text      string // Text atau caption
+	Params    map[string]interface{}
+
+	// Terisi untuk copyMessage
+	FromChatID      int64
+	SourceMessageID int
+
+	ReplyMarkup *telegram.InlineKeyboardMarkup
+	Edited      bool
+	Deleted     bool
+}
+
+// Buttons mengembalikan semua tombol inline di pesan (baris demi baris digabung)
+func (m SentMessage) Buttons() []telegram.InlineKeyboardButton {
+	if m.ReplyMarkup == nil {
+		return nil
+	}
+	var buttons []telegram.InlineKeyboardButton
+	for _, row := range m.ReplyMarkup.InlineKeyboard {
+		buttons = append(buttons, row...)
+	}
+	return buttons
+}
+
+// CallbackAnswer dicatat dari answerCallbackQuery
+type CallbackAnswer struct {
+	QueryID   string
+	Text      string
+	ShowAlert bool
+}
+
+// PreCheckoutAnswer dicatat dari answerPreCheckoutQuery
+type PreCheckoutAnswer struct {
+	QueryID      string
+	Ok           bool
+	ErrorMessage string
+}
+
+// InlineAnswer dicatat dari answerInlineQuery
+type InlineAnswer struct {
+	QueryID string
+	Results []json.RawMessage
+}
+
+// Server adalah Bot API palsu. Buat dengan NewServer; server ditutup otomatis saat test selesai.
+type Server struct {
+	BotUser telegram.User
+
+	tb   testing.TB // Tempat melapor kesalahan pemakaian (mis. mengedit pesan yang tidak pernah dikirim)
+	http *httptest.Server
+
+	mu           sync.Mutex
+	calls        []Call
+	sent         []*SentMessage
+	userMessages map[int64]map[int]telegram.Message // chatID -> messageID -> pesan dari user
+	nextMsgID    map[int64]int
+	nextUpdateID int
+	nextQueryID  int
+	updates      []telegram.Update
+	newUpdate    chan struct{}
+
+	callbackAnswers    []CallbackAnswer
+	preCheckoutAnswers []PreCheckoutAnswer
+	inlineAnswers      []InlineAnswer
+
+	failures map[string][]telegram.APIError
+	blocked  map[int64]bool
+}
+
+// NewServer menjalankan Bot API palsu di port acak untuk test tb
+func NewServer(tb testing.TB) *Server {
+	s := &Server{
+		tb: tb,
+		BotUser: telegram.User{
+			ID:        1000,
+			IsBot:     true,
+			FirstName: "Otter",
+			Username:  "otter_test_bot",
+		},
+		userMessages: make(map[int64]map[int]telegram.Message),
+		nextMsgID:    make(map[int64]int),
+		nextUpdateID: 1,
+		newUpdate:    make(chan struct{}),
+		failures:     make(map[string][]telegram.APIError),
+		blocked:      make(map[int64]bool),
+	}
+	s.http = httptest.NewServer(http.HandlerFunc(s.serve))
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// URL adalah base URL untuk telegram.Client.BaseURL
+func (s *Server) URL() string {
+	return s.http.URL
+}
+
+// Close mematikan server
+func (s *Server) Close() {
+	s.http.Close()
+}
+
+// Client membuat telegram.Client yang mengarah ke server ini, tanpa rate limit dan retry
+func (s *Server) Client() *telegram.Client {
+	client := telegram.NewClient("TEST:TOKEN")
+	client.BaseURL = s.http.URL
+	client.HttpClient = s.http.Client()
+	client.Limiter = nil
+	client.MaxRetries = 0
+	return client
+}
+
+// --- Simulasi dari sisi user ---
+
+// SendText mensimulasikan user mengirim pesan teks ke bot
+func (s *Server) SendText(from telegram.User, text string) telegram.Update {
+	return s.SendMessage(from, telegram.Message{Text: text})
+}
+
+// SendMessage mensimulasikan user mengirim pesan apa saja (foto, video, stiker, ...).
+// MessageID, From, dan Chat diisi otomatis.
+func (s *Server) SendMessage(from telegram.User, msg telegram.Message) telegram.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := from
+	msg.MessageID = s.allocMessageID(from.ID)
+	msg.From = &user
+	msg.Chat = &telegram.Chat{ID: from.ID, Type: "private"}
+
+	if s.userMessages[from.ID] == nil {
+		s.userMessages[from.ID] = make(map[int]telegram.Message)
+	}
+	s.userMessages[from.ID][msg.MessageID] = msg
+
+	return s.pushUpdate(telegram.Update{Message: &msg})
+}
+
+// EditMessage mensimulasikan user mengedit pesan yang sudah dikirim (update edited_message).
+// Teks diganti dengan text, atau caption untuk pesan foto / video / voice.
+// Mengedit pesan yang tidak pernah dikirim user menggagalkan test (bukan panic).
+func (s *Server) EditMessage(from telegram.User, messageID int, text string) telegram.Update {
+	s.tb.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, ok := s.userMessages[from.ID][messageID]
+	if !ok {
+		s.tb.Fatalf("telegramtest: user %d never sent message %d", from.ID, messageID)
+		return telegram.Update{}
+	}
+	hasMedia := len(msg.Photo) > 0 || msg.Video != nil || msg.Voice != nil
+	if hasMedia {
+		msg.Caption = text
+	} else {
+		msg.Text = text
+	}
+	s.userMessages[from.ID][messageID] = msg
+
+	return s.pushUpdate(telegram.Update{EditedMessage: &msg})
+}
+
+// PressButton mensimulasikan user menekan tombol inline pada pesan bot
+func (s *Server) PressButton(from telegram.User, messageID int, data string) telegram.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := from
+	msg := telegram.Message{
+		MessageID: messageID,
+		From:      &s.BotUser,
+		Chat:      &telegram.Chat{ID: from.ID, Type: "private"},
+	}
+	if sent := s.findSent(from.ID, messageID); sent != nil {
+		msg.Text = sent.Text
+	}
+
+	s.nextQueryID++
+	cb := &telegram.CallbackQuery{
+		ID:      fmt.Sprintf("cb-%d", s.nextQueryID),
+		From:    &user,
+		Message: &msg,
+		Data:    data,
+	}
+	return s.pushUpdate(telegram.Update{CallbackQuery: cb})
+}
+
+// SendInlineQuery mensimulasikan user mengetik "@bot query" di chat lain
+func (s *Server) SendInlineQuery(from telegram.User, query string) telegram.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := from
+	s.nextQueryID++
+	iq := &telegram.InlineQuery{
+		ID:    fmt.Sprintf("iq-%d", s.nextQueryID),
+		From:  &user,
+		Query: query,
+	}
+	return s.pushUpdate(telegram.Update{InlineQuery: iq})
+}
+
+// PreCheckout mensimulasikan user menekan tombol bayar pada invoice
+func (s *Server) PreCheckout(from telegram.User, currency string, amount int, payload string) telegram.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := from
+	s.nextQueryID++
+	q := &telegram.PreCheckoutQuery{
+		ID:             fmt.Sprintf("pc-%d", s.nextQueryID),
+		From:           &user,
+		Currency:       currency,
+		TotalAmount:    amount,
+		InvoicePayload: payload,
+	}
+	return s.pushUpdate(telegram.Update{PreCheckoutQuery: q})
+}
+
+// SuccessfulPayment mensimulasikan pesan service "pembayaran berhasil" setelah pre-checkout disetujui
+func (s *Server) SuccessfulPayment(from telegram.User, currency string, amount int, payload string, chargeID string) telegram.Update {
+	return s.SendMessage(from, telegram.Message{
+		SuccessfulPayment: &telegram.SuccessfulPayment{
+			Currency:                currency,
+			TotalAmount:             amount,
+			InvoicePayload:          payload,
+			TelegramPaymentChargeID: chargeID,
+		},
+	})
+}
+
+// --- Injeksi error ---
+
+// FailNext membuat request berikutnya ke method tertentu gagal dengan error ini
+func (s *Server) FailNext(method string, apiErr telegram.APIError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], apiErr)
+}
+
+// BlockBot mensimulasikan user memblokir bot: semua pesan ke chat ini gagal dengan 403
+func (s *Server) BlockBot(userID int64, blocked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocked[userID] = blocked
+}
+
+// --- Hasil rekaman ---
+
+// Calls mengembalikan semua request ke method tertentu (kosong = semua method)
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var calls []Call
+	for _, c := range s.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Messages mengembalikan semua pesan yang dikirim bot ke chatID (termasuk yang sudah dihapus)
+func (s *Server) Messages(chatID int64) []SentMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []SentMessage
+	for _, m := range s.sent {
+		if m.ChatID == chatID {
+			messages = append(messages, *m)
+		}
+	}
+	return messages
+}
+
+// LastMessage mengembalikan pesan terakhir yang dikirim bot ke chatID
+func (s *Server) LastMessage(chatID int64) (SentMessage, bool) {
+	messages := s.Messages(chatID)
+	if len(messages) == 0 {
+		return SentMessage{}, false
+	}
+	return messages[len(messages)-1], true
+}
+
+// LastInvoice mengembalikan invoice terakhir yang dikirim ke chatID
+func (s *Server) LastInvoice(chatID int64) (SentMessage, bool) {
+	messages := s.Messages(chatID)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Method == "sendInvoice" {
+			return messages[i], true
+		}
+	}
+	return SentMessage{}, false
+}
+
+func (s *Server) CallbackAnswers() []CallbackAnswer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CallbackAnswer(nil), s.callbackAnswers...)
+}
+
+func (s *Server) PreCheckoutAnswers() []PreCheckoutAnswer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PreCheckoutAnswer(nil), s.preCheckoutAnswers...)
+}
+
+func (s *Server) InlineAnswers() []InlineAnswer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]InlineAnswer(nil), s.inlineAnswers...)
+}
+
+// Reset menghapus semua rekaman (update yang belum diambil tetap ada)
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = nil
+	s.sent = nil
+	s.callbackAnswers = nil
+	s.preCheckoutAnswers = nil
+	s.inlineAnswers = nil
+}
+
+// --- Internal ---
+
+// allocMessageID memberi ID pesan berikutnya di sebuah chat. Harus dipanggil dengan mu terkunci.
+func (s *Server) allocMessageID(chatID int64) int {
+	s.nextMsgID[chatID]++
+	return s.nextMsgID[chatID]
+}
+
+// pushUpdate memberi UpdateID dan memasukkan update ke antrian getUpdates. Harus dipanggil dengan mu terkunci.
+func (s *Server) pushUpdate(update telegram.Update) telegram.Update {
+	update.UpdateID = s.nextUpdateID
+	s.nextUpdateID++
+	s.updates = append(s.updates, update)
+
+	// Bangunkan getUpdates yang sedang long-polling
+	close(s.newUpdate)
+	s.newUpdate = make(chan struct{})
+	return update
+}
+
+func (s *Server) findSent(chatID int64, messageID int) *SentMessage {
+	for _, m := range s.sent {
+		if m.ChatID == chatID && m.MessageID == messageID {
+			return m
+		}
+	}
+	return nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	// Path: /bot<token>/<method>
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		writeError(w, telegram.APIError{Code: http.StatusNotFound, Description: "Not Found"})
+		return
+	}
+	method := parts[1]
+
+	body, _ := io.ReadAll(r.Body)
+	params := map[string]interface{}{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &params); err != nil {
+			writeError(w, telegram.APIError{Code: http.StatusBadRequest, Description: "Bad Request: invalid JSON"})
+			return
+		}
+	}
+
+	if method == "getUpdates" {
+		s.serveGetUpdates(r.Context(), w, params)
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: method, Params: params})
+
+	if queued := s.failures[method]; len(queued) > 0 {
+		s.failures[method] = queued[1:]
+		s.mu.Unlock()
+		writeError(w, queued[0])
+		return
+	}
+
+	result, apiErr := s.handle(method, params)
+	s.mu.Unlock()
+
+	if apiErr != nil {
+		writeError(w, *apiErr)
+		return
+	}
+	writeResult(w, result)
+}
+
+// handle menjalankan method Bot API. Dipanggil dengan mu terkunci.
+func (s *Server) handle(method string, params map[string]interface{}) (interface{}, *telegram.APIError) {
+	switch method {
+	case "sendMessage", "sendPhoto", "sendVideo", "sendAnimation", "sendDice", "sendInvoice", "copyMessage":
+		chatID := int64Param(params, "chat_id")
+		if s.blocked[chatID] {
+			return nil, &telegram.APIError{Code: http.StatusForbidden, Description: "Forbidden: bot was blocked by the user"}
+		}
+
+		msg := &SentMessage{
+			Method:    method,
+			ChatID:    chatID,
+			MessageID: s.allocMessageID(chatID),
+			Text:      stringParam(params, "text"),
+			Params:    params,
+		}
+		if msg.Text == "" {
+			msg.Text = stringParam(params, "caption")
+		}
+		if method == "copyMessage" {
+			msg.FromChatID = int64Param(params, "from_chat_id")
+			msg.SourceMessageID = int(int64Param(params, "message_id"))
+			source, ok := s.userMessages[msg.FromChatID][msg.SourceMessageID]
+			if !ok {
+				return nil, &telegram.APIError{Code: http.StatusBadRequest, Description: "Bad Request: message to copy not found"}
+			}
+			if msg.Text == "" {
+				msg.Text = source.Text + source.Caption
+			}
+		}
+		if method == "sendInvoice" {
+			msg.Text = stringParam(params, "title")
+		}
+		msg.ReplyMarkup = markupParam(params)
+		s.sent = append(s.sent, msg)
+
+		return telegram.Message{
+			MessageID: msg.MessageID,
+			From:      &s.BotUser,
+			Chat:      &telegram.Chat{ID: chatID, Type: "private"},
+			Text:      msg.Text,
+		}, nil
+
+	case "editMessageText":
+		chatID := int64Param(params, "chat_id")
+		msg := s.findSent(chatID, int(int64Param(params, "message_id")))
+		if msg == nil || msg.Deleted {
+			return nil, &telegram.APIError{Code: http.StatusBadRequest, Description: "Bad Request: message to edit not found"}
+		}
+		text := stringParam(params, "text")
+		markup := markupParam(params)
+		if text == msg.Text && markup == nil && msg.ReplyMarkup == nil {
+			return nil, &telegram.APIError{Code: http.StatusBadRequest, Description: "Bad Request: message is not modified"}
+		}
+		msg.Text = text
+		msg.Params = params
+		msg.ReplyMarkup = markup
+		msg.Edited = true
+		return telegram.Message{MessageID: msg.MessageID, Chat: &telegram.Chat{ID: chatID}, Text: text}, nil
+
+	case "editMessageCaption":
+		chatID := int64Param(params, "chat_id")
+		msg := s.findSent(chatID, int(int64Param(params, "message_id")))
+		if msg == nil || msg.Deleted {
+			return nil, &telegram.APIError{Code: http.StatusBadRequest, Description: "Bad Request: message to edit not found"}
+		}
+		caption := stringParam(params, "caption")
+		if caption == msg.Text {
+			return nil, &telegram.APIError{Code: http.StatusBadRequest, Description: "Bad Request: message is not modified"}
+		}
+		msg.Text = caption
+		msg.Edited = true
+		return telegram.Message{MessageID: msg.MessageID, Chat: &telegram.Chat{ID: chatID}, Caption: caption}, nil
+
+	case "deleteMessage":
+		msg := s.findSent(int64Param(params, "chat_id"), int(int64Param(params, "message_id")))
+		if msg == nil || msg.Deleted {
+			return nil, &telegram.APIError{Code: http.StatusBadRequest, Description: "Bad Request: message to delete not found"}
+		}
+		msg.Deleted = true
+		return true, nil
+
+	case "answerCallbackQuery":
+		s.callbackAnswers = append(s.callbackAnswers, CallbackAnswer{
+			QueryID:   stringParam(params, "callback_query_id"),
+			Text:      stringParam(params, "text"),
+			ShowAlert: params["show_alert"] == true,
+		})
+		return true, nil
+
+	case "answerPreCheckoutQuery":
+		s.preCheckoutAnswers = append(s.preCheckoutAnswers, PreCheckoutAnswer{
+			QueryID:      stringParam(params, "pre_checkout_query_id"),
+			Ok:           params["ok"] == true,
+			ErrorMessage: stringParam(params, "error_message"),
+		})
+		return true, nil
+
+	case "answerInlineQuery":
+		answer := InlineAnswer{QueryID: stringParam(params, "inline_query_id")}
+		if results, ok := params["results"].([]interface{}); ok {
+			for _, r := range results {
+				raw, _ := json.Marshal(r)
+				answer.Results = append(answer.Results, raw)
+			}
+		}
+		s.inlineAnswers = append(s.inlineAnswers, answer)
+		return true, nil
+
+	case "getMe":
+		return s.BotUser, nil
+
+	case "sendChatAction", "setMyCommands", "setWebhook", "deleteWebhook":
+		return true, nil
+	}
+
+	return nil, &telegram.APIError{Code: http.StatusNotFound, Description: "Not Found: method not found"}
+}
+
+// serveGetUpdates meniru long-polling: tunggu sampai ada update baru atau timeout habis
+func (s *Server) serveGetUpdates(ctx context.Context, w http.ResponseWriter, params map[string]interface{}) {
+	offset := int(int64Param(params, "offset"))
+	limit := int(int64Param(params, "limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	timeout := time.Duration(int64Param(params, "timeout")) * time.Second
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		s.mu.Lock()
+		s.calls = append(s.calls, Call{Method: "getUpdates", Params: params})
+
+		// Seperti Telegram: offset mengkonfirmasi (membuang) semua update dengan ID lebih kecil
+		kept := s.updates[:0]
+		for _, u := range s.updates {
+			if u.UpdateID >= offset {
+				kept = append(kept, u)
+			}
+		}
+		s.updates = kept
+
+		if len(s.updates) > 0 || timeout <= 0 {
+			n := len(s.updates)
+			if n > limit {
+				n = limit
+			}
+			result := append([]telegram.Update{}, s.updates[:n]...)
+			s.mu.Unlock()
+			writeResult(w, result)
+			return
+		}
+
+		wait := s.newUpdate
+		s.mu.Unlock()
+
+		select {
+		case <-wait:
+			timeout = time.Nanosecond // Ambil update yang baru masuk lalu langsung kembali
+		case <-deadline.C:
+			writeResult(w, []telegram.Update{})
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+func writeError(w http.ResponseWriter, apiErr telegram.APIError) {
+	resp := map[string]interface{}{
+		"ok":          false,
+		"error_code":  apiErr.Code,
+		"description": apiErr.Description,
+	}
+
+	parameters := map[string]interface{}{}
+	if apiErr.RetryAfter > 0 {
+		parameters["retry_after"] = apiErr.RetryAfter
+	}
+	if apiErr.MigrateToChatID != 0 {
+		parameters["migrate_to_chat_id"] = apiErr.MigrateToChatID
+	}
+	if len(parameters) > 0 {
+		resp["parameters"] = parameters
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func int64Param(params map[string]interface{}, key string) int64 {
+	// encoding/json men-decode angka ke float64
+	if v, ok := params[key].(float64); ok {
+		return int64(v)
+	}
+	return 0
+}
+
+func stringParam(params map[string]interface{}, key string) string {
+	v, _ := params[key].(string)
+	return v
+}
+
+func markupParam(params map[string]interface{}) *telegram.InlineKeyboardMarkup {
+	raw, ok := params["reply_markup"]
+	if !ok || raw == nil {
+		return nil
+	}
+	data, _ := json.Marshal(raw)
+	var markup telegram.InlineKeyboardMarkup
+	if err := json.Unmarshal(data, &markup); err != nil || len(markup.InlineKeyboard) == 0 {
+		return nil
+	}
+	return &markup
+}
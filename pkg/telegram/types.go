@@ -3,6 +3,7 @@ package telegram
 type Update struct {
 	UpdateID      int            `json:"update_id"`
 	Message       *Message       `json:"message"`
+	EditedMessage *Message       `json:"edited_message"` // Pesan lama yang diedit user (isi terbaru)
 	CallbackQuery *CallbackQuery `json:"callback_query"`
 	PreCheckoutQuery   *PreCheckoutQuery `json:"pre_checkout_query"`
 	InlineQuery        *InlineQuery      `json:"inline_query"`
@@ -13,12 +14,33 @@ type Message struct {
 	From      *User  `json:"from"`
 	Chat      *Chat  `json:"chat"`
 	Text      string `json:"text"`
+	ReplyToMessage     *Message           `json:"reply_to_message"` // Pesan yang dibalas (reply)
+	Entities           []MessageEntity    `json:"entities"`
 	Caption            string             `json:"caption"`
+	CaptionEntities    []MessageEntity    `json:"caption_entities"`
 	SuccessfulPayment  *SuccessfulPayment `json:"successful_payment"`
 	Photo              []PhotoSize        `json:"photo"`
 	Video              *Video             `json:"video"`
 	Voice              *Voice             `json:"voice"`
 	Sticker            *Sticker           `json:"sticker"`
+	Location           *Location          `json:"location"`
+	Document           *Document          `json:"document"`
+	Animation          *Animation         `json:"animation"` // GIF; Telegram juga mengisi Document untuk pesan ini
+	VideoNote          *VideoNote         `json:"video_note"`
+	Audio              *Audio             `json:"audio"`
+	Contact            *Contact           `json:"contact"`
+	Poll               *Poll              `json:"poll"`
+}
+
+// MessageEntity adalah format di dalam teks (bold, link, dll). Dikirim ulang apa adanya saat relay edit.
+type MessageEntity struct {
+	Type          string `json:"type"`
+	Offset        int    `json:"offset"`
+	Length        int    `json:"length"`
+	URL           string `json:"url,omitempty"`
+	User          *User  `json:"user,omitempty"`
+	Language      string `json:"language,omitempty"`
+	CustomEmojiID string `json:"custom_emoji_id,omitempty"`
 }
 
 type PhotoSize struct {
@@ -37,11 +59,62 @@ type Voice struct {
 	FileID string `json:"file_id"`
 }
 
+// Location adalah lokasi yang dibagikan user (tombol "Share Location")
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
 // [BARU] Struct Sticker
 type Sticker struct {
 	FileID string `json:"file_id"`
 }
 
+// Document adalah file biasa (bukan foto/video/audio yang dikenali Telegram)
+type Document struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+}
+
+// Animation adalah GIF atau video pendek tanpa suara
+type Animation struct {
+	FileID   string `json:"file_id"`
+	MimeType string `json:"mime_type"`
+}
+
+// VideoNote adalah video bulat (pesan video singkat)
+type VideoNote struct {
+	FileID   string `json:"file_id"`
+	Duration int    `json:"duration"`
+}
+
+type Audio struct {
+	FileID    string `json:"file_id"`
+	Title     string `json:"title"`
+	Performer string `json:"performer"`
+}
+
+// Contact adalah kontak yang dibagikan (bisa nomor HP pengirim sendiri)
+type Contact struct {
+	PhoneNumber string `json:"phone_number"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	UserID      int64  `json:"user_id"`
+}
+
+type Poll struct {
+	ID       string       `json:"id"`
+	Question string       `json:"question"`
+	Options  []PollOption `json:"options"`
+	Type     string       `json:"type"` // regular atau quiz
+}
+
+type PollOption struct {
+	Text       string `json:"text"`
+	VoterCount int    `json:"voter_count"`
+}
+
 type CallbackQuery struct {
 	ID      string   `json:"id"`
 	From    *User    `json:"from"`
@@ -84,28 +157,53 @@ type LabeledPrice struct {
 }
 
 type SendMessageRequest struct {
-	ChatID      int64       `json:"chat_id"`
-	Text        string      `json:"text"`
-	ParseMode   string      `json:"parse_mode,omitempty"`
-	ReplyMarkup interface{} `json:"reply_markup,omitempty"`
+	ChatID          int64            `json:"chat_id"`
+	Text            string           `json:"text"`
+	ParseMode       string           `json:"parse_mode,omitempty"`
+	Entities        []MessageEntity  `json:"entities,omitempty"` // Format teks eksplisit (tanpa ParseMode)
+	ProtectContent  bool             `json:"protect_content,omitempty"` // Tidak bisa di-forward / disimpan penerima
+	ReplyParameters *ReplyParameters `json:"reply_parameters,omitempty"`
+	ReplyMarkup     interface{}      `json:"reply_markup,omitempty"`
+}
+
+// ReplyParameters menjadikan pesan yang dikirim sebagai balasan (reply) ke pesan lain di chat yang sama
+type ReplyParameters struct {
+	MessageID int `json:"message_id"`
+	// Tetap kirim walau pesan yang dibalas sudah dihapus
+	AllowSendingWithoutReply bool `json:"allow_sending_without_reply,omitempty"`
 }
 
 type SendPhotoRequest struct {
-	ChatID      int64       `json:"chat_id"`
-	Photo       string      `json:"photo"`
-	Caption     string      `json:"caption,omitempty"`
-	ParseMode   string      `json:"parse_mode,omitempty"`
-	HasSpoiler  bool        `json:"has_spoiler,omitempty"` // Efek Blur
-	ReplyMarkup interface{} `json:"reply_markup,omitempty"`
+	ChatID          int64            `json:"chat_id"`
+	Photo           string           `json:"photo"`
+	Caption         string           `json:"caption,omitempty"`
+	ParseMode       string           `json:"parse_mode,omitempty"`
+	HasSpoiler      bool             `json:"has_spoiler,omitempty"` // Efek Blur
+	ProtectContent  bool             `json:"protect_content,omitempty"`
+	ReplyParameters *ReplyParameters `json:"reply_parameters,omitempty"`
+	ReplyMarkup     interface{}      `json:"reply_markup,omitempty"`
 }
 
 type SendVideoRequest struct {
-	ChatID      int64       `json:"chat_id"`
-	Video       string      `json:"video"`
-	Caption     string      `json:"caption,omitempty"`
-	ParseMode   string      `json:"parse_mode,omitempty"`
-	HasSpoiler  bool        `json:"has_spoiler,omitempty"` // Efek Blur
-	ReplyMarkup interface{} `json:"reply_markup,omitempty"`
+	ChatID          int64            `json:"chat_id"`
+	Video           string           `json:"video"`
+	Caption         string           `json:"caption,omitempty"`
+	ParseMode       string           `json:"parse_mode,omitempty"`
+	HasSpoiler      bool             `json:"has_spoiler,omitempty"` // Efek Blur
+	ProtectContent  bool             `json:"protect_content,omitempty"`
+	ReplyParameters *ReplyParameters `json:"reply_parameters,omitempty"`
+	ReplyMarkup     interface{}      `json:"reply_markup,omitempty"`
+}
+
+type SendAnimationRequest struct {
+	ChatID          int64            `json:"chat_id"`
+	Animation       string           `json:"animation"`
+	Caption         string           `json:"caption,omitempty"`
+	ParseMode       string           `json:"parse_mode,omitempty"`
+	HasSpoiler      bool             `json:"has_spoiler,omitempty"` // Efek Blur
+	ProtectContent  bool             `json:"protect_content,omitempty"`
+	ReplyParameters *ReplyParameters `json:"reply_parameters,omitempty"`
+	ReplyMarkup     interface{}      `json:"reply_markup,omitempty"`
 }
 
 type SendChatActionRequest struct {
@@ -148,10 +246,49 @@ type InlineKeyboardButton struct {
 	Pay          bool   `json:"pay,omitempty"`
 }
 
+// ReplyKeyboardMarkup adalah keyboard biasa di bawah kolom ketik (dipakai untuk tombol minta lokasi)
+type ReplyKeyboardMarkup struct {
+	Keyboard        [][]KeyboardButton `json:"keyboard"`
+	ResizeKeyboard  bool               `json:"resize_keyboard,omitempty"`
+	OneTimeKeyboard bool               `json:"one_time_keyboard,omitempty"`
+}
+
+type KeyboardButton struct {
+	Text            string `json:"text"`
+	RequestLocation bool   `json:"request_location,omitempty"`
+}
+
+// ReplyKeyboardRemove menyembunyikan ReplyKeyboardMarkup yang sedang tampil
+type ReplyKeyboardRemove struct {
+	RemoveKeyboard bool `json:"remove_keyboard"`
+}
+
 type CopyMessageRequest struct {
-	ChatID     int64 `json:"chat_id"`      // Ke mana pesan dikirim
-	FromChatID int64 `json:"from_chat_id"` // Dari mana pesan berasal
-	MessageID  int   `json:"message_id"`   // ID Pesan yang mau dikopi
+	ChatID          int64            `json:"chat_id"`      // Ke mana pesan dikirim
+	FromChatID      int64            `json:"from_chat_id"` // Dari mana pesan berasal
+	MessageID       int              `json:"message_id"`   // ID Pesan yang mau dikopi
+	ProtectContent  bool             `json:"protect_content,omitempty"`
+	ReplyParameters *ReplyParameters `json:"reply_parameters,omitempty"`
+}
+
+// EditMessageTextRequest mengedit teks pesan. Pakai Entities (tanpa ParseMode) untuk menyalin format pesan user.
+type EditMessageTextRequest struct {
+	ChatID      int64           `json:"chat_id"`
+	MessageID   int             `json:"message_id"`
+	Text        string          `json:"text"`
+	ParseMode   string          `json:"parse_mode,omitempty"`
+	Entities    []MessageEntity `json:"entities,omitempty"`
+	ReplyMarkup interface{}     `json:"reply_markup,omitempty"`
+}
+
+// EditMessageCaptionRequest mengedit caption foto / video / voice
+type EditMessageCaptionRequest struct {
+	ChatID          int64           `json:"chat_id"`
+	MessageID       int             `json:"message_id"`
+	Caption         string          `json:"caption"`
+	ParseMode       string          `json:"parse_mode,omitempty"`
+	CaptionEntities []MessageEntity `json:"caption_entities,omitempty"`
+	ReplyMarkup     interface{}     `json:"reply_markup,omitempty"`
 }
 
 // [PEMBARUAN 6] Struktur untuk SetMyCommands
@@ -196,4 +333,36 @@ type AnswerInlineQueryRequest struct {
 	InlineQueryID string        `json:"inline_query_id"`
 	Results       []interface{} `json:"results"`
 	CacheTime     int           `json:"cache_time"`
-}
\ No newline at end of file
+}
+type SetWebhookRequest struct {
+	URL            string   `json:"url"`
+	SecretToken    string   `json:"secret_token,omitempty"`
+	AllowedUpdates []string `json:"allowed_updates,omitempty"`
+}
+
+type DeleteWebhookRequest struct {
+	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"`
+}
+
+// SenderID mengembalikan ID user yang memicu update ini (0 jika tidak diketahui)
+func (u Update) SenderID() int64 {
+	switch {
+	case u.Message != nil && u.Message.From != nil:
+		return u.Message.From.ID
+	case u.EditedMessage != nil && u.EditedMessage.From != nil:
+		return u.EditedMessage.From.ID
+	case u.CallbackQuery != nil && u.CallbackQuery.From != nil:
+		return u.CallbackQuery.From.ID
+	case u.PreCheckoutQuery != nil && u.PreCheckoutQuery.From != nil:
+		return u.PreCheckoutQuery.From.ID
+	case u.InlineQuery != nil && u.InlineQuery.From != nil:
+		return u.InlineQuery.From.ID
+	}
+	return 0
+}
+
+type GetUpdatesRequest struct {
+	Offset  int `json:"offset,omitempty"`
+	Limit   int `json:"limit,omitempty"`
+	Timeout int `json:"timeout"`
+}
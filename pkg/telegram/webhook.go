@@ -0,0 +1,65 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Header yang dikirim Telegram berisi secret_token dari setWebhook
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Batas ukuran body update (update Telegram jauh di bawah ini)
+const maxWebhookBody = 1 << 20
+
+// WebhookHandler menerima update dari Telegram via HTTP POST
+type WebhookHandler struct {
+	SecretToken string
+	OnUpdate    func(context.Context, Update) error
+}
+
+func NewWebhookHandler(secretToken string, onUpdate func(context.Context, Update) error) *WebhookHandler {
+	return &WebhookHandler{
+		SecretToken: secretToken,
+		OnUpdate:    onUpdate,
+	}
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Tolak request yang tidak membawa secret yang benar (bukan dari Telegram)
+	if h.SecretToken != "" {
+		got := r.Header.Get(webhookSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(h.SecretToken)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var update Update
+	if err := json.Unmarshal(body, &update); err != nil {
+		log.Printf("Webhook: invalid update payload: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Jika update gagal diterima (misal sedang shutdown), Telegram akan mengirim ulang
+	if err := h.OnUpdate(r.Context(), update); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
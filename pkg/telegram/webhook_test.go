@@ -0,0 +1,70 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	const body = `{"update_id":42,"message":{"message_id":1,"chat":{"id":7},"text":"hi"}}`
+	tests := []struct {
+		name      string
+		method    string
+		secret    string
+		body      string
+		onUpdate  error
+		want      int
+		delivered bool
+	}{
+		{name: "valid secret", method: http.MethodPost, secret: "s3cret", body: body, want: http.StatusOK, delivered: true},
+		{name: "missing secret", method: http.MethodPost, body: body, want: http.StatusUnauthorized},
+		{name: "wrong secret", method: http.MethodPost, secret: "guess", body: body, want: http.StatusUnauthorized},
+		{name: "secret prefix", method: http.MethodPost, secret: "s3c", body: body, want: http.StatusUnauthorized},
+		{name: "not POST", method: http.MethodGet, secret: "s3cret", want: http.StatusMethodNotAllowed},
+		{name: "invalid payload", method: http.MethodPost, secret: "s3cret", body: "{", want: http.StatusBadRequest},
+		{name: "update rejected", method: http.MethodPost, secret: "s3cret", body: body, onUpdate: errors.New("shutting down"), want: http.StatusServiceUnavailable, delivered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Update
+			h := NewWebhookHandler("s3cret", func(ctx context.Context, u Update) error {
+				got = &u
+				return tt.onUpdate
+			})
+
+			req := httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.body))
+			if tt.secret != "" {
+				req.Header.Set(webhookSecretHeader, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if delivered := got != nil; delivered != tt.delivered {
+				t.Fatalf("update delivered = %v, want %v", delivered, tt.delivered)
+			}
+			if got != nil && got.UpdateID != 42 {
+				t.Fatalf("update_id = %d, want 42", got.UpdateID)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerWithoutSecretAcceptsAll(t *testing.T) {
+	delivered := false
+	h := NewWebhookHandler("", func(ctx context.Context, u Update) error {
+		delivered = true
+		return nil
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"update_id":1}`)))
+	if rec.Code != http.StatusOK || !delivered {
+		t.Fatalf("status = %d, delivered = %v; want 200 and delivered", rec.Code, delivered)
+	}
+}
@@ -0,0 +1,118 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Translator menerjemahkan teks antar bahasa (kode bahasa bot: "id", "en", "ru")
+type Translator interface {
+	Translate(ctx context.Context, text string, from string, to string) (string, error)
+}
+
+// ErrUnsupported dikembalikan jika pasangan bahasa tidak didukung
+var ErrUnsupported = errors.New("translate: language pair not supported")
+
+// DictionaryTranslator adalah Translator lokal berbasis kamus kata per kata.
+// Tidak butuh layanan eksternal, cocok untuk development dan test; hasilnya kasar untuk kalimat panjang.
+type DictionaryTranslator struct {
+	mu    sync.RWMutex
+	words map[string]map[string]string // "id>en" -> "halo" -> "hello"
+}
+
+func NewDictionaryTranslator() *DictionaryTranslator {
+	return &DictionaryTranslator{words: make(map[string]map[string]string)}
+}
+
+// LoadDictionary membaca kamus JSON dengan format {"id": {"en": {"halo": "hello"}}}
+func LoadDictionary(path string) (*DictionaryTranslator, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]map[string]map[string]string
+	if err := json.Unmarshal(file, &raw); err != nil {
+		return nil, err
+	}
+
+	d := NewDictionaryTranslator()
+	for from, targets := range raw {
+		for to, words := range targets {
+			d.Add(from, to, words)
+		}
+	}
+	return d, nil
+}
+
+// Add menambahkan kata ke kamus from -> to
+func (d *DictionaryTranslator) Add(from string, to string, words map[string]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := from + ">" + to
+	if d.words[key] == nil {
+		d.words[key] = make(map[string]string)
+	}
+	for src, dst := range words {
+		d.words[key][strings.ToLower(src)] = dst
+	}
+}
+
+// Translate mengganti setiap kata yang ada di kamus; kata lain dan tanda baca dibiarkan apa adanya
+func (d *DictionaryTranslator) Translate(ctx context.Context, text string, from string, to string) (string, error) {
+	if from == to {
+		return text, nil
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	dict, ok := d.words[from+">"+to]
+	if !ok {
+		return "", ErrUnsupported
+	}
+
+	var out strings.Builder
+	var word []rune
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		if t, ok := dict[strings.ToLower(w)]; ok {
+			out.WriteString(matchCase(w, t))
+		} else {
+			out.WriteString(w)
+		}
+		word = word[:0]
+	}
+
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		out.WriteRune(r)
+	}
+	flush()
+
+	return out.String(), nil
+}
+
+// matchCase menyamakan huruf kapital awal hasil terjemahan dengan kata aslinya
+func matchCase(original string, translated string) string {
+	first := []rune(original)[0]
+	if !unicode.IsUpper(first) || translated == "" {
+		return translated
+	}
+	runes := []rune(translated)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
@@ -0,0 +1,57 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDictionaryTranslator(t *testing.T) {
+	ctx := context.Background()
+	d := NewDictionaryTranslator()
+	d.Add("id", "en", map[string]string{"Halo": "hello", "apa": "what", "kabar": "news"})
+
+	tests := []struct {
+		name     string
+		text     string
+		from, to string
+		want     string
+		err      error
+	}{
+		{name: "word by word", text: "halo, apa kabar?", from: "id", to: "en", want: "hello, what news?"},
+		{name: "keeps capital", text: "Halo Budi", from: "id", to: "en", want: "Hello Budi"},
+		{name: "unknown words unchanged", text: "selamat pagi", from: "id", to: "en", want: "selamat pagi"},
+		{name: "same language", text: "halo", from: "id", to: "id", want: "halo"},
+		{name: "unsupported pair", text: "halo", from: "id", to: "ru", err: ErrUnsupported},
+		{name: "no reverse pair", text: "hello", from: "en", to: "id", err: ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.Translate(ctx, tt.text, tt.from, tt.to)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Fatalf("Translate = %q, %v; want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadDictionary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dict.json")
+	if err := os.WriteFile(path, []byte(`{"en": {"ru": {"hello": "привет"}}}`), 0o600); err != nil {
+		t.Fatalf("write dictionary: %v", err)
+	}
+
+	d, err := LoadDictionary(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got, err := d.Translate(context.Background(), "Hello!", "en", "ru"); err != nil || got != "Привет!" {
+		t.Fatalf("Translate = %q, %v; want %q", got, err, "Привет!")
+	}
+
+	if _, err := LoadDictionary(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("loading a missing dictionary succeeded")
+	}
+}